@@ -0,0 +1,557 @@
+// Package ast declares the typed syntax tree of tonho, that
+// is built by lowering the concrete syntax tree of the parser,
+// so the semantic passes work with named fields, like the
+// Params of a FunDecl, instead of the kinds and the children
+// of the untyped nodes.
+package ast
+
+import "tonho"
+
+// Node represents a node of the typed tree.
+type Node interface {
+	// Syntax gets the node of the concrete syntax tree,
+	// that the node was lowered from, so its location
+	// and its tokens can be got.
+	Syntax() tonho.Node
+}
+
+// Stmt represents a statement, like a declaration, an
+// assignment or an expression.
+type Stmt interface {
+	Node
+	stmtNode()
+}
+
+// Decl represents a declaration, like a function or a
+// struct, that is a statement too.
+type Decl interface {
+	Stmt
+	declNode()
+}
+
+// Expr represents an expression.
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// Type represents a type expression, like `List<Int>`.
+type Type interface {
+	Node
+	typeNode()
+}
+
+// Pattern represents a pattern, like `Shape.Circle(r)`.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// syntax holds the concrete node of a typed node.
+type syntax struct {
+	node tonho.Node
+}
+
+// Syntax gets the node of the concrete syntax tree.
+func (s syntax) Syntax() tonho.Node {
+	return s.node
+}
+
+// File is the root of the tree, with the statements of
+// the source file.
+type File struct {
+	syntax
+	Stmts []Stmt
+}
+
+// Attribute is an attribute of a declaration, like
+// `@deprecated("use g")`.
+type Attribute struct {
+	syntax
+	Name string
+	Args []Expr
+}
+
+// TypeParam is a generic parameter, like `T: Eq`.
+type TypeParam struct {
+	syntax
+	Name  string
+	Bound Type // or nil
+}
+
+// Param is a parameter of a function or a lambda.
+type Param struct {
+	syntax
+	Name     string
+	Type     Type // or nil, in the lambdas
+	Variadic bool
+	Default  Expr // or nil
+}
+
+// Field is a field of a struct.
+type Field struct {
+	syntax
+	Name    string
+	Type    Type
+	Default Expr // or nil
+}
+
+// Variant is a variant of an enum, with the types of
+// its fields.
+type Variant struct {
+	syntax
+	Name   string
+	Fields []Type
+}
+
+// ImportItem is an item of a grouped import, like the
+// `b as c` of `import a.{b as c}`.
+type ImportItem struct {
+	syntax
+	Name  string
+	Alias string
+}
+
+// FunDecl is a function declaration.
+type FunDecl struct {
+	syntax
+	Attributes []*Attribute
+	Name       string
+	Generics   []*TypeParam
+	Params     []*Param
+	Result     Type // or nil
+	Body       *Block
+}
+
+// ValDecl is a val or a var declaration, that binds
+// either a name or a pattern.
+type ValDecl struct {
+	syntax
+	Attributes []*Attribute
+	Mutable    bool
+	Name       string
+	Pattern    Pattern // or nil, if it binds a name
+	Type       Type    // or nil
+	Value      Expr    // or nil
+}
+
+// StructDecl is a struct declaration.
+type StructDecl struct {
+	syntax
+	Attributes []*Attribute
+	Name       string
+	Generics   []*TypeParam
+	Fields     []*Field
+}
+
+// EnumDecl is an enum declaration.
+type EnumDecl struct {
+	syntax
+	Attributes []*Attribute
+	Name       string
+	Generics   []*TypeParam
+	Variants   []*Variant
+}
+
+// ModuleDecl is the module declaration of the file.
+type ModuleDecl struct {
+	syntax
+	Path []string
+}
+
+// ImportDecl is an import, like `import a.b as c` or
+// `import a.{b, c}`.
+type ImportDecl struct {
+	syntax
+	Path  []string
+	Alias string
+	Items []*ImportItem
+}
+
+// ExprStmt is an expression used as a statement.
+type ExprStmt struct {
+	syntax
+	X Expr
+}
+
+// AssignStmt is an assignment, like `x += 1`, where the
+// operator is either `=` or a compound assignment.
+type AssignStmt struct {
+	syntax
+	Target Expr
+	Op     tonho.TokenKind
+	Value  Expr
+}
+
+// WhileStmt is a while loop.
+type WhileStmt struct {
+	syntax
+	Label string
+	Cond  Expr
+	Body  *Block
+}
+
+// ForStmt is a for loop, like `for x in xs {}`.
+type ForStmt struct {
+	syntax
+	Label string
+	Name  string
+	Iter  Expr
+	Body  *Block
+}
+
+// LoopStmt is a loop, that runs until a break.
+type LoopStmt struct {
+	syntax
+	Label string
+	Body  *Block
+}
+
+// DeferStmt is a defer statement.
+type DeferStmt struct {
+	syntax
+	Body *Block
+}
+
+// BadStmt is a statement with syntax errors.
+type BadStmt struct {
+	syntax
+}
+
+// Ident is a name, like `x`.
+type Ident struct {
+	syntax
+	Name string
+}
+
+// BasicLit is a literal, like `1`, `"a"`, `'c'` or
+// `true`, where the value is the text of the token,
+// with the escapes of the strings decoded.
+type BasicLit struct {
+	syntax
+	Kind  tonho.TokenKind
+	Value string
+}
+
+// StringExpr is a string with interpolations, like
+// `"a ${b} c"`, where the parts are the segments, as
+// BasicLit, and the interpolated expressions.
+type StringExpr struct {
+	syntax
+	Parts []Expr
+}
+
+// BinaryExpr is a binary expression, like `a + b`.
+type BinaryExpr struct {
+	syntax
+	X  Expr
+	Op tonho.TokenKind
+	Y  Expr
+}
+
+// UnaryExpr is a prefix expression, like `-x`.
+type UnaryExpr struct {
+	syntax
+	Op tonho.TokenKind
+	X  Expr
+}
+
+// ParenExpr is an expression between parentheses.
+type ParenExpr struct {
+	syntax
+	X Expr
+}
+
+// CallExpr is a call, like `f(a, n: 2) { it }`.
+type CallExpr struct {
+	syntax
+	Fun    Expr
+	Args   []Expr
+	Lambda *LambdaExpr // the trailing lambda, or nil
+}
+
+// NamedArg is a named argument, like `width: 10`.
+type NamedArg struct {
+	syntax
+	Name  string
+	Value Expr
+}
+
+// SpreadExpr is a spread element, like `...xs`.
+type SpreadExpr struct {
+	syntax
+	X Expr
+}
+
+// MemberExpr is a member access, like `a.b` or `a?.b`.
+type MemberExpr struct {
+	syntax
+	X    Expr
+	Safe bool
+	Name string
+}
+
+// IndexExpr is an index expression, like `xs[i]`.
+type IndexExpr struct {
+	syntax
+	X     Expr
+	Index Expr
+}
+
+// TypeAppExpr is an expression with type arguments,
+// like the callee of `f<Int>(1)`.
+type TypeAppExpr struct {
+	syntax
+	X    Expr
+	Args []Type
+}
+
+// RangeExpr is a range, like `0..n by 2`, where the
+// ends of the slices can be missing.
+type RangeExpr struct {
+	syntax
+	Low       Expr // or nil
+	High      Expr // or nil
+	Inclusive bool
+	Step      Expr // or nil
+}
+
+// IfExpr is a conditional, where the branches are
+// either blocks or expressions.
+type IfExpr struct {
+	syntax
+	Cond Expr
+	Then Expr
+	Else Expr // or nil
+}
+
+// WhenExpr is a when expression.
+type WhenExpr struct {
+	syntax
+	Subject Expr // or nil
+	Arms    []*WhenArm
+}
+
+// WhenArm is an arm of a when expression, with its
+// conditions, that are expressions, patterns or the
+// types of the `is` conditions, and its optional guard.
+// The else arm has no conditions.
+type WhenArm struct {
+	syntax
+	Else  bool
+	Exprs []Expr
+	Pats  []Pattern
+	Types []Type
+	Guard Expr // or nil
+	Body  Expr
+}
+
+// TestExpr tests if a value has a type or matches a
+// pattern, like the conditions of the arms of a when,
+// that are desugared into ifs. The names bound by the
+// pattern are in the scope of the rest of the condition
+// and of the then branch of the if.
+type TestExpr struct {
+	syntax
+	X       Expr
+	Type    Type    // or nil, if it tests a pattern
+	Pattern Pattern // or nil, if it tests a type
+}
+
+// FinallyExpr runs its body, and then the finally block,
+// when the body exits, at its end, or by a return, a break
+// or a continue, like the defers, that are desugared into
+// it. Its value is the value of the body.
+type FinallyExpr struct {
+	syntax
+	Body    *Block
+	Finally *Block
+}
+
+// LambdaExpr is a lambda, like `{ a -> a + 1 }` or
+// `(a) -> a + 1`, where the body of the second one is
+// a single expression statement.
+type LambdaExpr struct {
+	syntax
+	Params []*Param
+	Body   []Stmt
+}
+
+// ListExpr is a list literal.
+type ListExpr struct {
+	syntax
+	Elems []Expr
+}
+
+// MapEntry is an entry of a map literal.
+type MapEntry struct {
+	syntax
+	Key   Expr
+	Value Expr
+}
+
+// MapExpr is a map literal, like `#{ "a": 1 }`.
+type MapExpr struct {
+	syntax
+	Entries []*MapEntry
+}
+
+// TupleExpr is a tuple literal, like `(1, 2)`.
+type TupleExpr struct {
+	syntax
+	Elems []Expr
+}
+
+// Block is a block, like a function body, that is an
+// expression too, like a branch of an if.
+type Block struct {
+	syntax
+	Stmts []Stmt
+}
+
+// ReturnExpr is a return, with an optional value.
+type ReturnExpr struct {
+	syntax
+	Value Expr // or nil
+}
+
+// BranchExpr is a break or a continue, with an
+// optional label.
+type BranchExpr struct {
+	syntax
+	Tok   tonho.TokenKind
+	Label string
+}
+
+// BadExpr is an expression with syntax errors.
+type BadExpr struct {
+	syntax
+}
+
+// NamedType is a type name, like `Int` or `List<T>`.
+type NamedType struct {
+	syntax
+	Name string
+	Args []Type
+}
+
+// FunctionType is a function type, like `(Int) -> Int`.
+type FunctionType struct {
+	syntax
+	Params []Type
+	Result Type
+}
+
+// OptionalType is an optional type, like `Int?`.
+type OptionalType struct {
+	syntax
+	Elem Type
+}
+
+// TupleType is a tuple type, like `(Int, String)`.
+type TupleType struct {
+	syntax
+	Elems []Type
+}
+
+// BadType is a type with syntax errors.
+type BadType struct {
+	syntax
+}
+
+// WildcardPattern is the `_` pattern.
+type WildcardPattern struct {
+	syntax
+}
+
+// LiteralPattern is a literal pattern, like `-1`.
+type LiteralPattern struct {
+	syntax
+	Value Expr
+}
+
+// BindingPattern is a name, that binds the value.
+type BindingPattern struct {
+	syntax
+	Name string
+}
+
+// VariantPattern is a variant pattern, like
+// `Shape.Circle(r)`, where the fields are nil if
+// there are no parentheses.
+type VariantPattern struct {
+	syntax
+	Path   []string
+	Fields []Pattern
+}
+
+// TuplePattern is a tuple pattern, like `(x, _)`.
+type TuplePattern struct {
+	syntax
+	Elems []Pattern
+}
+
+// BadPattern is a pattern with syntax errors.
+type BadPattern struct {
+	syntax
+}
+
+func (*FunDecl) stmtNode()    {}
+func (*ValDecl) stmtNode()    {}
+func (*StructDecl) stmtNode() {}
+func (*EnumDecl) stmtNode()   {}
+func (*ModuleDecl) stmtNode() {}
+func (*ImportDecl) stmtNode() {}
+func (*ExprStmt) stmtNode()   {}
+func (*AssignStmt) stmtNode() {}
+func (*WhileStmt) stmtNode()  {}
+func (*ForStmt) stmtNode()    {}
+func (*LoopStmt) stmtNode()   {}
+func (*DeferStmt) stmtNode()  {}
+func (*BadStmt) stmtNode()    {}
+
+func (*FunDecl) declNode()    {}
+func (*ValDecl) declNode()    {}
+func (*StructDecl) declNode() {}
+func (*EnumDecl) declNode()   {}
+func (*ModuleDecl) declNode() {}
+func (*ImportDecl) declNode() {}
+
+func (*Ident) exprNode()       {}
+func (*BasicLit) exprNode()    {}
+func (*StringExpr) exprNode()  {}
+func (*BinaryExpr) exprNode()  {}
+func (*UnaryExpr) exprNode()   {}
+func (*ParenExpr) exprNode()   {}
+func (*CallExpr) exprNode()    {}
+func (*NamedArg) exprNode()    {}
+func (*SpreadExpr) exprNode()  {}
+func (*MemberExpr) exprNode()  {}
+func (*IndexExpr) exprNode()   {}
+func (*TypeAppExpr) exprNode() {}
+func (*RangeExpr) exprNode()   {}
+func (*IfExpr) exprNode()      {}
+func (*WhenExpr) exprNode()    {}
+func (*TestExpr) exprNode()    {}
+func (*FinallyExpr) exprNode() {}
+func (*LambdaExpr) exprNode()  {}
+func (*ListExpr) exprNode()    {}
+func (*MapExpr) exprNode()     {}
+func (*TupleExpr) exprNode()   {}
+func (*Block) exprNode()       {}
+func (*ReturnExpr) exprNode()  {}
+func (*BranchExpr) exprNode()  {}
+func (*BadExpr) exprNode()     {}
+
+func (*NamedType) typeNode()    {}
+func (*FunctionType) typeNode() {}
+func (*OptionalType) typeNode() {}
+func (*TupleType) typeNode()    {}
+func (*BadType) typeNode()      {}
+
+func (*WildcardPattern) patternNode() {}
+func (*LiteralPattern) patternNode()  {}
+func (*BindingPattern) patternNode()  {}
+func (*VariantPattern) patternNode()  {}
+func (*TuplePattern) patternNode()    {}
+func (*BadPattern) patternNode()      {}
@@ -0,0 +1,435 @@
+package ast
+
+import (
+	"fmt"
+
+	"tonho"
+)
+
+// Desugar returns the core tree of the file, where the
+// surface constructs are rewritten into smaller forms, so
+// the typer, the interpreter and the backends only handle
+// the core forms:
+//
+//   - The for loops, like `for x in xs { ... }`, into while
+//     loops over the iterator of the value, like
+//     `val it = xs.iterator(); while it.hasNext() { val x = it.next(); ... }`.
+//   - The interpolated strings, like `"a ${b}"`, into the
+//     concatenations of their segments and the strings of
+//     the values, like `"a " + b.toString()`.
+//   - The compound assignments, like `x += 1`, into plain
+//     assignments, like `x = x + 1`, where the object and
+//     the index of the target are evaluated once, unlike
+//     tonho.DesugarAssignment.
+//   - The pipelines, like `x |> f(y)`, into calls, like
+//     `f(x, y)`, with tonho.DesugarPipelines.
+//   - The whens into chains of ifs, that test the subject
+//     against the conditions of the arms, with TestExpr
+//     for the types and the patterns.
+//   - The defers into FinallyExpr, that run the deferred
+//     block when the rest of its scope exits, so the
+//     defers of a scope run in the reverse order.
+//
+// The temporaries, like the iterators and the subjects,
+// are named with a `$`, so they can't clash with the names
+// of the code. The nodes of the core tree point to the
+// syntax of the constructs they come from, and the nodes
+// that are kept are shared with the file, that is left as
+// it is.
+func Desugar(file *File) *File {
+	d := &desugarer{}
+	return &File{file.syntax, d.stmts(file.Stmts)}
+}
+
+// DesugarExpr returns the core tree of an expression,
+// like Desugar.
+func DesugarExpr(expr Expr) Expr {
+	return (&desugarer{}).expr(expr)
+}
+
+// DesugarStmt returns the core tree of a statement, like
+// Desugar.
+func DesugarStmt(stmt Stmt) Stmt {
+	return (&desugarer{}).stmt(stmt)
+}
+
+// desugarer holds the counter of the temporaries.
+type desugarer struct {
+	temporaries int
+}
+
+// temporary returns a fresh name for a temporary.
+func (d *desugarer) temporary(name string) string {
+	d.temporaries++
+	return fmt.Sprintf("$%s%d", name, d.temporaries)
+}
+
+// stmts desugars the given statements, where a defer wraps
+// the statements after it, up to the end of the scope, in
+// a FinallyExpr with the deferred block:
+//
+//	{ a; defer { b }; c; defer { d }; e }
+//
+// into:
+//
+//	{ a; finally { c; finally { e } { d } } { b } }
+//
+// So the deferred blocks run at the exit of the scope, in
+// the reverse order, and only if the defer was reached.
+func (d *desugarer) stmts(stmts []Stmt) []Stmt {
+	var core []Stmt
+	for n, stmt := range stmts {
+		if deferred, ok := stmt.(*DeferStmt); ok && deferred.Body != nil {
+			s := deferred.syntax
+			body := &Block{s, d.stmts(stmts[n+1:])}
+			return append(core, &ExprStmt{s, &FinallyExpr{s, body, d.block(deferred.Body)}})
+		}
+		core = append(core, d.stmt(stmt))
+	}
+	return core
+}
+
+// stmt desugars a statement.
+func (d *desugarer) stmt(stmt Stmt) Stmt {
+	switch stmt := stmt.(type) {
+	case *FunDecl:
+		fun := *stmt
+		fun.Attributes = d.attributes(stmt.Attributes)
+		fun.Params = d.params(stmt.Params)
+		fun.Body = d.block(stmt.Body)
+		return &fun
+	case *ValDecl:
+		val := *stmt
+		val.Attributes = d.attributes(stmt.Attributes)
+		val.Value = d.expr(stmt.Value)
+		return &val
+	case *StructDecl:
+		structure := *stmt
+		structure.Attributes = d.attributes(stmt.Attributes)
+		structure.Fields = nil
+		for _, field := range stmt.Fields {
+			core := *field
+			core.Default = d.expr(field.Default)
+			structure.Fields = append(structure.Fields, &core)
+		}
+		return &structure
+	case *EnumDecl:
+		enum := *stmt
+		enum.Attributes = d.attributes(stmt.Attributes)
+		return &enum
+	case *ExprStmt:
+		return &ExprStmt{stmt.syntax, d.expr(stmt.X)}
+	case *AssignStmt:
+		if _, ok := tonho.CompoundOperator(stmt.Op); ok {
+			return d.compoundAssign(stmt)
+		}
+		return &AssignStmt{stmt.syntax, d.expr(stmt.Target), stmt.Op, d.expr(stmt.Value)}
+	case *WhileStmt:
+		return &WhileStmt{stmt.syntax, stmt.Label, d.expr(stmt.Cond), d.block(stmt.Body)}
+	case *ForStmt:
+		return d.forStmt(stmt)
+	case *LoopStmt:
+		return &LoopStmt{stmt.syntax, stmt.Label, d.block(stmt.Body)}
+	case *DeferStmt:
+		// A defer out of a scope, like the one of
+		// DesugarStmt, has no statements to wrap.
+		return &DeferStmt{stmt.syntax, d.block(stmt.Body)}
+	}
+	return stmt
+}
+
+// forStmt desugars a for loop into a while loop over the
+// iterator of the value, in a block with the iterator:
+//
+//	{
+//		val $iterator1 = xs.iterator()
+//		while $iterator1.hasNext() {
+//			val x = $iterator1.next()
+//			{ ... }
+//		}
+//	}
+//
+// The body is kept in its own block, so its declarations
+// can shadow the variable of the loop.
+func (d *desugarer) forStmt(loop *ForStmt) Stmt {
+	if loop.Iter == nil {
+		return &BadStmt{loop.syntax}
+	}
+	s := loop.syntax
+	iterator := d.temporary("iterator")
+	method := func(x Expr, name string) Expr {
+		return &CallExpr{syntax: s, Fun: &MemberExpr{s, x, false, name}}
+	}
+
+	body := &Block{s, []Stmt{&ValDecl{syntax: s, Name: loop.Name, Value: method(&Ident{s, iterator}, "next")}}}
+	if loop.Body != nil {
+		body.Stmts = append(body.Stmts, &ExprStmt{s, d.block(loop.Body)})
+	}
+	return &ExprStmt{s, &Block{s, []Stmt{
+		&ValDecl{syntax: s, Name: iterator, Value: method(d.expr(loop.Iter), "iterator")},
+		&WhileStmt{s, loop.Label, method(&Ident{s, iterator}, "hasNext"), body},
+	}}}
+}
+
+// compoundAssign desugars a compound assignment into a
+// plain one, where the object and the index of the target
+// are bound to temporaries first, if they aren't names or
+// literals, so they are evaluated once:
+//
+//	{
+//		val $object1 = a.b
+//		val $index2 = f()
+//		$object1[$index2] = $object1[$index2] + 1
+//	}
+func (d *desugarer) compoundAssign(assign *AssignStmt) Stmt {
+	s := assign.syntax
+	operator, _ := tonho.CompoundOperator(assign.Op)
+	var stmts []Stmt
+	bind := func(expr Expr, name string) Expr {
+		switch expr.(type) {
+		case nil, *Ident, *BasicLit:
+			return expr
+		}
+		temporary := d.temporary(name)
+		stmts = append(stmts, &ValDecl{syntax: s, Name: temporary, Value: expr})
+		return &Ident{s, temporary}
+	}
+
+	target := d.expr(assign.Target)
+	switch t := target.(type) {
+	case *MemberExpr:
+		target = &MemberExpr{t.syntax, bind(t.X, "object"), t.Safe, t.Name}
+	case *IndexExpr:
+		object := bind(t.X, "object")
+		target = &IndexExpr{t.syntax, object, bind(t.Index, "index")}
+	}
+	core := &AssignStmt{s, target, tonho.Assign, &BinaryExpr{s, target, operator, d.expr(assign.Value)}}
+	if len(stmts) == 0 {
+		return core
+	}
+	return &ExprStmt{s, &Block{s, append(stmts, core)}}
+}
+
+// attributes desugars the arguments of the attributes.
+func (d *desugarer) attributes(attributes []*Attribute) []*Attribute {
+	var core []*Attribute
+	for _, attribute := range attributes {
+		core = append(core, &Attribute{attribute.syntax, attribute.Name, d.exprs(attribute.Args)})
+	}
+	return core
+}
+
+// params desugars the default values of the parameters.
+func (d *desugarer) params(params []*Param) []*Param {
+	var core []*Param
+	for _, param := range params {
+		copied := *param
+		copied.Default = d.expr(param.Default)
+		core = append(core, &copied)
+	}
+	return core
+}
+
+// block desugars a block, that can be nil.
+func (d *desugarer) block(block *Block) *Block {
+	if block == nil {
+		return nil
+	}
+	return &Block{block.syntax, d.stmts(block.Stmts)}
+}
+
+// exprs desugars the given expressions.
+func (d *desugarer) exprs(exprs []Expr) []Expr {
+	var core []Expr
+	for _, expr := range exprs {
+		core = append(core, d.expr(expr))
+	}
+	return core
+}
+
+// expr desugars an expression, that can be nil.
+func (d *desugarer) expr(expr Expr) Expr {
+	switch expr := expr.(type) {
+	case *StringExpr:
+		return d.stringExpr(expr)
+	case *BinaryExpr:
+		if expr.Op == tonho.Pipeline {
+			return d.pipeline(expr)
+		}
+		return &BinaryExpr{expr.syntax, d.expr(expr.X), expr.Op, d.expr(expr.Y)}
+	case *UnaryExpr:
+		return &UnaryExpr{expr.syntax, expr.Op, d.expr(expr.X)}
+	case *ParenExpr:
+		return &ParenExpr{expr.syntax, d.expr(expr.X)}
+	case *CallExpr:
+		call := &CallExpr{syntax: expr.syntax, Fun: d.expr(expr.Fun), Args: d.exprs(expr.Args)}
+		if expr.Lambda != nil {
+			call.Lambda = d.lambda(expr.Lambda)
+		}
+		return call
+	case *NamedArg:
+		return &NamedArg{expr.syntax, expr.Name, d.expr(expr.Value)}
+	case *SpreadExpr:
+		return &SpreadExpr{expr.syntax, d.expr(expr.X)}
+	case *MemberExpr:
+		return &MemberExpr{expr.syntax, d.expr(expr.X), expr.Safe, expr.Name}
+	case *IndexExpr:
+		return &IndexExpr{expr.syntax, d.expr(expr.X), d.expr(expr.Index)}
+	case *TypeAppExpr:
+		return &TypeAppExpr{expr.syntax, d.expr(expr.X), expr.Args}
+	case *RangeExpr:
+		return &RangeExpr{expr.syntax, d.expr(expr.Low), d.expr(expr.High), expr.Inclusive, d.expr(expr.Step)}
+	case *IfExpr:
+		return &IfExpr{expr.syntax, d.expr(expr.Cond), d.expr(expr.Then), d.expr(expr.Else)}
+	case *WhenExpr:
+		return d.whenExpr(expr)
+	case *TestExpr:
+		return &TestExpr{expr.syntax, d.expr(expr.X), expr.Type, expr.Pattern}
+	case *FinallyExpr:
+		return &FinallyExpr{expr.syntax, d.block(expr.Body), d.block(expr.Finally)}
+	case *LambdaExpr:
+		return d.lambda(expr)
+	case *ListExpr:
+		return &ListExpr{expr.syntax, d.exprs(expr.Elems)}
+	case *MapExpr:
+		entries := &MapExpr{syntax: expr.syntax}
+		for _, entry := range expr.Entries {
+			entries.Entries = append(entries.Entries, &MapEntry{entry.syntax, d.expr(entry.Key), d.expr(entry.Value)})
+		}
+		return entries
+	case *TupleExpr:
+		return &TupleExpr{expr.syntax, d.exprs(expr.Elems)}
+	case *Block:
+		return d.block(expr)
+	case *ReturnExpr:
+		return &ReturnExpr{expr.syntax, d.expr(expr.Value)}
+	}
+	return expr
+}
+
+// lambda desugars the body and the parameters of a lambda.
+func (d *desugarer) lambda(lambda *LambdaExpr) *LambdaExpr {
+	return &LambdaExpr{lambda.syntax, d.params(lambda.Params), d.stmts(lambda.Body)}
+}
+
+// pipeline desugars a pipeline into a call, by lowering
+// the call of tonho.DesugarPipelines, like `x |> f(y)`
+// into `f(x, y)`.
+func (d *desugarer) pipeline(pipeline *BinaryExpr) Expr {
+	call := tonho.DesugarPipelines(pipeline.Syntax())
+	if call.Kind != tonho.CallNode {
+		return &BadExpr{pipeline.syntax}
+	}
+	return d.expr(lowerExpr(call))
+}
+
+// stringExpr desugars an interpolated string into the
+// concatenation of its parts, where the values are turned
+// into strings, like `"a ${b}"` into `"a " + b.toString()`,
+// so `"${1}${2}"` is `1.toString() + 2.toString()`, and not
+// an addition. Only the string literals are kept as they
+// are, as they're strings already.
+func (d *desugarer) stringExpr(str *StringExpr) Expr {
+	var concat Expr
+	for _, part := range str.Parts {
+		if lit, ok := part.(*BasicLit); !ok || lit.Kind != tonho.String {
+			part = &CallExpr{syntax: str.syntax, Fun: &MemberExpr{str.syntax, d.expr(part), false, "toString"}}
+		}
+		if concat == nil {
+			concat = part
+		} else {
+			concat = &BinaryExpr{str.syntax, concat, tonho.Plus, part}
+		}
+	}
+	if concat == nil {
+		return &BasicLit{str.syntax, tonho.String, ""}
+	}
+	return concat
+}
+
+// whenExpr desugars a when into a chain of ifs, in a block
+// that evaluates the subject once, if there's one:
+//
+//	{
+//		val $subject1 = s
+//		if $subject1 == 1 || $subject1 == 2 { ... }
+//		else if $subject1 is Shape.Circle(r) && r > 0 { ... }
+//		else { ... }
+//	}
+//
+// Without a subject, the conditions are the expressions
+// of the arms. The arms after the else one are dropped, as
+// they are never reached.
+func (d *desugarer) whenExpr(when *WhenExpr) Expr {
+	s := when.syntax
+	var subject Expr
+	var stmts []Stmt
+	if when.Subject != nil {
+		name := d.temporary("subject")
+		stmts = append(stmts, &ValDecl{syntax: s, Name: name, Value: d.expr(when.Subject)})
+		subject = &Ident{s, name}
+	}
+
+	// The chain is built from the last arm, so each if is
+	// the else branch of the one before.
+	arms := when.Arms
+	for i, arm := range arms {
+		if arm.Else {
+			arms = arms[:i+1]
+			break
+		}
+	}
+	var chain Expr
+	for i := len(arms) - 1; i >= 0; i-- {
+		arm := arms[i]
+		if arm.Else {
+			chain = d.expr(arm.Body)
+			continue
+		}
+		chain = &IfExpr{arm.syntax, d.condition(arm, subject), d.expr(arm.Body), chain}
+	}
+	if chain == nil {
+		chain = &Block{syntax: s}
+	}
+
+	if subject == nil {
+		return chain
+	}
+	return &Block{s, append(stmts, &ExprStmt{s, chain})}
+}
+
+// condition returns the condition of an arm of a when,
+// that is the disjunction of its tests, and its guard.
+func (d *desugarer) condition(arm *WhenArm, subject Expr) Expr {
+	s := arm.syntax
+	var tests []Expr
+	for _, expr := range arm.Exprs {
+		if subject == nil {
+			tests = append(tests, d.expr(expr))
+		} else {
+			tests = append(tests, &BinaryExpr{s, subject, tonho.Equal, d.expr(expr)})
+		}
+	}
+	for _, typ := range arm.Types {
+		tests = append(tests, &TestExpr{s, subject, typ, nil})
+	}
+	for _, pattern := range arm.Pats {
+		tests = append(tests, &TestExpr{s, subject, nil, pattern})
+	}
+
+	var condition Expr
+	for _, test := range tests {
+		if condition == nil {
+			condition = test
+		} else {
+			condition = &BinaryExpr{s, condition, tonho.Or, test}
+		}
+	}
+	if condition == nil {
+		return &BadExpr{s}
+	}
+	if arm.Guard != nil {
+		condition = &BinaryExpr{s, condition, tonho.And, d.expr(arm.Guard)}
+	}
+	return condition
+}
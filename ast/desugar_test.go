@@ -0,0 +1,225 @@
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"tonho"
+	"tonho/ast"
+)
+
+// show formats a node of the core tree, with the operators
+// between parentheses, so the tests can compare the shapes
+// of the desugared trees.
+func show(node any) string {
+	switch node := node.(type) {
+	case nil:
+		return "nil"
+	case *ast.Ident:
+		return node.Name
+	case *ast.BasicLit:
+		switch node.Kind {
+		case tonho.String:
+			return fmt.Sprintf("%q", node.Value)
+		case tonho.Char:
+			return "'" + node.Value + "'"
+		}
+		return node.Value
+	case *ast.BinaryExpr:
+		return "(" + show(node.X) + " " + node.Op.String() + " " + show(node.Y) + ")"
+	case *ast.UnaryExpr:
+		return node.Op.String() + show(node.X)
+	case *ast.ParenExpr:
+		return "(" + show(node.X) + ")"
+	case *ast.CallExpr:
+		text := show(node.Fun) + "(" + shows(node.Args) + ")"
+		if node.Lambda != nil {
+			text += " " + show(node.Lambda)
+		}
+		return text
+	case *ast.MemberExpr:
+		return show(node.X) + "." + node.Name
+	case *ast.IndexExpr:
+		return show(node.X) + "[" + show(node.Index) + "]"
+	case *ast.RangeExpr:
+		text, operator := "(", ".."
+		if node.Inclusive {
+			operator = "..="
+		}
+		if node.Low != nil {
+			text += show(node.Low)
+		}
+		text += operator
+		if node.High != nil {
+			text += show(node.High)
+		}
+		if node.Step != nil {
+			text += " by " + show(node.Step)
+		}
+		return text + ")"
+	case *ast.IfExpr:
+		text := "if " + show(node.Cond) + " " + show(node.Then)
+		if node.Else != nil {
+			text += " else " + show(node.Else)
+		}
+		return text
+	case *ast.TestExpr:
+		if node.Type != nil {
+			return show(node.X) + " is " + show(node.Type)
+		}
+		return show(node.X) + " matches " + show(node.Pattern)
+	case *ast.FinallyExpr:
+		return "finally " + show(node.Body) + " " + show(node.Finally)
+	case *ast.LambdaExpr:
+		return "{ " + shows(node.Body) + " }"
+	case *ast.Block:
+		return "{ " + shows(node.Stmts) + " }"
+	case *ast.ReturnExpr:
+		return "return " + show(node.Value)
+	case *ast.NamedType:
+		return node.Name
+	case *ast.BindingPattern:
+		return node.Name
+	case *ast.ExprStmt:
+		return show(node.X)
+	case *ast.ValDecl:
+		keyword := "val"
+		if node.Mutable {
+			keyword = "var"
+		}
+		return keyword + " " + node.Name + " = " + show(node.Value)
+	case *ast.AssignStmt:
+		return show(node.Target) + " " + node.Op.String() + " " + show(node.Value)
+	case *ast.WhileStmt:
+		return "while " + show(node.Cond) + " " + show(node.Body)
+	case *ast.FunDecl:
+		return "fun " + node.Name + " " + show(node.Body)
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+// shows formats the nodes, separated by `;` if they're
+// statements, and by `,` if they're expressions.
+func shows[T any](nodes []T) string {
+	var texts []string
+	separator := ", "
+	for _, node := range nodes {
+		if _, ok := any(node).(ast.Stmt); ok {
+			separator = "; "
+		}
+		texts = append(texts, show(node))
+	}
+	return strings.Join(texts, separator)
+}
+
+// desugared parses the input as a file, and returns its
+// desugared statements, failing the test on any diagnostic.
+func desugared(t *testing.T, input string) string {
+	t.Helper()
+	tree, diagnostics := tonho.Parse("test", input)
+	if len(diagnostics) > 0 {
+		t.Fatalf("parsing %q: %v", input, diagnostics)
+	}
+	return shows(ast.Desugar(ast.Lower(tree)).Stmts)
+}
+
+func TestDesugarStrings(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{`val s = "a ${b} c"`, `val s = (("a " + b.toString()) + " c")`},
+		{`val s = "${b}"`, `val s = b.toString()`},
+
+		// The literals that are interpolated are turned into
+		// strings too, so they're concatenated, and not added.
+		{`val s = "${1}${2}"`, `val s = (1.toString() + 2.toString())`},
+		{`val s = "a${1}"`, `val s = ("a" + 1.toString())`},
+		{`val s = "a${'b'}"`, `val s = ("a" + 'b'.toString())`},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if got := desugared(t, test.input); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDesugarPipelines(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"xs |> f", "f(xs)"},
+		{"xs |> f(y)", "f(xs, y)"},
+		{"xs |> f |> g(y)", "g(f(xs), y)"},
+		{"xs |> each() { it }", "each(xs) { it }"},
+		{"xs |> fold(0) { it }", "fold(xs, 0) { it }"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if got := desugared(t, test.input); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDesugarDefers(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"fun f() {\n  defer { close() }\n  g()\n}", "fun f { finally { g() } { close() } }"},
+
+		// The later defers run first, so they're the inner ones.
+		{"fun f() {\n  defer { a() }\n  defer { b() }\n  g()\n}", "fun f { finally { finally { g() } { b() } } { a() } }"},
+		{"fun f() {\n  g()\n  defer { a() }\n}", "fun f { g(); finally {  } { a() } }"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if got := desugared(t, test.input); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDesugarAssignments(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"x += 1", "x = (x + 1)"},
+		{"x *= y + 1", "x = (x * (y + 1))"},
+		{"a[i] -= 2", "a[i] = (a[i] - 2)"},
+		{"p.x /= 2", "p.x = (p.x / 2)"},
+		{"x = 1", "x = 1"},
+
+		// The object and the index that aren't names or
+		// literals are evaluated once, in temporaries.
+		{"a.b[f()] += 1", "{ val $object1 = a.b; val $index2 = f(); $object1[$index2] = ($object1[$index2] + 1) }"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if got := desugared(t, test.input); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDesugarFors(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"for (x in xs) { f(x) }", "{ val $iterator1 = xs.iterator(); while $iterator1.hasNext() { val x = $iterator1.next(); { f(x) } } }"},
+		{"for (i in 0..n) { f(i) }", "{ val $iterator1 = (0..n).iterator(); while $iterator1.hasNext() { val i = $iterator1.next(); { f(i) } } }"},
+		{"for (i in 0..=n by 2) { f(i) }", "{ val $iterator1 = (0..=n by 2).iterator(); while $iterator1.hasNext() { val i = $iterator1.next(); { f(i) } } }"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if got := desugared(t, test.input); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,640 @@
+package ast
+
+import "tonho"
+
+// Lower lowers the file node of the concrete syntax tree,
+// like the one returned by tonho.Parse, into the typed tree.
+//
+// The nodes with syntax errors are lowered into BadStmt,
+// BadExpr, BadType or BadPattern, and the missing parts,
+// like the value of `val x =`, are left nil, so the tree
+// can be lowered even with errors.
+func Lower(file tonho.Node) *File {
+	return &File{syntax{file}, lowerStmts(file)}
+}
+
+// LowerExpr lowers a node of an expression, like the one
+// returned by tonho.ParseExpression.
+func LowerExpr(node tonho.Node) Expr {
+	return lowerExpr(node)
+}
+
+// LowerStmt lowers a node of a statement, like the one
+// returned by tonho.ParseStatement.
+func LowerStmt(node tonho.Node) Stmt {
+	return lowerStmt(node)
+}
+
+// nodes returns the child nodes of the node.
+func nodes(node tonho.Node) []tonho.Node {
+	var children []tonho.Node
+	for _, child := range node.Children {
+		if child, ok := child.(tonho.Node); ok {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// tokens returns the child tokens of the node.
+func tokens(node tonho.Node) []tonho.Token {
+	var children []tonho.Token
+	for _, child := range node.Children {
+		if child, ok := child.(tonho.Token); ok {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// find returns the first child token of the given kind.
+func find(node tonho.Node, kind tonho.TokenKind) (tonho.Token, bool) {
+	for _, token := range tokens(node) {
+		if token.Kind == kind {
+			return token, true
+		}
+	}
+	return tonho.Token{}, false
+}
+
+// name returns the text of the first identifier of the
+// node, or an empty text if it's missing.
+func name(node tonho.Node) string {
+	token, _ := find(node, tonho.Identifier)
+	return token.Text
+}
+
+// label returns the label of a loop, or an empty text.
+func label(node tonho.Node) string {
+	token, _ := find(node, tonho.Annotation)
+	return token.Text
+}
+
+// split returns the child nodes before and after the
+// first token of the given kind, like the type and the
+// value of `val x: Int = 1`, around the `=`.
+func split(node tonho.Node, kind tonho.TokenKind) (before, after []tonho.Node) {
+	seen := false
+	for _, child := range node.Children {
+		switch child := child.(type) {
+		case tonho.Token:
+			seen = seen || child.Kind == kind
+		case tonho.Node:
+			if child.Kind == tonho.AttributesNode {
+				continue
+			}
+			if seen {
+				after = append(after, child)
+			} else {
+				before = append(before, child)
+			}
+		}
+	}
+	return before, after
+}
+
+// first returns the first of the given nodes, or false
+// if there's none.
+func first(children []tonho.Node) (tonho.Node, bool) {
+	if len(children) == 0 {
+		return tonho.Node{}, false
+	}
+	return children[0], true
+}
+
+// lowerStmts lowers the statements of a file or a block.
+func lowerStmts(node tonho.Node) []Stmt {
+	var stmts []Stmt
+	for _, child := range nodes(node) {
+		stmts = append(stmts, lowerStmt(child))
+	}
+	return stmts
+}
+
+// lowerStmt lowers a statement.
+func lowerStmt(node tonho.Node) Stmt {
+	switch node.Kind {
+	case tonho.FunNode, tonho.ValNode, tonho.VarNode, tonho.StructNode, tonho.EnumNode, tonho.ModuleNode, tonho.ImportNode:
+		return lowerDecl(node)
+	case tonho.AssignNode:
+		children := nodes(node)
+		if len(children) == 0 {
+			return &BadStmt{syntax{node}}
+		}
+		assign := &AssignStmt{syntax: syntax{node}, Target: lowerExpr(children[0])}
+		for _, token := range tokens(node) {
+			if token.Kind.IsAssignmentOp() {
+				assign.Op = token.Kind
+			}
+		}
+		if len(children) > 1 {
+			assign.Value = lowerExpr(children[1])
+		}
+		return assign
+	case tonho.WhileNode:
+		loop := &WhileStmt{syntax: syntax{node}, Label: label(node)}
+		for _, child := range nodes(node) {
+			if child.Kind == tonho.BlockNode && loop.Cond != nil {
+				loop.Body = lowerBlock(child)
+			} else if loop.Cond == nil {
+				loop.Cond = lowerExpr(child)
+			}
+		}
+		return loop
+	case tonho.ForNode:
+		loop := &ForStmt{syntax: syntax{node}, Label: label(node), Name: name(node)}
+		for _, child := range nodes(node) {
+			if child.Kind == tonho.BlockNode && loop.Iter != nil {
+				loop.Body = lowerBlock(child)
+			} else if loop.Iter == nil {
+				loop.Iter = lowerExpr(child)
+			}
+		}
+		return loop
+	case tonho.LoopNode:
+		loop := &LoopStmt{syntax: syntax{node}, Label: label(node)}
+		if body, ok := first(nodes(node)); ok {
+			loop.Body = lowerBlock(body)
+		}
+		return loop
+	case tonho.DeferNode:
+		deferred := &DeferStmt{syntax: syntax{node}}
+		if body, ok := first(nodes(node)); ok {
+			deferred.Body = lowerBlock(body)
+		}
+		return deferred
+	case tonho.ErrorNode:
+		return &BadStmt{syntax{node}}
+	}
+	return &ExprStmt{syntax{node}, lowerExpr(node)}
+}
+
+// lowerDecl lowers a declaration.
+func lowerDecl(node tonho.Node) Decl {
+	var attributes []*Attribute
+	children := nodes(node)
+	if len(children) > 0 && children[0].Kind == tonho.AttributesNode {
+		for _, attribute := range nodes(children[0]) {
+			token, _ := find(attribute, tonho.Annotation)
+			attributes = append(attributes, &Attribute{syntax{attribute}, token.Text, lowerExprs(nodes(attribute))})
+		}
+		children = children[1:]
+	}
+
+	switch node.Kind {
+	case tonho.FunNode:
+		fun := &FunDecl{syntax: syntax{node}, Attributes: attributes, Name: name(node)}
+		for _, child := range children {
+			switch child.Kind {
+			case tonho.GenericsNode:
+				fun.Generics = lowerGenerics(child)
+			case tonho.ParameterNode:
+				fun.Params = append(fun.Params, lowerParam(child))
+			case tonho.BlockNode:
+				fun.Body = lowerBlock(child)
+			default:
+				fun.Result = lowerType(child)
+			}
+		}
+		return fun
+	case tonho.ValNode, tonho.VarNode:
+		val := &ValDecl{syntax: syntax{node}, Attributes: attributes, Mutable: node.Kind == tonho.VarNode, Name: name(node)}
+		before, after := split(node, tonho.Assign)
+		for _, child := range before {
+			if child.Kind == tonho.PatternNode {
+				val.Pattern = lowerPattern(child)
+			} else {
+				val.Type = lowerType(child)
+			}
+		}
+		if value, ok := first(after); ok {
+			val.Value = lowerExpr(value)
+		}
+		return val
+	case tonho.StructNode:
+		structure := &StructDecl{syntax: syntax{node}, Attributes: attributes, Name: name(node)}
+		for _, child := range children {
+			switch child.Kind {
+			case tonho.GenericsNode:
+				structure.Generics = lowerGenerics(child)
+			case tonho.FieldNode:
+				field := &Field{syntax: syntax{child}, Name: name(child)}
+				before, after := split(child, tonho.Assign)
+				if typ, ok := first(before); ok {
+					field.Type = lowerType(typ)
+				}
+				if value, ok := first(after); ok {
+					field.Default = lowerExpr(value)
+				}
+				structure.Fields = append(structure.Fields, field)
+			}
+		}
+		return structure
+	case tonho.EnumNode:
+		enum := &EnumDecl{syntax: syntax{node}, Attributes: attributes, Name: name(node)}
+		for _, child := range children {
+			switch child.Kind {
+			case tonho.GenericsNode:
+				enum.Generics = lowerGenerics(child)
+			case tonho.VariantNode:
+				enum.Variants = append(enum.Variants, &Variant{syntax{child}, name(child), lowerTypes(nodes(child))})
+			}
+		}
+		return enum
+	case tonho.ModuleNode:
+		module := &ModuleDecl{syntax: syntax{node}}
+		if len(children) > 0 {
+			module.Path = path(children[0])
+		}
+		return module
+	}
+
+	importation := &ImportDecl{syntax: syntax{node}}
+	for _, child := range children {
+		switch child.Kind {
+		case tonho.PathNode:
+			importation.Path = path(child)
+		case tonho.ImportItemNode:
+			item := &ImportItem{syntax: syntax{child}}
+			for i, token := range identifiers(child) {
+				if i == 0 {
+					item.Name = token.Text
+				} else {
+					item.Alias = token.Text
+				}
+			}
+			importation.Items = append(importation.Items, item)
+		}
+	}
+	if identifiers := identifiers(node); len(identifiers) > 0 {
+		importation.Alias = identifiers[len(identifiers)-1].Text
+	}
+	return importation
+}
+
+// identifiers returns the child identifier tokens of the
+// node.
+func identifiers(node tonho.Node) []tonho.Token {
+	var names []tonho.Token
+	for _, token := range tokens(node) {
+		if token.Kind == tonho.Identifier {
+			names = append(names, token)
+		}
+	}
+	return names
+}
+
+// path returns the names of a PathNode.
+func path(node tonho.Node) []string {
+	var names []string
+	for _, token := range identifiers(node) {
+		names = append(names, token.Text)
+	}
+	return names
+}
+
+// lowerGenerics lowers the generic parameters.
+func lowerGenerics(node tonho.Node) []*TypeParam {
+	var params []*TypeParam
+	for _, child := range nodes(node) {
+		param := &TypeParam{syntax: syntax{child}, Name: name(child)}
+		if bound := nodes(child); len(bound) > 0 {
+			param.Bound = lowerType(bound[0])
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// lowerParam lowers a parameter of a function or a lambda.
+func lowerParam(node tonho.Node) *Param {
+	param := &Param{syntax: syntax{node}, Name: name(node)}
+	_, param.Variadic = find(node, tonho.Spread)
+	before, after := split(node, tonho.Assign)
+	if typ, ok := first(before); ok {
+		param.Type = lowerType(typ)
+	}
+	if value, ok := first(after); ok {
+		param.Default = lowerExpr(value)
+	}
+	return param
+}
+
+// lowerBlock lowers a block.
+func lowerBlock(node tonho.Node) *Block {
+	return &Block{syntax{node}, lowerStmts(node)}
+}
+
+// lowerExprs lowers the given expressions.
+func lowerExprs(children []tonho.Node) []Expr {
+	var exprs []Expr
+	for _, child := range children {
+		exprs = append(exprs, lowerExpr(child))
+	}
+	return exprs
+}
+
+// lowerExpr lowers an expression.
+func lowerExpr(node tonho.Node) Expr {
+	children := nodes(node)
+	switch node.Kind {
+	case tonho.IdentifierNode:
+		return &Ident{syntax{node}, name(node)}
+	case tonho.NumberNode, tonho.StringNode, tonho.CharNode, tonho.BoolNode:
+		all := tokens(node)
+		if node.Kind == tonho.StringNode && (len(all) != 1 || len(children) > 0) {
+			return lowerString(node)
+		}
+		if len(all) == 0 {
+			return &BadExpr{syntax{node}}
+		}
+		return &BasicLit{syntax{node}, all[0].Kind, all[0].Text}
+	case tonho.ExprNode:
+		all := tokens(node)
+		switch {
+		case len(children) == 1 && len(all) > 0 && all[0].Kind == tonho.LeftParen:
+			return &ParenExpr{syntax{node}, lowerExpr(children[0])}
+		case len(children) == 1 && len(all) == 1:
+			return &UnaryExpr{syntax{node}, all[0].Kind, lowerExpr(children[0])}
+		case len(children) == 2 && len(all) == 1:
+			return &BinaryExpr{syntax{node}, lowerExpr(children[0]), all[0].Kind, lowerExpr(children[1])}
+		}
+	case tonho.CallNode:
+		if len(children) == 0 {
+			break
+		}
+		// The trailing lambda follows the `)`, or the callee,
+		// when there are no parentheses, like `xs.map { it }`.
+		call := &CallExpr{syntax: syntax{node}, Fun: lowerExpr(children[0])}
+		args, trailing := split(node, tonho.RightParen)
+		if _, ok := find(node, tonho.LeftParen); !ok {
+			args, trailing = children[:1], children[1:]
+		}
+		call.Args = lowerExprs(args[1:])
+		if lambda, ok := first(trailing); ok {
+			call.Lambda, _ = lowerExpr(lambda).(*LambdaExpr)
+		}
+		return call
+	case tonho.NamedArgumentNode:
+		arg := &NamedArg{syntax: syntax{node}, Name: name(node)}
+		if len(children) > 0 {
+			arg.Value = lowerExpr(children[0])
+		}
+		return arg
+	case tonho.SpreadNode:
+		if len(children) > 0 {
+			return &SpreadExpr{syntax{node}, lowerExpr(children[0])}
+		}
+	case tonho.MemberNode:
+		if len(children) > 0 {
+			_, safe := find(node, tonho.SafeDot)
+			return &MemberExpr{syntax{node}, lowerExpr(children[0]), safe, name(node)}
+		}
+	case tonho.IndexNode:
+		if len(children) > 1 {
+			return &IndexExpr{syntax{node}, lowerExpr(children[0]), lowerExpr(children[1])}
+		}
+	case tonho.TypeApplicationNode:
+		if len(children) > 0 {
+			return &TypeAppExpr{syntax{node}, lowerExpr(children[0]), lowerTypes(children[1:])}
+		}
+	case tonho.RangeNode:
+		return lowerRange(node)
+	case tonho.IfNode:
+		return lowerIf(node)
+	case tonho.WhenNode:
+		return lowerWhen(node)
+	case tonho.LambdaNode:
+		lambda := &LambdaExpr{syntax: syntax{node}}
+		for _, child := range children {
+			if child.Kind == tonho.ParameterNode {
+				lambda.Params = append(lambda.Params, lowerParam(child))
+			} else {
+				lambda.Body = append(lambda.Body, lowerStmt(child))
+			}
+		}
+		return lambda
+	case tonho.ListNode:
+		return &ListExpr{syntax{node}, lowerExprs(children)}
+	case tonho.MapNode:
+		entries := &MapExpr{syntax: syntax{node}}
+		for _, child := range children {
+			entry := &MapEntry{syntax: syntax{child}}
+			if parts := nodes(child); len(parts) == 2 {
+				entry.Key, entry.Value = lowerExpr(parts[0]), lowerExpr(parts[1])
+			}
+			entries.Entries = append(entries.Entries, entry)
+		}
+		return entries
+	case tonho.TupleNode:
+		return &TupleExpr{syntax{node}, lowerExprs(children)}
+	case tonho.BlockNode:
+		return lowerBlock(node)
+	case tonho.ReturnNode:
+		ret := &ReturnExpr{syntax: syntax{node}}
+		if len(children) > 0 {
+			ret.Value = lowerExpr(children[0])
+		}
+		return ret
+	case tonho.BreakNode, tonho.ContinueNode:
+		keyword := tokens(node)[0]
+		return &BranchExpr{syntax{node}, keyword.Kind, label(node)}
+	}
+	return &BadExpr{syntax{node}}
+}
+
+// lowerString lowers a string with interpolations.
+func lowerString(node tonho.Node) Expr {
+	str := &StringExpr{syntax: syntax{node}}
+	for _, child := range node.Children {
+		switch child := child.(type) {
+		case tonho.Token:
+			if child.Text != "" {
+				str.Parts = append(str.Parts, &BasicLit{syntax{node}, tonho.String, child.Text})
+			}
+		case tonho.Node:
+			str.Parts = append(str.Parts, lowerExpr(child))
+		}
+	}
+	return str
+}
+
+// lowerRange lowers a range, which ends can be missing.
+func lowerRange(node tonho.Node) Expr {
+	r := &RangeExpr{syntax: syntax{node}}
+	part := 0 // 0 is the low end, 1 the high end, 2 the step
+	for _, child := range node.Children {
+		switch child := child.(type) {
+		case tonho.Token:
+			switch child.Kind {
+			case tonho.Range, tonho.RangeInclusive:
+				r.Inclusive = child.Kind == tonho.RangeInclusive
+				part = 1
+			case tonho.By:
+				part = 2
+			}
+		case tonho.Node:
+			switch part {
+			case 0:
+				r.Low = lowerExpr(child)
+			case 1:
+				r.High = lowerExpr(child)
+			case 2:
+				r.Step = lowerExpr(child)
+			}
+		}
+	}
+	return r
+}
+
+// lowerIf lowers a conditional, with its else branch.
+func lowerIf(node tonho.Node) Expr {
+	conditional := &IfExpr{syntax: syntax{node}}
+	for _, child := range nodes(node) {
+		switch {
+		case child.Kind == tonho.ElseNode:
+			if branch := nodes(child); len(branch) > 0 {
+				conditional.Else = lowerExpr(branch[0])
+			}
+		case conditional.Cond == nil:
+			conditional.Cond = lowerExpr(child)
+		default:
+			conditional.Then = lowerExpr(child)
+		}
+	}
+	return conditional
+}
+
+// lowerWhen lowers a when expression, with its arms.
+func lowerWhen(node tonho.Node) Expr {
+	when := &WhenExpr{syntax: syntax{node}}
+	for _, child := range nodes(node) {
+		if child.Kind != tonho.WhenArmNode {
+			when.Subject = lowerExpr(child)
+			continue
+		}
+
+		arm := &WhenArm{syntax: syntax{child}}
+		_, arm.Else = find(child, tonho.Else)
+		_, body := split(child, tonho.Arrow)
+		if body, ok := first(body); ok {
+			arm.Body = lowerExpr(body)
+		}
+		lowerWhenConditions(arm, child)
+		when.Arms = append(when.Arms, arm)
+	}
+	return when
+}
+
+// lowerWhenConditions lowers the conditions of a when
+// arm, before its arrow, where a condition is a type if
+// the `is` keyword precedes it, like in `is Int, 0`.
+func lowerWhenConditions(arm *WhenArm, node tonho.Node) {
+	is := false
+	for _, child := range node.Children {
+		switch part := child.(type) {
+		case tonho.Token:
+			if part.Kind == tonho.Arrow {
+				return
+			}
+			is = part.Kind == tonho.Is
+		case tonho.Node:
+			switch {
+			case part.Kind == tonho.GuardNode:
+				if guard := nodes(part); len(guard) > 0 {
+					arm.Guard = lowerExpr(guard[0])
+				}
+			case is:
+				arm.Types = append(arm.Types, lowerType(part))
+			case isPattern(part.Kind):
+				arm.Pats = append(arm.Pats, lowerPattern(part))
+			default:
+				arm.Exprs = append(arm.Exprs, lowerExpr(part))
+			}
+			is = false
+		}
+	}
+}
+
+// isPattern returns true if the kind is of a pattern.
+func isPattern(kind tonho.NodeKind) bool {
+	switch kind {
+	case tonho.PatternNode, tonho.WildcardPatternNode, tonho.LiteralPatternNode, tonho.BindingPatternNode, tonho.VariantPatternNode:
+		return true
+	}
+	return false
+}
+
+// lowerTypes lowers the given types.
+func lowerTypes(children []tonho.Node) []Type {
+	var types []Type
+	for _, child := range children {
+		types = append(types, lowerType(child))
+	}
+	return types
+}
+
+// lowerType lowers a type.
+func lowerType(node tonho.Node) Type {
+	children := nodes(node)
+	switch node.Kind {
+	case tonho.TypeNameNode:
+		return &NamedType{syntax: syntax{node}, Name: name(node)}
+	case tonho.TypeApplicationNode:
+		if len(children) > 0 {
+			named := &NamedType{syntax: syntax{node}, Name: name(children[0])}
+			named.Args = lowerTypes(children[1:])
+			return named
+		}
+	case tonho.FunctionTypeNode:
+		if len(children) > 0 {
+			last := len(children) - 1
+			return &FunctionType{syntax{node}, lowerTypes(children[:last]), lowerType(children[last])}
+		}
+	case tonho.OptionalTypeNode:
+		if len(children) > 0 {
+			return &OptionalType{syntax{node}, lowerType(children[0])}
+		}
+	case tonho.TupleTypeNode:
+		return &TupleType{syntax{node}, lowerTypes(children)}
+	}
+	return &BadType{syntax{node}}
+}
+
+// lowerPattern lowers a pattern.
+func lowerPattern(node tonho.Node) Pattern {
+	children := nodes(node)
+	switch node.Kind {
+	case tonho.WildcardPatternNode:
+		return &WildcardPattern{syntax{node}}
+	case tonho.BindingPatternNode:
+		return &BindingPattern{syntax{node}, name(node)}
+	case tonho.LiteralPatternNode:
+		all := tokens(node)
+		if len(all) == 0 {
+			break
+		}
+		last := all[len(all)-1]
+		var value Expr = &BasicLit{syntax{node}, last.Kind, last.Text}
+		if len(all) == 2 {
+			value = &UnaryExpr{syntax{node}, all[0].Kind, value}
+		}
+		return &LiteralPattern{syntax{node}, value}
+	case tonho.VariantPatternNode:
+		variant := &VariantPattern{syntax: syntax{node}, Path: path(node)}
+		if _, ok := find(node, tonho.LeftParen); ok {
+			variant.Fields = []Pattern{}
+			for _, child := range children {
+				variant.Fields = append(variant.Fields, lowerPattern(child))
+			}
+		}
+		return variant
+	case tonho.PatternNode:
+		tuple := &TuplePattern{syntax: syntax{node}}
+		for _, child := range children {
+			tuple.Elems = append(tuple.Elems, lowerPattern(child))
+		}
+		return tuple
+	}
+	return &BadPattern{syntax{node}}
+}
@@ -0,0 +1,68 @@
+package tonho_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"tonho"
+)
+
+// benchmarkInput is a generated program of a few megabytes,
+// that repeats the common declarations, statements and
+// literals, so the benchmarks measure the throughput.
+var benchmarkInput = func() string {
+	var input strings.Builder
+	for n := 0; input.Len() < 4<<20; n++ {
+		fmt.Fprintf(&input, `// Point%[1]d is a point of the plane.
+struct Point%[1]d {
+    x: Int,
+    y: Int,
+}
+
+enum Shape%[1]d { Circle, Square }
+
+/* distance%[1]d returns the squared distance
+   between the two points. */
+fun distance%[1]d(a: Point%[1]d, b: Point%[1]d) -> Int {
+    val dx = a.x - b.x
+    val dy = a.y - b.y
+    return dx * dx + dy * dy
+}
+
+fun describe%[1]d(shape: Shape%[1]d, values: List<Int>) -> String {
+    var total = 0x%[1]X + 1_000 + 0b101
+    for (value in values) {
+        if (value %% 2 == 0 && value > 10) {
+            total += value << 2
+        } else {
+            total -= 1.5e3
+        }
+    }
+    val name = when (shape) {
+        Circle -> "circle ${total}"
+        else -> "square"
+    }
+    return values |> sum(name) ?: 'x'
+}
+
+`, n)
+	}
+	return input.String()
+}()
+
+func BenchmarkLex(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkInput)))
+	b.ReportAllocs()
+	for range b.N {
+		tonho.Lex("bench", benchmarkInput)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkInput)))
+	b.ReportAllocs()
+	for range b.N {
+		tonho.Parse("bench", benchmarkInput)
+	}
+}
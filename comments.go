@@ -0,0 +1,276 @@
+package tonho
+
+import (
+	"sort"
+	"strings"
+)
+
+// CommentGroup represents a run of comments, that aren't
+// separated by blank lines, and the token that owns them.
+type CommentGroup struct {
+	Comments []Token
+
+	// Owner is the index of the token that owns the
+	// group, or -1 if the group is floating, like the
+	// comments that are followed by a blank line.
+	Owner int
+
+	// Trailing is true if the group follows its owner
+	// on the same line, like `x = 1 // note`, instead
+	// of preceding it, like a doc comment.
+	Trailing bool
+}
+
+// Comments groups the comments of the given tokens, and
+// associates each group with the token that owns it, in
+// the order of the source code, like go/ast's CommentMap.
+//
+// The comments can be either in the trivia of the tokens,
+// or emitted as Comment tokens, with the EmitTrivia option.
+// A group is owned by the token before it, if it starts
+// on the same line, or by the token after it, if there's
+// no blank line between them.
+func Comments(tokens []Token) []CommentGroup {
+	if len(tokens) == 0 || tokens[len(tokens)-1].Source() == nil {
+		return nil
+	}
+	source := tokens[len(tokens)-1].Source()
+
+	var groups []CommentGroup
+	var group []Token
+	previous := -1
+	flush := func(next int) {
+		if len(group) == 0 {
+			return
+		}
+
+		start, end := group[0].start, group[len(group)-1].end
+		owner, trailing := -1, false
+		switch {
+		case previous >= 0 && !strings.Contains(source.Slice(tokens[previous].end, start), "\n"):
+			owner, trailing = previous, true
+		case tokens[next].Kind != EOF && strings.Count(source.Slice(end, tokens[next].start), "\n") <= 1:
+			owner = next
+		}
+
+		groups = append(groups, CommentGroup{Comments: group, Owner: owner, Trailing: trailing})
+		group = nil
+	}
+
+	for n, token := range tokens {
+		for _, comment := range triviaComments(token) {
+			// A blank line ends the group, and so does a line
+			// break after the comments that trail a token.
+			if len(group) > 0 {
+				newlines := strings.Count(source.Slice(group[len(group)-1].end, comment.start), "\n")
+				trailing := previous >= 0 && !strings.Contains(source.Slice(tokens[previous].end, group[0].start), "\n")
+				if newlines > 1 || newlines > 0 && trailing {
+					flush(n)
+				}
+			}
+			group = append(group, comment)
+		}
+
+		if !token.Kind.IsTrivia() {
+			flush(n)
+			previous = n
+		}
+	}
+	return groups
+}
+
+// triviaComments returns the comments of the given
+// token, that are either the token itself, if it's a
+// Comment token, or the comments in its trivia.
+func triviaComments(token Token) []Token {
+	if token.Kind == Comment {
+		return []Token{token}
+	}
+
+	trivia := triviaOf(token)
+	offset := token.start - len(trivia)
+
+	var comments []Token
+	for position := 0; position < len(trivia); {
+		var end int
+		switch {
+		case strings.HasPrefix(trivia[position:], "//"), strings.HasPrefix(trivia[position:], "#!"):
+			end = strings.IndexByte(trivia[position:], '\n')
+		case strings.HasPrefix(trivia[position:], "/*"):
+			end = strings.Index(trivia[position+2:], "*/")
+			if end >= 0 {
+				end += 4
+			}
+		default:
+			position++
+			continue
+		}
+		if end < 0 {
+			end = len(trivia) - position
+		}
+
+		text := trivia[position : position+end]
+		comments = append(comments, Token{
+			Kind:     Comment,
+			Text:     text,
+			FullText: text,
+			file:     token.file,
+			start:    offset + position,
+			end:      offset + position + end,
+		})
+		position += end
+	}
+	return comments
+}
+
+// Text returns the text of the comments of the group,
+// without the comment markers, like `//` and `/* */`, and
+// the space after them, with a line for each line of the
+// comments, like the text of a doc comment.
+func (g CommentGroup) Text() string {
+	var lines []string
+	for _, comment := range g.Comments {
+		text := comment.Text
+		switch {
+		case strings.HasPrefix(text, "//"), strings.HasPrefix(text, "#!"):
+			text = text[2:]
+		case strings.HasPrefix(text, "/*"):
+			text = strings.TrimSuffix(text[2:], "*/")
+		}
+		for _, line := range strings.Split(text, "\n") {
+			lines = append(lines, strings.TrimPrefix(strings.TrimRight(line, " \t\r"), " "))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CommentMap attaches the comments of a tree to its nodes,
+// so the tools can get the doc comment of a declaration,
+// and the formatter can keep the comments and the blank
+// lines, where the trees only have them in the trivia of
+// their tokens.
+//
+// The groups that trail a token, like `x = 1 // note`, are
+// attached to the nodes that end with it, and the others
+// to the nodes that start with the token after them, even
+// the floating ones, that are followed by a blank line.
+type CommentMap struct {
+	leading  map[int][]CommentGroup
+	trailing map[int][]CommentGroup
+	tokens   []Token
+}
+
+// NewCommentMap groups the comments of the tree, like
+// Comments, and attaches them to its tokens.
+func NewCommentMap(tree Node) CommentMap {
+	m := CommentMap{
+		leading:  make(map[int][]CommentGroup),
+		trailing: make(map[int][]CommentGroup),
+	}
+	for _, token := range leaves(tree, nil) {
+		if token.file != nil {
+			m.tokens = append(m.tokens, token)
+		}
+	}
+
+	for _, group := range Comments(m.tokens) {
+		if group.Trailing {
+			start := m.tokens[group.Owner].start
+			m.trailing[start] = append(m.trailing[start], group)
+			continue
+		}
+		end := group.Comments[len(group.Comments)-1].end
+		next := sort.Search(len(m.tokens), func(i int) bool { return m.tokens[i].start >= end })
+		if next < len(m.tokens) {
+			start := m.tokens[next].start
+			m.leading[start] = append(m.leading[start], group)
+		}
+	}
+	return m
+}
+
+// Leading returns the comment groups before the node, in
+// the order of the source code.
+func (m CommentMap) Leading(node Node) []CommentGroup {
+	if first, ok := edgeToken(node, false); ok {
+		return m.leading[first.start]
+	}
+	return nil
+}
+
+// Trailing returns the comment groups after the node, on
+// the same line as its end.
+func (m CommentMap) Trailing(node Node) []CommentGroup {
+	if last, ok := edgeToken(node, true); ok {
+		return m.trailing[last.start]
+	}
+	return nil
+}
+
+// Doc returns the doc comment of the node, that is the
+// group right before it, without a blank line between
+// them, or nil if there's none, like:
+//
+//	// area returns the area of the shape.
+//	fun area(shape: Shape) -> Decimal { ... }
+func (m CommentMap) Doc(node Node) *CommentGroup {
+	leading := m.Leading(node)
+	if len(leading) == 0 || leading[len(leading)-1].Owner < 0 {
+		return nil
+	}
+	return &leading[len(leading)-1]
+}
+
+// BlankLines returns the number of blank lines before the
+// node and its leading comments, so the formatter keeps
+// the blank lines that separate the statements.
+func (m CommentMap) BlankLines(node Node) int {
+	first, ok := edgeToken(node, false)
+	if !ok {
+		return 0
+	}
+
+	// The blank lines are counted after the comments that
+	// trail the token before, and before the ones of the
+	// node.
+	start, end := first.start-len(triviaOf(first)), first.start
+	if leading := m.leading[first.start]; len(leading) > 0 {
+		end = leading[0].Comments[0].start
+	}
+	index := sort.Search(len(m.tokens), func(i int) bool { return m.tokens[i].start >= first.start })
+	if index > 0 {
+		for _, group := range m.trailing[m.tokens[index-1].start] {
+			start = max(start, group.Comments[len(group.Comments)-1].end)
+		}
+	}
+	if start >= end {
+		return 0
+	}
+
+	newlines := strings.Count(first.file.Slice(start, end), "\n")
+	if index == 0 {
+		// There's no line before the first token.
+		return newlines
+	}
+	return max(newlines-1, 0)
+}
+
+// edgeToken returns the first or the last token of the
+// tree, that was lexed from a file, or false if there's
+// none.
+func edgeToken(tree Tree, last bool) (Token, bool) {
+	switch tree := tree.(type) {
+	case Token:
+		return tree, tree.file != nil
+	case Node:
+		for i := range tree.Children {
+			if last {
+				i = len(tree.Children) - 1 - i
+			}
+			if token, ok := edgeToken(tree.Children[i], last); ok {
+				return token, true
+			}
+		}
+	}
+	return Token{}, false
+}
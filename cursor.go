@@ -0,0 +1,119 @@
+package tonho
+
+// Cursor is a position in a syntax tree, that keeps the
+// path from the root, so it can move to the parent and
+// the siblings of its tree, that the trees don't know.
+type Cursor struct {
+	parent *Cursor
+	tree   Tree
+	index  int
+}
+
+// NewCursor creates a cursor at the root of the tree.
+func NewCursor(root Node) *Cursor {
+	return &Cursor{tree: root}
+}
+
+// Tree gets the tree at the cursor, either a node or a
+// token.
+func (c *Cursor) Tree() Tree {
+	return c.tree
+}
+
+// Index gets the index of the tree in the children of
+// its parent, or 0 for the root.
+func (c *Cursor) Index() int {
+	return c.index
+}
+
+// Parent returns the cursor at the parent of the tree, or
+// nil for the root.
+func (c *Cursor) Parent() *Cursor {
+	return c.parent
+}
+
+// Child returns the cursor at the child with the given
+// index, or nil if there's no such child.
+func (c *Cursor) Child(index int) *Cursor {
+	node, ok := c.tree.(Node)
+	if !ok || index < 0 || index >= len(node.Children) {
+		return nil
+	}
+	return &Cursor{parent: c, tree: node.Children[index], index: index}
+}
+
+// ChildAt returns the cursor at the child which text, from
+// the start of its first token to the end of its last one,
+// contains the given offset, or nil if there's none, like
+// when the offset is in the trivia between the children.
+func (c *Cursor) ChildAt(offset int) *Cursor {
+	node, ok := c.tree.(Node)
+	if !ok {
+		return nil
+	}
+	for i, child := range node.Children {
+		start, end, ok := bounds(child)
+		if ok && start <= offset && offset < end {
+			return c.Child(i)
+		}
+	}
+	return nil
+}
+
+// NextSibling returns the cursor at the child after the
+// tree in its parent, or nil if it's the last one.
+func (c *Cursor) NextSibling() *Cursor {
+	if c.parent == nil {
+		return nil
+	}
+	return c.parent.Child(c.index + 1)
+}
+
+// PrevSibling returns the cursor at the child before the
+// tree in its parent, or nil if it's the first one.
+func (c *Cursor) PrevSibling() *Cursor {
+	if c.parent == nil {
+		return nil
+	}
+	return c.parent.Child(c.index - 1)
+}
+
+// Enclosing returns the cursor at the closest ancestor of
+// the tree, that is a node of one of the given kinds, like
+// the function that encloses a return, or nil if there's
+// none.
+func (c *Cursor) Enclosing(kinds ...NodeKind) *Cursor {
+	for parent := c.parent; parent != nil; parent = parent.parent {
+		node := parent.tree.(Node)
+		for _, kind := range kinds {
+			if node.Kind == kind {
+				return parent
+			}
+		}
+	}
+	return nil
+}
+
+// CursorAt returns the cursor at the innermost tree of the
+// root, usually a token, that contains the given offset, or
+// the cursor at the root if none of its children does.
+func CursorAt(root Node, offset int) *Cursor {
+	cursor := NewCursor(root)
+	for {
+		child := cursor.ChildAt(offset)
+		if child == nil {
+			return cursor
+		}
+		cursor = child
+	}
+}
+
+// bounds returns the start and the end of the tree, or
+// false if it has no location.
+func bounds(tree Tree) (start, end int, ok bool) {
+	location := tree.Location()
+	if location == nil {
+		return 0, 0, false
+	}
+	return location.Start(), location.End(), true
+}
@@ -0,0 +1,103 @@
+package tonho
+
+// DesugarPipeline desugars the pipeline expression `lhs |> rhs`
+// into a call, inserting the lhs as the first argument of the
+// rhs, like `x |> f(y)` into `f(x, y)`.
+//
+// If the rhs isn't a call, it's called with the lhs as the only
+// argument, like `x |> f` into `f(x)`. The pipeline is left
+// associative, so `x |> f |> g` is desugared into `g(f(x))`.
+// The calls with only a trailing lambda get the parentheses,
+// like `xs |> each { it }` into `each(xs) { it }`.
+func DesugarPipeline(lhs, rhs Tree) Node {
+	call, ok := rhs.(Node)
+	if !ok || call.Kind != CallNode || len(call.Children) < 2 {
+		return NewNode(CallNode, []Tree{
+			rhs,
+			NewToken(LeftParen, "(", "("),
+			lhs,
+			NewToken(RightParen, ")", ")"),
+		})
+	}
+	if paren, ok := call.Children[1].(Token); !ok || paren.Kind != LeftParen {
+		children := []Tree{call.Children[0], NewToken(LeftParen, "(", "("), lhs, NewToken(RightParen, ")", ")")}
+		return NewNode(CallNode, append(children, call.Children[1:]...))
+	}
+
+	// The call children are the callee, the opening paren,
+	// the arguments separated by commas, the closing paren,
+	// and the trailing lambda, so the lhs goes right after
+	// the opening paren, with a comma if there are arguments.
+	children := make([]Tree, 0, len(call.Children)+2)
+	children = append(children, call.Children[:2]...)
+	children = append(children, lhs)
+	if paren, ok := call.Children[2].(Token); !ok || paren.Kind != RightParen {
+		children = append(children, NewToken(Comma, ",", ","))
+	}
+	children = append(children, call.Children[2:]...)
+
+	return NewNode(CallNode, children)
+}
+
+// DesugarPipelines returns the tree with all of its
+// pipelines desugared into calls by DesugarPipeline, from
+// the innermost ones, so the calls keep the locations of
+// the pipelines.
+func DesugarPipelines(tree Node) Node {
+	return Rewrite(tree, func(node Node) (Node, bool) {
+		if node.Kind != ExprNode || len(node.Children) != 3 {
+			return node, false
+		}
+		if operator, ok := node.Children[1].(Token); !ok || operator.Kind != Pipeline {
+			return node, false
+		}
+		return DesugarPipeline(node.Children[0], node.Children[2]).WithLocation(node.Location()), true
+	})
+}
+
+// DesugarAssignment desugars the compound assignment, like
+// `x += 1`, into a plain assignment of the binary expression,
+// like `x = x + 1`, so the backends only handle the plain
+// assignments. The other nodes are returned as they are.
+//
+// The target is shared by both sides, so it's evaluated
+// twice, like `a[f()] += 1` into `a[f()] = a[f()] + 1`.
+func DesugarAssignment(assign Node) Node {
+	if assign.Kind != AssignNode || len(assign.Children) != 3 {
+		return assign
+	}
+	token, ok := assign.Children[1].(Token)
+	if !ok {
+		return assign
+	}
+	operator, ok := CompoundOperator(token.Kind)
+	if !ok {
+		return assign
+	}
+
+	// The `=` keeps the trivia of the compound operator, so
+	// the assignment is printed in the same place.
+	// The value is grouped, so the text of the tree keeps
+	// its precedence, like `x *= a + b` into `x = x * (a + b)`.
+	target, value := assign.Children[0], assign.Children[2]
+	if node, ok := value.(Node); ok && node.Kind == ExprNode {
+		value = NewNode(ExprNode, []Tree{NewToken(LeftParen, "(", " ("), value, NewToken(RightParen, ")", ")")})
+	}
+	return NewNode(AssignNode, []Tree{
+		target,
+		NewToken(Assign, "=", triviaOf(token)+"="),
+		NewNode(ExprNode, []Tree{
+			target,
+			NewToken(operator, operator.String(), " "+operator.String()),
+			value,
+		}),
+	}).WithLocation(assign.Location())
+}
+
+// DesugarAssignments returns the tree with all of its
+// compound assignments desugared by DesugarAssignment.
+func DesugarAssignments(tree Node) Node {
+	return Rewrite(tree, func(node Node) (Node, bool) {
+		return DesugarAssignment(node), node.Kind == AssignNode
+	})
+}
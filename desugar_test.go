@@ -0,0 +1,39 @@
+package tonho_test
+
+import (
+	"strings"
+	"testing"
+
+	"tonho"
+)
+
+func TestDesugarPipelines(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		// The desugared calls keep the trivia of the
+		// pipelines, and the new tokens have none.
+		{"xs |> f", "f(xs)"},
+		{"xs |> f()", "f(xs)"},
+		{"xs |> f(y)", "f(xs,y)"},
+		{"xs |> f(y, z)", "f(xs,y, z)"},
+		{"xs |> f |> g(y)", "g( f(xs),y)"},
+
+		// The trailing lambda isn't an argument, so it
+		// doesn't need a comma after the lhs.
+		{"xs |> each { it }", "each(xs) { it }"},
+		{"xs |> each() { it }", "each(xs) { it }"},
+		{"xs |> fold(0) { a, b -> a + b }", "fold(xs,0) { a, b -> a + b }"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			tree, diagnostics := tonho.Parse("test", test.input)
+			if len(diagnostics) > 0 {
+				t.Fatalf("parsing %q: %v", test.input, diagnostics)
+			}
+			if got := strings.TrimSpace(tonho.Print(tonho.DesugarPipelines(tree))); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
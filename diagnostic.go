@@ -1,12 +1,81 @@
 package tonho
 
+import "slices"
+
 // Diagnostic is an interface that represents a diagnostic message.
 //
 // It is used to report errors, warnings, and other messages.
 type Diagnostic interface {
 	Kind() int
+	Severity() Severity
+
+	// Code gets the stable code of the diagnostic, like
+	// `T0002`, that is explained by Explain.
+	Code() string
+
 	Error() []ErrorText
+
+	// Location gets the primary location of the diagnostic,
+	// where the mistake is.
 	Location() Location
+
+	// Labels gets the labeled locations of the diagnostic,
+	// like the declaration of the type that a mismatch is
+	// against, that are rendered with the primary one.
+	Labels() []Label
+}
+
+// Label is a location of a diagnostic, with a message
+// about it, like `type declared here`.
+type Label struct {
+	Location Location
+	Text     []ErrorText
+
+	// Primary is true if the label is at the primary
+	// location, or another one that is as important, so
+	// it's marked like the primary one.
+	Primary bool
+}
+
+// NewLabel creates a secondary label at the location, with
+// the given message parts.
+func NewLabel(location Location, text ...ErrorText) Label {
+	return Label{Location: location, Text: text}
+}
+
+// NewPrimaryLabel creates a primary label at the location,
+// like the one that explains the primary location of its
+// diagnostic, with the given message parts.
+func NewPrimaryLabel(location Location, text ...ErrorText) Label {
+	return Label{Location: location, Text: text, Primary: true}
+}
+
+// WithLabels returns the diagnostic with the given labels,
+// after the ones it has, like:
+//
+//	tonho.WithLabels(diagnostic,
+//		tonho.NewPrimaryLabel(value.Location(), tonho.NewText("mismatch happens here")),
+//		tonho.NewLabel(declaration.Location(), tonho.NewText("type declared here")),
+//	)
+func WithLabels(d Diagnostic, labels ...Label) Diagnostic {
+	labels = append(slices.Clip(d.Labels()), labels...)
+	if d, ok := d.(diagnostic); ok {
+		d.labels = labels
+		return d
+	}
+	return labeledDiagnostic{d, labels}
+}
+
+// labeledDiagnostic adds the labels to another
+// implementation of the Diagnostic interface.
+type labeledDiagnostic struct {
+	Diagnostic
+	labels []Label
+}
+
+// Labels returns the labels of the diagnostic.
+func (d labeledDiagnostic) Labels() []Label {
+	return d.labels
 }
 
 // ErrorText is a struct that represents a diagnostic message.
@@ -32,6 +101,44 @@ const (
 	CompilerError
 )
 
+// Severity is the severity of a diagnostic, so the lints
+// and the notices are reported like the errors, but only
+// the errors fail the compilation.
+type Severity int
+
+const (
+	ErrorSeverity Severity = iota
+	WarningSeverity
+	InfoSeverity
+	HintSeverity
+)
+
+// String returns the name of the severity, like `warning`.
+func (s Severity) String() string {
+	switch s {
+	case ErrorSeverity:
+		return "error"
+	case WarningSeverity:
+		return "warning"
+	case InfoSeverity:
+		return "info"
+	case HintSeverity:
+		return "hint"
+	}
+	return "unknown"
+}
+
+// HasErrors returns true if any of the diagnostics is an
+// error, and not a warning or a notice.
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Severity() == ErrorSeverity {
+			return true
+		}
+	}
+	return false
+}
+
 // NewText creates a new diagnostic message with the given text
 // and returns it
 func NewText(text string) ErrorText {
@@ -61,3 +168,52 @@ func (e ErrorText) String() string {
 	}
 	panic("Unknown ErrorText kind")
 }
+
+// diagnostic is the default implementation of the Diagnostic
+// interface, used by the compiler phases to report messages.
+type diagnostic struct {
+	kind     int
+	severity Severity
+	code     string
+	text     []ErrorText
+	location Location
+	labels   []Label
+}
+
+// NewDiagnostic creates a new diagnostic of the given kind,
+// severity and code, at the given location, with the given
+// message parts.
+func NewDiagnostic(kind int, severity Severity, code string, location Location, text ...ErrorText) Diagnostic {
+	return diagnostic{kind: kind, severity: severity, code: code, text: text, location: location}
+}
+
+// Kind returns the kind of the diagnostic, like LexerError.
+func (d diagnostic) Kind() int {
+	return d.kind
+}
+
+// Severity returns the severity of the diagnostic, like
+// WarningSeverity.
+func (d diagnostic) Severity() Severity {
+	return d.severity
+}
+
+// Code returns the code of the diagnostic, like `T0002`.
+func (d diagnostic) Code() string {
+	return d.code
+}
+
+// Error returns the message parts of the diagnostic.
+func (d diagnostic) Error() []ErrorText {
+	return d.text
+}
+
+// Location returns the location of the diagnostic.
+func (d diagnostic) Location() Location {
+	return d.location
+}
+
+// Labels returns the labels of the diagnostic.
+func (d diagnostic) Labels() []Label {
+	return d.labels
+}
@@ -0,0 +1,221 @@
+package tonho
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+)
+
+// TreeEditKind is the kind of a tree edit.
+type TreeEditKind int
+
+// The kinds of the tree edits.
+const (
+	// InsertEdit inserts the new tree.
+	InsertEdit TreeEditKind = iota
+
+	// DeleteEdit deletes the old tree.
+	DeleteEdit
+
+	// ReplaceEdit replaces the old tree with the new one,
+	// like a token with another text, or a node with a
+	// node of another kind.
+	ReplaceEdit
+)
+
+// String returns the name of the edit kind.
+func (k TreeEditKind) String() string {
+	switch k {
+	case InsertEdit:
+		return "insert"
+	case DeleteEdit:
+		return "delete"
+	case ReplaceEdit:
+		return "replace"
+	}
+	return fmt.Sprintf("TreeEditKind(%d)", int(k))
+}
+
+// TreeEdit is an edit that turns a part of the old tree
+// into the new one. The paths are the indices of the
+// children from the roots, where the old path of an insert
+// is the index in the old children that the tree goes
+// before, and the new path of a delete is the index in the
+// new children that the tree would be at.
+type TreeEdit struct {
+	Kind    TreeEditKind
+	OldPath []int
+	NewPath []int
+	Old     Tree // nil for inserts
+	New     Tree // nil for deletes
+}
+
+// Diff returns the edits that turn the old tree into the
+// new one, in the order of the old tree, or nil if they
+// are equal. The trees are compared by their structure,
+// the kinds of the nodes and the tokens and the texts of
+// the tokens, so changes of the trivia and of the spans
+// aren't edits.
+//
+// The children of the nodes of the same kind are aligned
+// by their longest common subsequence, so the unchanged
+// children aren't edits, and the children that don't align
+// are deleted and inserted, or diffed if they are nodes of
+// the same kind, at the same place of their parents.
+func Diff(old, new Tree) []TreeEdit {
+	var d differ
+	d.diff(old, new, nil, nil)
+	return d.edits
+}
+
+// differ collects the edits of a diff.
+type differ struct {
+	edits []TreeEdit
+}
+
+// diff appends the edits from the old tree to the new one,
+// at the given paths.
+func (d *differ) diff(old, new Tree, oldPath, newPath []int) {
+	oldNode, oldOk := old.(Node)
+	newNode, newOk := new.(Node)
+	if !oldOk || !newOk || oldNode.Kind != newNode.Kind {
+		if !equalTrees(old, new) {
+			d.add(ReplaceEdit, oldPath, newPath, old, new)
+		}
+		return
+	}
+
+	oldDigests, newDigests := digests(oldNode.Children), digests(newNode.Children)
+	pairs := commonChildren(oldNode.Children, newNode.Children, oldDigests, newDigests)
+	i, j := 0, 0
+	for _, pair := range append(pairs, [2]int{len(oldNode.Children), len(newNode.Children)}) {
+		// The children between the aligned ones are diffed in
+		// place while they are nodes of the same kind, and
+		// the rest of them are deleted or inserted.
+		for i < pair[0] && j < pair[1] && sameKind(oldNode.Children[i], newNode.Children[j]) {
+			d.diff(oldNode.Children[i], newNode.Children[j], appendPath(oldPath, i), appendPath(newPath, j))
+			i, j = i+1, j+1
+		}
+		for ; i < pair[0]; i++ {
+			d.add(DeleteEdit, appendPath(oldPath, i), appendPath(newPath, j), oldNode.Children[i], nil)
+		}
+		for ; j < pair[1]; j++ {
+			d.add(InsertEdit, appendPath(oldPath, i), appendPath(newPath, j), nil, newNode.Children[j])
+		}
+		i, j = i+1, j+1
+	}
+}
+
+// add appends an edit.
+func (d *differ) add(kind TreeEditKind, oldPath, newPath []int, old, new Tree) {
+	d.edits = append(d.edits, TreeEdit{Kind: kind, OldPath: oldPath, NewPath: newPath, Old: old, New: new})
+}
+
+// appendPath returns a copy of the path with the index
+// appended, so the paths of the edits don't share their
+// arrays.
+func appendPath(path []int, index int) []int {
+	return append(path[:len(path):len(path)], index)
+}
+
+// sameKind returns true if both trees are nodes of the
+// same kind, or tokens of the same kind.
+func sameKind(old, new Tree) bool {
+	switch old := old.(type) {
+	case Node:
+		new, ok := new.(Node)
+		return ok && old.Kind == new.Kind
+	case Token:
+		new, ok := new.(Token)
+		return ok && old.Kind == new.Kind
+	}
+	return false
+}
+
+// commonChildren returns the pairs of the indices of the
+// old and the new children, that are in their longest
+// common subsequence of equal trees.
+func commonChildren(old, new []Tree, oldDigests, newDigests []uint64) [][2]int {
+	equal := func(i, j int) bool {
+		return oldDigests[i] == newDigests[j] && equalTrees(old[i], new[j])
+	}
+
+	// lengths[i][j] is the length of the longest common
+	// subsequence of old[i:] and new[j:].
+	lengths := make([][]int, len(old)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(new)+1)
+	}
+	for i := len(old) - 1; i >= 0; i-- {
+		for j := len(new) - 1; j >= 0; j-- {
+			if equal(i, j) {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else {
+				lengths[i][j] = max(lengths[i+1][j], lengths[i][j+1])
+			}
+		}
+	}
+
+	var pairs [][2]int
+	for i, j := 0, 0; i < len(old) && j < len(new); {
+		switch {
+		case equal(i, j):
+			pairs = append(pairs, [2]int{i, j})
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return pairs
+}
+
+// digests returns the digests of the trees, that are
+// equal for the equal trees.
+func digests(trees []Tree) []uint64 {
+	result := make([]uint64, len(trees))
+	for i, tree := range trees {
+		hash := fnv.New64a()
+		writeDigest(hash, tree)
+		result[i] = hash.Sum64()
+	}
+	return result
+}
+
+// writeDigest writes the structure of the tree to the
+// hash, that is the kinds and the texts of the tokens.
+func writeDigest(w io.Writer, tree Tree) {
+	switch tree := tree.(type) {
+	case Token:
+		fmt.Fprintf(w, "%d%q", int(tree.Kind), tree.Text)
+	case Node:
+		fmt.Fprintf(w, "(%d", tree.Kind)
+		for _, child := range tree.Children {
+			writeDigest(w, child)
+		}
+		io.WriteString(w, ")")
+	}
+}
+
+// equalTrees returns true if the trees have the same
+// structure, ignoring the trivia and the spans.
+func equalTrees(old, new Tree) bool {
+	switch old := old.(type) {
+	case Token:
+		new, ok := new.(Token)
+		return ok && old.Kind == new.Kind && old.Text == new.Text
+	case Node:
+		new, ok := new.(Node)
+		if !ok || old.Kind != new.Kind || len(old.Children) != len(new.Children) {
+			return false
+		}
+		for i := range old.Children {
+			if !equalTrees(old.Children[i], new.Children[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return old == nil && new == nil
+}
@@ -0,0 +1,70 @@
+package tonho
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// dotExcerpt is the number of runes of the text of a node
+// that are shown in its DOT label.
+const dotExcerpt = 24
+
+// WriteDOT writes the tree to the writer as a Graphviz
+// graph, where the nodes are boxes with the name of their
+// kind and an excerpt of their text, and the tokens are
+// ellipses with their kind and text, so it can be rendered
+// with `dot -Tsvg`.
+func WriteDOT(w io.Writer, tree Tree) error {
+	out := bufio.NewWriter(w)
+	out.WriteString("digraph tree {\n")
+	out.WriteString("  ordering=out;\n")
+	out.WriteString("  node [fontname=\"monospace\"];\n")
+	id := 0
+	writeDOT(out, tree, &id)
+	out.WriteString("}\n")
+	return out.Flush()
+}
+
+// writeDOT writes the tree and the edges to its children,
+// and returns the id of its graph node.
+func writeDOT(out *bufio.Writer, tree Tree, id *int) int {
+	self := *id
+	*id++
+	switch tree := tree.(type) {
+	case Token:
+		label := tree.Kind.String()
+		if label != tree.Text {
+			label += "\n" + tree.Text
+		}
+		fmt.Fprintf(out, "  n%d [shape=ellipse, label=\"%s\"];\n", self, dotEscape(label))
+	case Node:
+		label := tree.Kind.String()
+		if excerpt := dotExcerptOf(tree); excerpt != "" {
+			label += "\n" + excerpt
+		}
+		fmt.Fprintf(out, "  n%d [shape=box, label=\"%s\"];\n", self, dotEscape(label))
+		for _, child := range tree.Children {
+			fmt.Fprintf(out, "  n%d -> n%d;\n", self, writeDOT(out, child, id))
+		}
+	}
+	return self
+}
+
+// dotExcerptOf returns the text of the node, without its
+// leading trivia and with the whitespaces collapsed, cut
+// to the dotExcerpt runes.
+func dotExcerptOf(node Node) string {
+	excerpt := []rune(strings.Join(strings.Fields(attribute(node, "text")), " "))
+	if len(excerpt) > dotExcerpt {
+		return string(excerpt[:dotExcerpt-1]) + "…"
+	}
+	return string(excerpt)
+}
+
+// dotEscape escapes the label for a quoted DOT string,
+// where the newlines are the centered line breaks.
+func dotEscape(label string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "", "\t", " ").Replace(label)
+}
@@ -0,0 +1,171 @@
+package tonho
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Format represents the format that the tokens
+// are dumped in.
+type Format int
+
+// The formats of the dump.
+const (
+	// TextFormat dumps a token per line, aligned
+	// for reading, like `1:5-1:6 Identifier "x"`.
+	TextFormat Format = iota
+
+	// TSVFormat dumps a token per line, with tab
+	// separated fields and a header line, so the
+	// dump can be diffed and read by other tools.
+	TSVFormat
+
+	// JSONFormat dumps the tokens as a JSON array.
+	JSONFormat
+)
+
+// DumpTokens writes the tokens to the writer in the given
+// format, with their kind names, spans, texts and the trivia
+// that precedes them, which is useful for debugging grammars
+// and comparing the output of the lexer.
+func DumpTokens(w io.Writer, tokens []Token, format Format) error {
+	switch format {
+	case TextFormat:
+		return dumpText(w, tokens)
+	case TSVFormat:
+		return dumpTSV(w, tokens)
+	case JSONFormat:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(tokens)
+	}
+	return fmt.Errorf("unknown dump format %d", int(format))
+}
+
+// dumpText writes the tokens in the text format.
+func dumpText(w io.Writer, tokens []Token) error {
+	out := bufio.NewWriter(w)
+	for _, token := range tokens {
+		fmt.Fprintf(out, "%-12s %-12s %s", spanOf(token), token.Kind, strconv.Quote(token.Text))
+		if trivia := triviaOf(token); trivia != "" {
+			fmt.Fprintf(out, " trivia %s", strconv.Quote(trivia))
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+// dumpTSV writes the tokens in the TSV format. The
+// texts are quoted, so they have no tabs or newlines.
+func dumpTSV(w io.Writer, tokens []Token) error {
+	out := bufio.NewWriter(w)
+	out.WriteString("kind\tstart\tend\tline\tcolumn\ttext\ttrivia\n")
+	for _, token := range tokens {
+		start, end, line, column := -1, -1, 0, 0
+		if location := token.Location(); location != nil {
+			start, end = location.Start(), location.End()
+			line, column = location.Line(), location.Column()
+		}
+
+		fmt.Fprintf(out, "%s\t%d\t%d\t%d\t%d\t%s\t%s\n",
+			token.Kind, start, end, line, column,
+			strconv.Quote(token.Text), strconv.Quote(triviaOf(token)))
+	}
+	return out.Flush()
+}
+
+// spanOf returns the span of the token, from the
+// line and column of its start to the ones of its
+// end, or `?` if the token has no location.
+func spanOf(token Token) string {
+	location := token.Location()
+	if location == nil {
+		return "?"
+	}
+
+	line, column := location.Line(), location.Column()
+	raw := token.FullText[len(triviaOf(token)):]
+	endLine := line + strings.Count(raw, "\n")
+	endColumn := column + len([]rune(raw))
+	if index := strings.LastIndexByte(raw, '\n'); index >= 0 {
+		endColumn = len([]rune(raw[index+1:])) + 1
+	}
+	return fmt.Sprintf("%d:%d-%d:%d", line, column, endLine, endColumn)
+}
+
+// triviaOf returns the trivia that precedes the token,
+// like spaces and comments.
+func triviaOf(token Token) string {
+	if location := token.Location(); location != nil {
+		width := location.End() - location.Start()
+		if width <= len(token.FullText) {
+			return token.FullText[:len(token.FullText)-width]
+		}
+	}
+	return strings.TrimSuffix(token.FullText, token.Text)
+}
+
+// Dump returns the node as an indented s-expression, with
+// the names and the spans of the nodes, and the kinds, the
+// spans and the texts of the tokens, where the keywords and
+// the punctuation are only quoted, like:
+//
+//	(ReturnNode 1:1-1:9
+//	  "return" 1:1-1:7
+//	  (IdentifierNode 1:8-1:9
+//	    Identifier 1:8-1:9 "x"))
+//
+// The trivia is left out, so the dumps of the parses of
+// the same code, formatted differently, only differ in the
+// spans, which is useful for the golden files of tests.
+func (n Node) Dump() string {
+	var dump strings.Builder
+	dumpTree(&dump, n, 0)
+	return dump.String()
+}
+
+// dumpTree writes the tree to the dump, indented by the
+// depth.
+func dumpTree(dump *strings.Builder, tree Tree, depth int) {
+	dump.WriteString(strings.Repeat("  ", depth))
+	switch tree := tree.(type) {
+	case Token:
+		if tree.Kind.String() == tree.Text {
+			fmt.Fprintf(dump, "%s %s", strconv.Quote(tree.Text), spanOf(tree))
+			break
+		}
+		fmt.Fprintf(dump, "%s %s %s", tree.Kind, spanOf(tree), strconv.Quote(tree.Text))
+	case Node:
+		fmt.Fprintf(dump, "(%s %s", tree.Kind, nodeSpanOf(tree))
+		for _, child := range tree.Children {
+			dump.WriteByte('\n')
+			dumpTree(dump, child, depth+1)
+		}
+		dump.WriteByte(')')
+	}
+}
+
+// nodeSpanOf returns the span of the node, from the start
+// of its first token to the end of its last one, or `?` if
+// it has no tokens with a location.
+func nodeSpanOf(node Node) string {
+	var first, last string
+	for _, token := range leaves(node, nil) {
+		if token.Location() == nil {
+			continue
+		}
+		span := spanOf(token)
+		if first == "" {
+			first = span
+		}
+		last = span
+	}
+	if first == "" {
+		return "?"
+	}
+	return first[:strings.IndexByte(first, '-')] + last[strings.IndexByte(last, '-'):]
+}
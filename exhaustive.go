@@ -0,0 +1,223 @@
+package tonho
+
+// CheckWhens reports the whens of the tree that are used
+// as values, like the value of a declaration, but don't
+// cover every value of their subject, so they have no value
+// for some of them.
+//
+// A when is exhaustive if it has an else arm, an arm with
+// a pattern that matches any value, like `_` or `(a, _)`,
+// or arms for `true` and `false`, or for every variant of
+// an enum of the tree. The guarded arms, like
+// `Circle if r > 0 -> ...`, are never counted, as their
+// guards can be false, and the types of the `is` arms
+// aren't known yet, so they're never counted either.
+//
+// The whens used as statements don't need to be
+// exhaustive. It's not run by Parse, as the enums can be
+// declared in other files, so it's run on the trees that
+// have all of them.
+func CheckWhens(tree Node) []Diagnostic {
+	c := &whenChecker{enums: make(map[string][]string)}
+	Inspect(tree, func(tree Tree) bool {
+		if node, ok := tree.(Node); ok && node.Kind == EnumNode {
+			name, _ := firstToken(node, Identifier)
+			for _, child := range node.Children {
+				if variant, ok := child.(Node); ok && variant.Kind == VariantNode {
+					token, _ := firstToken(variant, Identifier)
+					c.enums[name.Text] = append(c.enums[name.Text], token.Text)
+				}
+			}
+		}
+		return true
+	})
+	c.visit(tree, false)
+	return c.diagnostics
+}
+
+// whenChecker holds the variants of the enums of a tree,
+// by the name of the enum, and the reported diagnostics.
+type whenChecker struct {
+	enums       map[string][]string
+	diagnostics []Diagnostic
+}
+
+// visit checks the whens of the node, where value is true
+// if the value of the node is used.
+func (c *whenChecker) visit(node Node, value bool) {
+	if node.Kind == WhenNode && value {
+		c.check(node)
+	}
+
+	arrow, condition := false, true
+	for _, child := range node.Children {
+		switch child := child.(type) {
+		case Token:
+			arrow = arrow || child.Kind == Arrow
+		case Node:
+			switch node.Kind {
+			case FileNode, BlockNode, LambdaNode:
+				// The statements of a block, where the
+				// last one can be the value of the block,
+				// are taken as statements.
+				c.visit(child, false)
+			case WhenNode:
+				c.visit(child, value || child.Kind != WhenArmNode)
+			case WhenArmNode:
+				c.visit(child, value || !arrow)
+			case IfNode:
+				c.visit(child, value || condition)
+				condition = false
+			case ElseNode:
+				c.visit(child, value)
+			default:
+				c.visit(child, true)
+			}
+		}
+	}
+}
+
+// check reports the given when if it's not exhaustive,
+// with labels on its guarded arms.
+func (c *whenChecker) check(when Node) {
+	var guards []Label
+	covered := make(map[string]bool)
+	for _, child := range when.Children {
+		arm, ok := child.(Node)
+		if !ok || arm.Kind != WhenArmNode {
+			continue
+		}
+		if guard, ok := childNode(arm, GuardNode); ok {
+			guards = append(guards, NewLabel(guard.Location(), NewText("this arm has a guard, so it isn't counted")))
+			continue
+		}
+		if _, ok := firstToken(arm, Else); ok {
+			return
+		}
+
+		is := false
+		for _, child := range arm.Children {
+			switch condition := child.(type) {
+			case Token:
+				is = condition.Kind == Is
+			case Node:
+				if condition.Kind == GuardNode {
+					break
+				}
+				if !is {
+					if irrefutable(condition) {
+						return
+					}
+					if name, ok := coveredName(condition); ok {
+						covered[name] = true
+					}
+				}
+				is = false
+			}
+		}
+	}
+
+	if covered["true"] && covered["false"] || !hasSubject(when) && covered["true"] {
+		return
+	}
+	for _, variants := range c.enums {
+		if len(variants) > 0 && allCovered(variants, covered) {
+			return
+		}
+	}
+
+	keyword, _ := firstToken(when, When)
+	diagnostic := NewDiagnostic(ParserError, ErrorSeverity, nonExhaustiveCode, keyword.Location(),
+		NewText("the"), NewCode("when"), NewText("isn't exhaustive, as it's used as a value, add an"), NewCode("else"), NewText("arm"))
+	c.diagnostics = append(c.diagnostics, WithLabels(diagnostic, guards...))
+}
+
+// hasSubject returns true if the when has a subject, like
+// `when (x) { ... }`.
+func hasSubject(when Node) bool {
+	_, ok := firstToken(when, LeftParen)
+	return ok
+}
+
+// allCovered returns true if all the variants are covered.
+func allCovered(variants []string, covered map[string]bool) bool {
+	for _, variant := range variants {
+		if !covered[variant] {
+			return false
+		}
+	}
+	return true
+}
+
+// coveredName returns the name of the variant or the bool
+// that the condition covers entirely, like `Circle`,
+// `Shape.Circle`, `Circle(_)` or `true`.
+func coveredName(condition Node) (string, bool) {
+	switch condition.Kind {
+	case IdentifierNode, BoolNode, LiteralPatternNode:
+		token, ok := firstToken(condition, Identifier)
+		return token.Text, ok
+	case MemberNode:
+		token, ok := lastToken(condition, Identifier)
+		return token.Text, ok
+	case VariantPatternNode:
+		for _, child := range condition.Children {
+			if pattern, ok := child.(Node); ok && !irrefutable(pattern) {
+				return "", false
+			}
+		}
+		token, ok := lastToken(condition, Identifier)
+		return token.Text, ok
+	}
+	return "", false
+}
+
+// irrefutable returns true if the condition is a pattern
+// that matches any value, like `_`, `x` or `(a, _)`.
+func irrefutable(condition Node) bool {
+	switch condition.Kind {
+	case WildcardPatternNode, BindingPatternNode:
+		return true
+	case PatternNode:
+		for _, child := range condition.Children {
+			if pattern, ok := child.(Node); ok && !irrefutable(pattern) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// firstToken returns the first child token of the node
+// with the given kind.
+func firstToken(node Node, kind TokenKind) (Token, bool) {
+	for _, child := range node.Children {
+		if token, ok := child.(Token); ok && token.Kind == kind {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
+
+// lastToken returns the last child token of the node with
+// the given kind.
+func lastToken(node Node, kind TokenKind) (Token, bool) {
+	for i := len(node.Children) - 1; i >= 0; i-- {
+		if token, ok := node.Children[i].(Token); ok && token.Kind == kind {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
+
+// childNode returns the first child node of the node with
+// the given kind.
+func childNode(node Node, kind NodeKind) (Node, bool) {
+	for _, child := range node.Children {
+		if child, ok := child.(Node); ok && child.Kind == kind {
+			return child, true
+		}
+	}
+	return Node{}, false
+}
@@ -0,0 +1,50 @@
+package tonho_test
+
+import (
+	"testing"
+
+	"tonho"
+)
+
+func TestCheckWhens(t *testing.T) {
+	tests := []struct {
+		input      string
+		exhaustive bool
+	}{
+		{"val a = when (x) { 1 -> 2, else -> 3 }", true},
+		{"val a = when (x) { 1 -> 2 }", false},
+		{"val a = when (x) { _ -> 2 }", true},
+		{"val a = when (x) { (a, _) -> 2 }", true},
+		{"val a = when (x) { (a, 1) -> 2 }", false},
+		{"val a = when (b) { true -> 2, false -> 3 }", true},
+		{"val a = when { c -> 2 }", false},
+		{"val a = when (x) { is Int -> 1 }", false},
+		{"when (x) { 1 -> 2 }", true},
+		{"fun f() { return when (x) { 1 -> 2 } }", false},
+		{"val a = if (c) when (x) { 1 -> 2 } else 3", false},
+
+		// The enums of the tree are covered by their
+		// variants, but not by the guarded arms.
+		{"enum Shape { Circle, Square }\nval a = when (s) { Circle -> 1, Shape.Square -> 2 }", true},
+		{"enum Shape { Circle, Square }\nval a = when (s) { Circle -> 1, Square if big -> 2 }", false},
+		{"enum Shape { Circle(Int), Square }\nval a = when (s) { Circle(_) -> 1, Square -> 2 }", true},
+		{"enum Shape { Circle(Int), Square }\nval a = when (s) { Circle(1) -> 1, Square -> 2 }", false},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			tree, diagnostics := tonho.Parse("test", test.input)
+			if len(diagnostics) > 0 {
+				t.Fatalf("parsing: %v", diagnostics)
+			}
+			diagnostics = tonho.CheckWhens(tree)
+			if exhaustive := len(diagnostics) == 0; exhaustive != test.exhaustive {
+				t.Errorf("got exhaustive %v, want %v", exhaustive, test.exhaustive)
+			}
+			for _, diagnostic := range diagnostics {
+				if diagnostic.Code() != "T0111" {
+					t.Errorf("got the code %s, want T0111", diagnostic.Code())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package tonho
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// The codes of the diagnostics, where the ones of the
+// lexer start with `T00`, the ones of the parser with
+// `T01`, and the ones of the limits of the parser with
+// `T09`. The codes are stable, so a code is never reused
+// for another diagnostic.
+const (
+	unexpectedCharacterCode = "T0001"
+	unterminatedCode        = "T0002"
+	invalidEscapeCode       = "T0003"
+	malformedNumberCode     = "T0004"
+	malformedTokenCode      = "T0005"
+	indentationCode         = "T0006"
+	limitCode               = "T0007"
+	encodingCode            = "T0008"
+
+	unexpectedTokenCode  = "T0101"
+	missingSeparatorCode = "T0102"
+	duplicateCode        = "T0103"
+	misplacedCode        = "T0104"
+	invalidParameterCode = "T0105"
+	uninitializedCode    = "T0106"
+	assignmentTargetCode = "T0107"
+	argumentOrderCode    = "T0108"
+	missingElseCode      = "T0109"
+	guardedElseCode      = "T0110"
+	nonExhaustiveCode    = "T0111"
+
+	nestingCode     = "T0901"
+	parserStuckCode = "T0902"
+)
+
+// Explanation is the long-form help of a diagnostic
+// code, like the one shown by `tonho explain T0002`, or
+// by the hovers of an editor.
+type Explanation struct {
+	Code  string
+	Title string
+	Text  string
+
+	// Example is a code that reports the diagnostic, with
+	// a comment on how to fix it.
+	Example string
+}
+
+// String formats the explanation, with the title, the
+// text, and the indented example.
+func (e Explanation) String() string {
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s: %s\n\n%s\n", e.Code, e.Title, e.Text)
+	if e.Example != "" {
+		text.WriteString("\nFor example:\n\n")
+		for _, line := range strings.Split(e.Example, "\n") {
+			fmt.Fprintf(&text, "    %s\n", line)
+		}
+	}
+	return text.String()
+}
+
+// builtinExplanations holds the explanations of the codes
+// of the lexer and the parser.
+var builtinExplanations = []Explanation{
+	{
+		Code:  unexpectedCharacterCode,
+		Title: "unexpected character",
+		Text: "The source code has a character that can't start any token, like a `$` outside of a string, " +
+			"or bytes that aren't valid UTF-8.",
+		Example: "val price = $10 // remove the `$`, or put it in a string",
+	},
+	{
+		Code:  unterminatedCode,
+		Title: "unterminated literal",
+		Text: "A string, a char, a raw string, a heredoc, a block comment, an escaped identifier or an " +
+			"interpolation was opened, but the file ended before its closing delimiter.",
+		Example: "val greeting = \"hello // close the string with a quote",
+	},
+	{
+		Code:  invalidEscapeCode,
+		Title: "invalid escape sequence",
+		Text: "A string or a char has a backslash that isn't followed by a known escape, like `\\n`, `\\t`, " +
+			"`\\\\`, `\\\"` or a unicode escape, like `\\u{1F600}`, with 1 to 6 hexadecimal digits of a " +
+			"scalar value, that isn't a surrogate.",
+		Example: "val path = \"C:\\users\" // escape the backslash, like `\\\\`",
+	},
+	{
+		Code:  malformedNumberCode,
+		Title: "malformed number literal",
+		Text: "A number literal has a digit that isn't valid in its base, a prefix without digits, an " +
+			"unknown suffix, or a digit separator `_` at its start, at its end, or next to another one.",
+		Example: "val mask = 0b102 // a binary literal only has the digits 0 and 1",
+	},
+	{
+		Code:  malformedTokenCode,
+		Title: "malformed token",
+		Text: "A token is incomplete, like an escaped identifier without a name, an annotation without a " +
+			"name after the `@`, or a char literal that doesn't have exactly one character.",
+		Example: "val initial = 'ab' // a char has one character, use a string for more",
+	},
+	{
+		Code:  indentationCode,
+		Title: "inconsistent indentation",
+		Text: "A line of an indentation-sensitive block is dedented to a column that none of the enclosing " +
+			"lines has, so it's unclear which block it belongs to.",
+	},
+	{
+		Code:  limitCode,
+		Title: "limit exceeded",
+		Text: "The input, a token, or the number of tokens is larger than the limit the lexer was configured " +
+			"with, so the rest of the input isn't lexed.",
+	},
+	{
+		Code:  encodingCode,
+		Title: "invalid encoding",
+		Text:  "The source code is encoded in UTF-16, but the compiler only reads UTF-8 files.",
+	},
+	{
+		Code:  unexpectedTokenCode,
+		Title: "unexpected token",
+		Text: "The parser found a token that can't be in this place, like a keyword where an expression " +
+			"is expected, or a missing delimiter, like the `)` of a call.",
+		Example: "val sum = add(1, 2 // close the call with a `)`",
+	},
+	{
+		Code:  missingSeparatorCode,
+		Title: "missing separator",
+		Text: "Two statements, fields, variants or when arms aren't separated, or a list has a comma " +
+			"without an element before it. The statements are separated by newlines or `;`, and the " +
+			"others by newlines or `,`.",
+		Example: "val a = 1 val b = 2 // put the declarations on their own lines, or separate them with `;`",
+	},
+	{
+		Code:  duplicateCode,
+		Title: "duplicate name",
+		Text: "A field, a variant, a parameter, a named argument or a map key is repeated, and the names " +
+			"must be unique in their declaration.",
+		Example: "struct Point { x: Int, x: Int } // rename the second field",
+	},
+	{
+		Code:  misplacedCode,
+		Title: "misplaced statement",
+		Text: "A statement is outside of the construct it needs: a `return` or a `defer` outside of a " +
+			"function, a `return` in a defer block, a `break` or a `continue` outside of a loop, or with " +
+			"a label that no loop around it has. The module declaration must be the first statement of the file.",
+		Example: "fun f() {\n    defer { return } // a defer block can't return\n}",
+	},
+	{
+		Code:  invalidParameterCode,
+		Title: "invalid parameter",
+		Text: "A variadic parameter isn't the last one, or a default value references a parameter that " +
+			"isn't declared before it.",
+		Example: "fun f(xs: ...Int, y: Int) {} // move the variadic parameter to the end",
+	},
+	{
+		Code:  uninitializedCode,
+		Title: "uninitialized declaration",
+		Text: "A val or a destructuring declaration doesn't have a value, or a var has neither a type " +
+			"nor a value to infer it from.",
+		Example: "val answer: Int // add a value, like `= 42`",
+	},
+	{
+		Code:    assignmentTargetCode,
+		Title:   "invalid assignment target",
+		Text:    "The left side of an assignment must be a name, a member, like `a.b`, or an index, like `a[i]`.",
+		Example: "f() = 1 // a call can't be assigned",
+	},
+	{
+		Code:    argumentOrderCode,
+		Title:   "positional argument after a named one",
+		Text:    "The positional arguments of a call must come before the named ones.",
+		Example: "draw(width: 10, 20) // move `20` before `width: 10`",
+	},
+	{
+		Code:  missingElseCode,
+		Title: "missing else branch",
+		Text: "An if is used as an expression, like the value of a declaration, but it doesn't have an " +
+			"else branch, so it has no value when the condition is false.",
+		Example: "val sign = if (x < 0) { -1 } // add an `else { 1 }`",
+	},
+	{
+		Code:    guardedElseCode,
+		Title:   "guard on an else arm",
+		Text:    "The else arm of a when is taken when no other arm is, so it can't have a guard.",
+		Example: "when (x) {\n    1 -> \"one\"\n    else if x > 0 -> \"many\" // make it an arm with a condition\n}",
+	},
+	{
+		Code:  nonExhaustiveCode,
+		Title: "non-exhaustive when",
+		Text: "A when is used as a value, like the value of a declaration, but its arms don't cover every " +
+			"value of its subject, so it has no value for the others. The arms with a guard aren't counted, " +
+			"as the guard can be false.",
+		Example: "enum Shape { Circle, Square }\n\nval name = when (shape) {\n    Circle -> \"circle\"\n    " +
+			"Square if big -> \"big square\" // add an arm for the other squares, or an `else` arm\n}",
+	},
+	{
+		Code:  nestingCode,
+		Title: "nesting too deep",
+		Text: "The code is nested deeper than the parser supports, like thousands of parentheses, so the " +
+			"parser stopped, instead of running out of stack.",
+	},
+	{
+		Code:  parserStuckCode,
+		Title: "parser stuck",
+		Text: "The parser couldn't make progress at a token, and stopped parsing there. This is a bug of " +
+			"the compiler, and the code that triggers it should be reported.",
+	},
+}
+
+// explanationRegistry holds the explanations by code,
+// the builtin ones and the registered ones, guarded by a
+// lock, as the tools can explain the diagnostics of many
+// goroutines.
+var explanationRegistry = func() *explanationsTable {
+	table := &explanationsTable{codes: make(map[string]Explanation)}
+	for _, explanation := range builtinExplanations {
+		table.codes[explanation.Code] = explanation
+	}
+	return table
+}()
+
+// explanationsTable is the table of the explanations.
+type explanationsTable struct {
+	mu    sync.RWMutex
+	codes map[string]Explanation
+}
+
+// codePattern matches the codes, like `T0042`, that are
+// an uppercase letter and four digits.
+var codePattern = regexp.MustCompile(`^[A-Z][0-9]{4}$`)
+
+// Explain returns the explanation of the given code, like
+// `T0002`, or false if there's no such code.
+func Explain(code string) (Explanation, bool) {
+	table := explanationRegistry
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	explanation, ok := table.codes[code]
+	return explanation, ok
+}
+
+// Codes returns the codes that have an explanation, in
+// order.
+func Codes() []string {
+	table := explanationRegistry
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	codes := make([]string, 0, len(table.codes))
+	for code := range table.codes {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
+
+// RegisterExplanation adds the explanation of a code, so
+// the embedders that report their own diagnostics, like
+// the lints, can explain them too. The code must be an
+// uppercase letter and four digits, like `L0001`, that
+// has no explanation yet.
+func RegisterExplanation(explanation Explanation) error {
+	table := explanationRegistry
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	switch {
+	case !codePattern.MatchString(explanation.Code):
+		return fmt.Errorf("the code %q must be an uppercase letter and four digits", explanation.Code)
+	case explanation.Title == "":
+		return fmt.Errorf("the explanation of the code %s has no title", explanation.Code)
+	}
+	if _, ok := table.codes[explanation.Code]; ok {
+		return fmt.Errorf("the code %s is already explained", explanation.Code)
+	}
+	table.codes[explanation.Code] = explanation
+	return nil
+}
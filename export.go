@@ -0,0 +1,117 @@
+package tonho
+
+import (
+	"bufio"
+	"encoding/json"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// htmlStyle is the style sheet of the standalone HTML, with
+// a class for each highlighting category.
+const htmlStyle = `pre.tonho { background: #1e1e2e; color: #cdd6f4; padding: 1em; }
+.tonho-keyword { color: #cba6f7; font-weight: bold; }
+.tonho-operator { color: #89dceb; }
+.tonho-string { color: #a6e3a1; }
+.tonho-number { color: #fab387; }
+.tonho-comment { color: #7f849c; font-style: italic; }
+.tonho-annotation { color: #89b4fa; }
+.tonho-error { text-decoration: wavy underline #f38ba8; }
+`
+
+// HighlightHTML lexes the source code and writes it to the
+// writer as a standalone HTML document, with the tokens in
+// spans with a class for their category, like `tonho-keyword`,
+// so the page can restyle them.
+func HighlightHTML(w io.Writer, title, source string) error {
+	tokens, _ := LexWithOptions(title, source, LexOptions{EmitTrivia: true})
+
+	out := bufio.NewWriter(w)
+	out.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	out.WriteString("<title>" + html.EscapeString(title) + "</title>\n")
+	out.WriteString("<style>\n" + htmlStyle + "</style>\n</head>\n<body>\n<pre class=\"tonho\"><code>")
+	for _, token := range tokens {
+		trivia := triviaOf(token)
+		out.WriteString(html.EscapeString(trivia))
+
+		text := html.EscapeString(token.FullText[len(trivia):])
+		if class := category(token.Kind); class != "" && text != "" {
+			out.WriteString("<span class=\"tonho-" + class + "\">" + text + "</span>")
+		} else {
+			out.WriteString(text)
+		}
+	}
+	out.WriteString("</code></pre>\n</body>\n</html>\n")
+	return out.Flush()
+}
+
+// textMateRule represents a rule of a TextMate grammar,
+// that either matches a single line, or goes from the
+// begin to the end pattern.
+type textMateRule struct {
+	Name     string         `json:"name"`
+	Match    string         `json:"match,omitempty"`
+	Begin    string         `json:"begin,omitempty"`
+	End      string         `json:"end,omitempty"`
+	Patterns []textMateRule `json:"patterns,omitempty"`
+}
+
+// TextMateGrammar writes a TextMate grammar of tonho to the
+// writer, as JSON, that is understood by most editors and
+// highlighters. The keywords and the operators come from
+// the token tables, so the grammar follows the lexer.
+func TextMateGrammar(w io.Writer) error {
+	var keywordNames, operatorNames []string
+	for kind, name := range TokenNames {
+		switch {
+		case kind.IsKeyword() && !kind.IsSoftKeyword():
+			keywordNames = append(keywordNames, regexp.QuoteMeta(name))
+		case kind.IsOperator():
+			operatorNames = append(operatorNames, regexp.QuoteMeta(name))
+		}
+	}
+
+	// The longest operators come first, as the patterns
+	// are tried in order, like the lexer does.
+	sort.Strings(keywordNames)
+	sort.Slice(operatorNames, func(i, j int) bool {
+		if len(operatorNames[i]) != len(operatorNames[j]) {
+			return len(operatorNames[i]) > len(operatorNames[j])
+		}
+		return operatorNames[i] < operatorNames[j]
+	})
+
+	escape := textMateRule{Name: "constant.character.escape.tonho", Match: `\\(?:[ntr0\\'"]|u\{[0-9a-fA-F]*\})`}
+	grammar := struct {
+		Name      string         `json:"name"`
+		ScopeName string         `json:"scopeName"`
+		FileTypes []string       `json:"fileTypes"`
+		Patterns  []textMateRule `json:"patterns"`
+	}{
+		Name:      "tonho",
+		ScopeName: "source.tonho",
+		FileTypes: []string{"tn"},
+		Patterns: []textMateRule{
+			{Name: "comment.line.shebang.tonho", Match: `\A#!.*$`},
+			{Name: "comment.line.double-slash.tonho", Match: `//.*$`},
+			{Name: "comment.block.tonho", Begin: `/\*`, End: `\*/`},
+			{Name: "string.quoted.triple.tonho", Begin: `"""`, End: `"""`},
+			{Name: "string.unquoted.heredoc.tonho", Begin: `<<([A-Za-z][\w']*)\s*$`, End: `^\s*\1\s*$`},
+			{Name: "string.quoted.double.tonho", Begin: `"`, End: `"|$`, Patterns: []textMateRule{escape}},
+			{Name: "string.quoted.single.tonho", Begin: `'`, End: `'|$`, Patterns: []textMateRule{escape}},
+			{Name: "constant.numeric.tonho", Match: `\b(?:0[xX][0-9a-fA-F_]+|0[oO][0-7_]+|0[bB][01_]+|\d[\d_]*(?:\.\d[\d_]*)?(?:[eE][+-]?\d+)?)(?:[iu](?:8|16|32|64)|u|f32|f64)?\b`},
+			{Name: "entity.name.tag.annotation.tonho", Match: `@[\p{L}][\p{L}\p{N}_']*`},
+			{Name: "keyword.control.tonho", Match: `\b(?:` + strings.Join(keywordNames, "|") + `)\b`},
+			{Name: "variable.other.escaped.tonho", Match: "`[^`\\n]*`"},
+			{Name: "keyword.operator.tonho", Match: strings.Join(operatorNames, "|")},
+		},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(grammar)
+}
@@ -0,0 +1,128 @@
+package tonho
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FuzzLex lexes the data with the default options and with
+// the options that emit more tokens, and returns an error if
+// the lexer panics, or breaks one of its guarantees, like the
+// full texts not joining back into the data, or producing an
+// unbounded number of tokens.
+//
+// It's meant to be called by a fuzz test, like:
+//
+//	f.Fuzz(func(t *testing.T, data []byte) {
+//		if err := tonho.FuzzLex(data); err != nil {
+//			t.Fatal(err)
+//		}
+//	})
+func FuzzLex(data []byte) (err error) {
+	defer recoverFuzz(&err)
+
+	input := string(data)
+	for _, options := range []LexOptions{{}, {EmitNewlines: true, EmitTrivia: true, EmitIndents: true}} {
+		tokens, diagnostics := LexWithOptions("fuzz", input, options)
+		if err := checkTokens(input, tokens); err != nil {
+			return fmt.Errorf("with options %+v: %w", options, err)
+		}
+		if len(diagnostics) > len(input)+1 {
+			return fmt.Errorf("%d diagnostics for %d bytes", len(diagnostics), len(input))
+		}
+	}
+	return nil
+}
+
+// FuzzParse parses the data, and returns an error if the
+// parser panics, if the tokens of the tree don't join back
+// into the data, or if VerifyPrint fails. It's meant to be called by a fuzz
+// test, like FuzzLex, seeded with FuzzCorpus.
+func FuzzParse(data []byte) (err error) {
+	defer recoverFuzz(&err)
+
+	input := string(data)
+	ParseExpression(input)
+	ParseStatement(input)
+	tree, _ := Parse("fuzz", input)
+	if err := checkTokens(input, leaves(tree, nil)); err != nil {
+		return fmt.Errorf("in the tree: %w", err)
+	}
+	return VerifyPrint("fuzz", input)
+}
+
+// FuzzCorpus returns the inputs that crashed the parser,
+// or made it too slow, before, so the fuzz tests start
+// from them, like:
+//
+//	for _, data := range tonho.FuzzCorpus() {
+//		f.Add(data)
+//	}
+func FuzzCorpus() [][]byte {
+	corpus := [][]byte{
+		[]byte(""),
+		[]byte("("),
+		[]byte("f<"),
+		[]byte("a >> b"),
+		[]byte("val x: A<B<C>"),
+		[]byte("val (a, "),
+		[]byte("(a, b) ->"),
+		[]byte("{ a, b ->"),
+		[]byte("when (x) { is"),
+		[]byte("#{ a: "),
+		[]byte("\"a ${"),
+		[]byte("\"a ${ b } c ${"),
+		[]byte("@l while (a) { break @"),
+		[]byte("fun f(a: Int) -> "),
+		[]byte("import a.{"),
+		[]byte("if (a) 1 else"),
+
+		// The fuel ran out at the last lookahead, and the
+		// EOF with the comment was lost.
+		[]byte(strings.Repeat("(", 60) + " // c\n"),
+	}
+	for _, nested := range []string{"(", "[", "{", "-", "while (a) {", "if (a) 1 else ", "a ?: ", "\"${", "val x: A<", "val (", "val x: ("} {
+		corpus = append(corpus, []byte(strings.Repeat(nested, 2*maxDepth)))
+	}
+	for _, chain := range []string{"a + ", ".b", "(b)", "a |> "} {
+		corpus = append(corpus, []byte("a"+strings.Repeat(chain, 10*maxDepth)))
+	}
+	return corpus
+}
+
+// checkTokens checks the guarantees of the tokens lexed
+// from the given input.
+func checkTokens(input string, tokens []Token) error {
+	if len(tokens) > 2*len(input)+2 {
+		return fmt.Errorf("%d tokens for %d bytes", len(tokens), len(input))
+	}
+	if len(tokens) == 0 || tokens[len(tokens)-1].Kind != EOF {
+		return fmt.Errorf("the tokens don't end with EOF")
+	}
+
+	var text strings.Builder
+	last := 0
+	for n, token := range tokens {
+		if token.Kind == EOF && n != len(tokens)-1 {
+			return fmt.Errorf("EOF token before the end, at %d", n)
+		}
+		if token.start < last || token.end < token.start || token.end > len(input) {
+			return fmt.Errorf("token %v has an invalid span [%d, %d)", token, token.start, token.end)
+		}
+		last = token.end
+		text.WriteString(token.FullText)
+	}
+
+	if text.String() != input {
+		return fmt.Errorf("the full texts %q don't join back into the input", text.String())
+	}
+	return nil
+}
+
+// recoverFuzz turns a panic into the returned error of
+// a fuzz entry point.
+func recoverFuzz(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("panic: %v", r)
+	}
+}
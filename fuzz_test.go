@@ -0,0 +1,29 @@
+package tonho_test
+
+import (
+	"testing"
+
+	"tonho"
+)
+
+func FuzzLex(f *testing.F) {
+	for _, data := range tonho.FuzzCorpus() {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := tonho.FuzzLex(data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	for _, data := range tonho.FuzzCorpus() {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := tonho.FuzzParse(data); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
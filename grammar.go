@@ -1 +1,1658 @@
 package tonho
+
+import (
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// Binding powers. This defines the precedence of the
+// operators, from the loosest to the tightest, so an
+// operator binds the operands of the looser ones. They
+// are spaced by ten, so the registered operators can
+// go between them.
+const (
+	bindingNone = 10 * iota
+	bindingPipeline
+	bindingOr
+	bindingAnd
+	bindingBitOr
+	bindingBitXor
+	bindingBitAnd
+	bindingEquality
+	bindingComparison
+	bindingElvis
+	bindingRange
+	bindingShift
+	bindingSum
+	bindingProduct
+)
+
+// infixOperators maps the binary operators to their
+// binding powers.
+var infixOperators = map[TokenKind]int{
+	Pipeline:       bindingPipeline,
+	Or:             bindingOr,
+	And:            bindingAnd,
+	BitOr:          bindingBitOr,
+	BitXor:         bindingBitXor,
+	BitAnd:         bindingBitAnd,
+	Equal:          bindingEquality,
+	NotEqual:       bindingEquality,
+	Less:           bindingComparison,
+	LessEqual:      bindingComparison,
+	Greater:        bindingComparison,
+	GreaterEqual:   bindingComparison,
+	Elvis:          bindingElvis,
+	Range:          bindingRange,
+	RangeInclusive: bindingRange,
+	ShiftLeft:      bindingShift,
+	ShiftRight:     bindingShift,
+	Plus:           bindingSum,
+	Minus:          bindingSum,
+	Asterisk:       bindingProduct,
+	Slash:          bindingProduct,
+	Percent:        bindingProduct,
+}
+
+// rightAssociative holds the binary operators that
+// group to the right, like `a ?: b ?: c`, that is
+// `a ?: (b ?: c)`.
+var rightAssociative = map[TokenKind]bool{
+	Elvis: true,
+}
+
+// prefixOperators holds the unary operators, that
+// bind tighter than all binary operators.
+var prefixOperators = map[TokenKind]bool{
+	Minus:  true,
+	Plus:   true,
+	Not:    true,
+	BitNot: true,
+}
+
+// continuations are the operators that continue the
+// expression of the previous line, when they start a
+// line, so the chains can be split in many lines:
+//
+//	val list = builder
+//	    .add(1)
+//	    .build()
+//
+// The other operators, like `-`, start a new statement,
+// as they can be prefix operators too.
+var continuations = map[TokenKind]bool{
+	Dot:      true,
+	SafeDot:  true,
+	Pipeline: true,
+	Elvis:    true,
+	And:      true,
+	Or:       true,
+}
+
+// statements parses the statements until the given
+// closing token, or the end of the input.
+func (p *Parser) statements(end TokenKind) {
+	for !p.at(end) && !p.eof() {
+		switch p.nth(0) {
+		case RightParen, RightBracket, RightBrace, Comma:
+			// The closing tokens can't start a statement, and
+			// they aren't consumed by the expressions.
+			p.report(unexpectedTokenCode, NewText("unexpected"), NewCode(p.current().Kind.String()))
+			m := p.open()
+			p.advance()
+			p.close(m, ErrorNode)
+			continue
+		}
+
+		p.statement()
+		p.terminator(end)
+	}
+}
+
+// statement parses a statement, like a declaration,
+// an assignment, or an expression.
+func (p *Parser) statement() {
+	switch p.nth(0) {
+	case Val, Var, Fun, Struct, Enum:
+		p.declaration(p.open())
+	case Module:
+		p.module()
+	case Import:
+		p.importation()
+	case If:
+		p.conditional(false)
+	case Defer:
+		p.deferral()
+	case While, For, Loop:
+		p.loop(p.open(), "")
+	case Annotation:
+		switch p.nth(1) {
+		case While, For, Loop:
+			p.label()
+		default:
+			m := p.open()
+			p.attributes()
+			p.declaration(m)
+		}
+	default:
+		p.assignment()
+	}
+}
+
+// declaration parses a declaration into the given node,
+// that holds the attributes before it, if any.
+func (p *Parser) declaration(m openMark) {
+	switch p.nth(0) {
+	case Val:
+		p.variable(m, ValNode)
+	case Var:
+		p.variable(m, VarNode)
+	case Fun:
+		p.function(m)
+	case Struct:
+		p.structure(m)
+	case Enum:
+		p.enumeration(m)
+	default:
+		// The attributes are skipped, and the statement
+		// after them is parsed alone.
+		p.report(unexpectedTokenCode, NewText("expected a declaration after the attributes, but found"), NewCode(p.current().Kind.String()))
+		p.close(m, ErrorNode)
+		if startsExpression(p.nth(0)) {
+			p.assignment()
+		}
+	}
+}
+
+// attributes parses the attributes of a declaration,
+// like `@inline` or `@deprecated("use g")`, into an
+// AttributesNode, that holds an AttributeNode with the
+// annotation and the optional arguments for each one.
+func (p *Parser) attributes() {
+	m := p.open()
+	for p.at(Annotation) {
+		a := p.open()
+		p.advance()
+		if p.at(LeftParen) && !p.atNewline() {
+			p.arguments()
+		}
+		p.close(a, AttributeNode)
+	}
+	p.close(m, AttributesNode)
+}
+
+// terminator consumes the semicolon that ends a
+// statement, or reports when the statement isn't
+// followed by a semicolon, a newline, or the given
+// closing token.
+func (p *Parser) terminator(end TokenKind) {
+	if p.eat(Semi) || p.at(end) || p.eof() || p.atNewline() {
+		return
+	}
+	p.report(missingSeparatorCode, NewText("expected a newline or"), NewCode(";"), NewText("after the statement, but found"), NewCode(p.current().Kind.String()))
+	p.recover(end)
+}
+
+// recover skips the tokens until the next statement
+// boundary, that is a newline, a semicolon, the given
+// closing token, or a keyword that starts a statement,
+// wrapping the skipped tokens into an ErrorNode.
+func (p *Parser) recover(end TokenKind) {
+	if p.atBoundary() {
+		return
+	}
+
+	m := p.open()
+	for !p.at(end) && !p.eof() && !p.atBoundary() {
+		p.advance()
+		if p.atNewline() {
+			break
+		}
+	}
+	p.close(m, ErrorNode)
+	p.eat(Semi)
+}
+
+// atBoundary returns true if the current token is a
+// semicolon, or a keyword that starts a statement.
+func (p *Parser) atBoundary() bool {
+	switch p.nth(0) {
+	case Semi, Val, Var, Fun, Struct, Enum, Module, Import, While, For, Loop, Defer:
+		return true
+	}
+	return false
+}
+
+// module parses the module declaration, like
+// `module math.trig`, into a ModuleNode with the
+// path of the module. It must be the first
+// statement of the file.
+func (p *Parser) module() {
+	if p.index > 0 {
+		p.report(misplacedCode, NewText("the module declaration must be the first statement of the file"))
+	}
+
+	m := p.open()
+	p.advance() // the module keyword
+	p.path()
+	p.close(m, ModuleNode)
+}
+
+// importation parses an import declaration into an
+// ImportNode, that is either a path, with an optional
+// alias, like `import math.sin as sine`, or a path,
+// with a list of selected names, like:
+//
+//	import math.{sin, cos as cosine}
+func (p *Parser) importation() {
+	m := p.open()
+	p.advance() // the import keyword
+	p.path()
+
+	switch {
+	case p.at(Dot) && p.nth(1) == LeftBrace:
+		p.advance()
+		p.advance()
+		p.nested(func() {
+			for p.at(Identifier) {
+				item := p.open()
+				p.advance()
+				p.alias()
+				p.close(item, ImportItemNode)
+				p.separator(RightBrace)
+			}
+		})
+		p.expect(RightBrace)
+	default:
+		p.alias()
+	}
+	p.close(m, ImportNode)
+}
+
+// alias parses the optional alias of an import, like
+// `as sine`, promoting the `as` to a keyword.
+func (p *Parser) alias() {
+	if !p.atSoftKeyword(As) {
+		return
+	}
+	p.promote(As)
+	p.advance()
+	p.advance() // the alias
+}
+
+// path parses a path of names separated by dots,
+// like `math.trig`, into a PathNode. The dot that is
+// followed by `{` isn't part of the path.
+func (p *Parser) path() {
+	m := p.open()
+	p.expect(Identifier)
+	for p.at(Dot) && p.nth(1) == Identifier {
+		p.advance()
+		p.advance()
+	}
+	p.close(m, PathNode)
+}
+
+// function parses a function declaration, like
+// `fun f(a: Int) -> Int { a }`, into a FunNode
+// with the name, the optional generic parameters,
+// the parameters, the optional return type after
+// `->`, and the body.
+func (p *Parser) function(m openMark) {
+	p.advance() // the fun keyword
+	p.expect(Identifier)
+	if p.at(Less) {
+		p.generics()
+	}
+
+	p.parameters()
+	if p.eat(Arrow) {
+		p.typeExpression()
+	}
+
+	if p.at(LeftBrace) {
+		p.callable(func() { p.block() })
+	} else {
+		p.report(unexpectedTokenCode, NewText("expected the function body, but found"), NewCode(p.current().Kind.String()))
+	}
+	p.close(m, FunNode)
+}
+
+// structure parses a struct declaration, like
+// `struct Box<T> { value: T, count: Int = 1 }`,
+// into a StructNode with the name, the optional
+// generic parameters and the fields.
+//
+// The fields are separated by commas or newlines.
+func (p *Parser) structure(m openMark) {
+	p.advance() // the struct keyword
+	p.expect(Identifier)
+	if p.at(Less) {
+		p.generics()
+	}
+
+	if !p.at(LeftBrace) {
+		p.report(unexpectedTokenCode, NewText("expected the struct fields, but found"), NewCode(p.current().Kind.String()))
+		p.close(m, StructNode)
+		return
+	}
+	p.advance()
+
+	nesting := p.nesting
+	p.nesting = 0
+	names := make(map[string]bool)
+	for p.at(Identifier) {
+		name := p.current().Text
+		if names[name] {
+			p.report(duplicateCode, NewText("duplicate field"), NewCode(name))
+		}
+		names[name] = true
+
+		p.field()
+		if !p.eat(Comma) && !p.at(RightBrace) && !p.atNewline() {
+			p.report(missingSeparatorCode, NewText("expected a newline or"), NewCode(","), NewText("after the field, but found"), NewCode(p.current().Kind.String()))
+		}
+	}
+	p.nesting = nesting
+
+	p.expect(RightBrace)
+	p.close(m, StructNode)
+}
+
+// field parses a struct field, like `count: Int = 1`,
+// into a FieldNode with the name, the type, and the
+// optional default value.
+func (p *Parser) field() {
+	m := p.open()
+	p.advance() // the name
+	if p.eat(Colon) {
+		p.typeExpression()
+	} else {
+		p.report(unexpectedTokenCode, NewText("expected the field type after"), NewCode(":"))
+	}
+	if p.eat(Assign) {
+		p.expression()
+	}
+	p.close(m, FieldNode)
+}
+
+// enumeration parses an enum declaration, like
+// `enum Shape { Circle(Decimal), Empty }`, into an
+// EnumNode with the name, the optional generic
+// parameters and the variants.
+//
+// The variants are separated by commas or newlines.
+func (p *Parser) enumeration(m openMark) {
+	p.advance() // the enum keyword
+	p.expect(Identifier)
+	if p.at(Less) {
+		p.generics()
+	}
+
+	if !p.at(LeftBrace) {
+		p.report(unexpectedTokenCode, NewText("expected the enum variants, but found"), NewCode(p.current().Kind.String()))
+		p.close(m, EnumNode)
+		return
+	}
+	p.advance()
+
+	nesting := p.nesting
+	p.nesting = 0
+	names := make(map[string]bool)
+	for p.at(Identifier) {
+		name := p.current().Text
+		if names[name] {
+			p.report(duplicateCode, NewText("duplicate variant"), NewCode(name))
+		}
+		names[name] = true
+
+		p.variant()
+		if !p.eat(Comma) && !p.at(RightBrace) && !p.atNewline() {
+			p.report(missingSeparatorCode, NewText("expected a newline or"), NewCode(","), NewText("after the variant, but found"), NewCode(p.current().Kind.String()))
+		}
+	}
+	p.nesting = nesting
+
+	p.expect(RightBrace)
+	p.close(m, EnumNode)
+}
+
+// variant parses an enum variant, like `Rect(Int, Int)`,
+// into a VariantNode with the name, and the types of the
+// payload between parentheses, if it has one.
+func (p *Parser) variant() {
+	m := p.open()
+	p.advance() // the name
+	if p.eat(LeftParen) {
+		p.nested(func() {
+			for p.at(Identifier) {
+				p.typeExpression()
+				p.separator(RightParen)
+			}
+		})
+		p.expect(RightParen)
+	}
+	p.close(m, VariantNode)
+}
+
+// generics parses the generic parameters, like
+// `<T, R: Comparable>`, into a GenericsNode, with
+// a TypeParameterNode for each parameter, holding
+// its name and its optional constraint.
+func (p *Parser) generics() {
+	m := p.open()
+	p.advance() // the `<`
+	p.nested(func() {
+		for p.at(Identifier) {
+			t := p.open()
+			p.advance()
+			if p.eat(Colon) {
+				p.typeExpression()
+			}
+			p.close(t, TypeParameterNode)
+			p.separator(Greater)
+		}
+	})
+	p.closeAngle()
+	p.close(m, GenericsNode)
+}
+
+// parameters parses the parameters of a function,
+// between parentheses and separated by commas,
+// reporting the duplicated names.
+func (p *Parser) parameters() {
+	if !p.at(LeftParen) {
+		p.report(unexpectedTokenCode, NewText("expected"), NewCode("("), NewText("before the parameters, but found"), NewCode(p.current().Kind.String()))
+		return
+	}
+	p.advance()
+
+	// The positions of the parameters, and the spans of
+	// their defaults, so the defaults that reference the
+	// parameters after them are reported.
+	names := make(map[string]int)
+	var defaults [][2]int
+	var variadic *Token
+	p.nested(func() {
+		for p.at(Identifier) {
+			name := p.current()
+			if _, ok := names[name.Text]; ok {
+				p.report(duplicateCode, NewText("duplicate parameter"), NewCode(name.Text))
+			} else {
+				names[name.Text] = len(defaults)
+			}
+
+			// Only the last parameter can be variadic, like
+			// `args: ...Any`, as it takes the rest of the
+			// arguments.
+			if variadic != nil {
+				p.errors = append(p.errors, NewDiagnostic(ParserError, ErrorSeverity, invalidParameterCode, variadic.Location(), NewText("the variadic parameter"), NewCode(variadic.Text), NewText("must be the last one")))
+				variadic = nil
+			}
+			if p.nth(1) == Colon && p.nth(2) == Spread {
+				variadic = &name
+			}
+
+			defaults = append(defaults, p.parameter())
+			p.separator(RightParen)
+		}
+	})
+	p.expect(RightParen)
+
+	for position, span := range defaults {
+		for i := span[0]; i < span[1]; i++ {
+			token := p.tokens[i]
+			if token.Kind != Identifier || i > 0 && (p.tokens[i-1].Kind == Dot || p.tokens[i-1].Kind == SafeDot) || i+1 < len(p.tokens) && p.tokens[i+1].Kind == Colon {
+				continue
+			}
+			if later, ok := names[token.Text]; ok && later >= position {
+				p.errors = append(p.errors, NewDiagnostic(ParserError, ErrorSeverity, invalidParameterCode, token.Location(), NewText("the default value references"), NewCode(token.Text), NewText("that isn't a parameter before it")))
+			}
+		}
+	}
+}
+
+// parameter parses a parameter, like `a: Int`, into
+// a ParameterNode with the name and the type, that is
+// variadic after `...`, like `args: ...Any`, and the
+// optional default value, like `b: Int = a + 1`. It
+// returns the span of the tokens of the default value.
+func (p *Parser) parameter() [2]int {
+	m := p.open()
+	p.advance() // the name
+	if p.eat(Colon) {
+		p.eat(Spread)
+		p.typeExpression()
+	} else {
+		p.report(unexpectedTokenCode, NewText("expected the parameter type after"), NewCode(":"))
+	}
+
+	var span [2]int
+	if p.eat(Assign) {
+		span[0] = p.index
+		p.expression()
+		span[1] = p.index
+	}
+	p.close(m, ParameterNode)
+	return span
+}
+
+// block parses a block of statements, between braces,
+// into a BlockNode. The newlines end the statements
+// again inside of the block, even if it's nested in
+// parentheses.
+func (p *Parser) block() closedMark {
+	p.enter()
+	defer p.leave()
+
+	m := p.open()
+	p.expect(LeftBrace)
+
+	nesting, restrictions := p.nesting, p.restrictions
+	p.nesting, p.restrictions = 0, 0
+	p.statements(RightBrace)
+	p.nesting, p.restrictions = nesting, restrictions
+
+	p.expect(RightBrace)
+	return p.close(m, BlockNode)
+}
+
+// variable parses a variable declaration, like
+// `val x: Int = 1`, into a node of the given kind,
+// that is ValNode or VarNode.
+//
+// A val must be initialized, and a var must have
+// either a type or an initializer. The destructuring
+// declarations, like `val (x, y) = point`, bind the
+// names of a PatternNode, and must be initialized.
+func (p *Parser) variable(m openMark, kind NodeKind) {
+	p.advance() // the val or var keyword
+	destructuring := p.at(LeftParen)
+	if destructuring {
+		p.pattern()
+	} else {
+		p.expect(Identifier)
+	}
+
+	typed := p.eat(Colon)
+	if typed {
+		p.typeExpression()
+	}
+
+	switch {
+	case p.eat(Assign):
+		p.expression()
+	case kind == ValNode:
+		p.report(uninitializedCode, NewText("expected"), NewCode("="), NewText("as a val must be initialized"))
+	case destructuring:
+		p.report(uninitializedCode, NewText("expected"), NewCode("="), NewText("as a destructuring declaration must be initialized"))
+	case !typed:
+		p.report(uninitializedCode, NewText("expected a type or an initializer for the var"))
+	}
+	p.close(m, kind)
+}
+
+// assignment parses an expression statement, that
+// is an assignment, like `x += 1`, if it's followed
+// by an assignment operator.
+//
+// The assignments are AssignNode with the target,
+// the operator and the value.
+func (p *Parser) assignment() {
+	target := p.expression()
+	if !p.nth(0).IsAssignmentOp() || p.atNewline() {
+		return
+	}
+
+	switch p.kindOf(target) {
+	case IdentifierNode, MemberNode, IndexNode:
+	default:
+		p.report(assignmentTargetCode, NewText("invalid assignment target, expected a name, a member or an index"))
+	}
+
+	m := p.openBefore(target)
+	p.advance()
+	p.expression()
+	p.close(m, AssignNode)
+}
+
+// pattern parses a pattern, that is either:
+//
+//   - a wildcard, like `_`, that matches anything;
+//   - a literal, like `1`, `-2.5` or `"a"`;
+//   - a binding, like `x`, that names the value;
+//   - a variant, like `Shape.Circle(r)` or `None`, with
+//     the patterns of its fields between parentheses;
+//   - a tuple, like `(x, (y, _))`, into a PatternNode.
+//
+// The name of a variant has a dot or parentheses, so
+// it's told apart from a binding.
+func (p *Parser) pattern() {
+	p.enter()
+	defer p.leave()
+
+	m := p.open()
+	switch current := p.current(); {
+	case p.at(LeftParen):
+		p.patterns()
+		p.close(m, PatternNode)
+	case p.at(Identifier) && current.Text == "_":
+		p.advance()
+		p.close(m, WildcardPatternNode)
+	case p.at(Identifier) && (current.Text == "true" || current.Text == "false"):
+		p.advance()
+		p.close(m, LiteralPatternNode)
+	case p.at(Identifier):
+		p.advance()
+		kind := BindingPatternNode
+		for p.eat(Dot) {
+			p.expect(Identifier)
+			kind = VariantPatternNode
+		}
+		if p.at(LeftParen) && !p.atNewline() {
+			p.patterns()
+			kind = VariantPatternNode
+		}
+		p.close(m, kind)
+	case p.at(Minus) && (p.nth(1) == Int || p.nth(1) == Decimal):
+		p.advance()
+		p.advance()
+		p.close(m, LiteralPatternNode)
+	case p.at(Int), p.at(Decimal), p.at(String), p.at(Char):
+		p.advance()
+		p.close(m, LiteralPatternNode)
+	default:
+		p.report(unexpectedTokenCode, NewText("expected a pattern, but found"), NewCode(current.Kind.String()))
+		switch p.nth(0) {
+		case EOF, RightParen, RightBrace, Comma, Arrow, Assign:
+		default:
+			p.advance()
+		}
+		p.close(m, ErrorNode)
+	}
+}
+
+// patterns parses the patterns between parentheses,
+// separated by commas, like the fields of a variant.
+func (p *Parser) patterns() {
+	p.advance() // the `(`
+	p.nested(func() {
+		for !p.at(RightParen) && startsPattern(p.nth(0)) {
+			p.pattern()
+			p.separator(RightParen)
+		}
+	})
+	p.expect(RightParen)
+}
+
+// startsPattern returns true if the given token kind
+// can start a pattern.
+func startsPattern(kind TokenKind) bool {
+	switch kind {
+	case Identifier, LeftParen, Minus, Int, Decimal, String, Char:
+		return true
+	}
+	return false
+}
+
+// atPattern returns true if the condition of the when
+// arm at the current token is a pattern, instead of an
+// expression, that is when it has only the tokens of
+// the patterns, and it has a wildcard or parentheses,
+// like `Shape.Circle(r)` or `(_, 0)`. The other patterns,
+// like `1` or `x`, are parsed as expressions, that are
+// compared to the subject.
+func (p *Parser) atPattern() bool {
+	depth, structured := 0, false
+	for i := p.index; i < len(p.tokens) && i < p.index+maxLookahead; i++ {
+		token := p.tokens[i]
+		switch token.Kind {
+		case LeftParen:
+			depth++
+			structured = true
+		case RightParen:
+			if depth--; depth < 0 {
+				return false
+			}
+		case Identifier:
+			structured = structured || token.Text == "_"
+		case Minus:
+			if i+1 >= len(p.tokens) || p.tokens[i+1].Kind != Int && p.tokens[i+1].Kind != Decimal {
+				return false
+			}
+		case Dot, Int, Decimal, String, Char:
+		case Comma, Arrow, If:
+			if depth == 0 {
+				return structured
+			}
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// typeExpression parses a type, that is either a name,
+// like `Int`, an application, like `List<Int>`, a tuple,
+// like `(Int, String)`, a function, like `(Int) -> Int`,
+// or an optional type, like `Int?`.
+//
+// A single type between parentheses, without a comma,
+// is only grouped, like in `((Int) -> Int)?`, and it's
+// kept as a TupleTypeNode of one type.
+func (p *Parser) typeExpression() closedMark {
+	p.enter()
+	defer p.leave()
+
+	var lhs closedMark
+	if p.at(LeftParen) {
+		m := p.open()
+		p.advance()
+		p.nested(func() {
+			for startsType(p.nth(0)) {
+				p.typeExpression()
+				p.separator(RightParen)
+			}
+		})
+		p.expect(RightParen)
+		if !p.eat(Arrow) {
+			lhs = p.close(m, TupleTypeNode)
+		} else {
+			p.typeExpression()
+			return p.close(m, FunctionTypeNode)
+		}
+	} else {
+		m := p.open()
+		p.expect(Identifier)
+		lhs = p.close(m, TypeNameNode)
+		if p.at(Less) && !p.atNewline() {
+			m := p.openBefore(lhs)
+			p.typeArguments()
+			lhs = p.close(m, TypeApplicationNode)
+		}
+	}
+
+	for p.at(Question) && !p.atNewline() {
+		m := p.openBefore(lhs)
+		p.advance()
+		lhs = p.close(m, OptionalTypeNode)
+	}
+	return lhs
+}
+
+// startsType returns true if the given token kind
+// can start a type.
+func startsType(kind TokenKind) bool {
+	return kind == Identifier || kind == LeftParen
+}
+
+// typeArguments parses the type arguments, like
+// `<Int, List<T>>`, between angle brackets, and
+// separated by commas.
+func (p *Parser) typeArguments() {
+	p.advance() // the `<`
+	p.nested(func() {
+		for startsType(p.nth(0)) {
+			p.typeExpression()
+			p.separator(Greater)
+		}
+	})
+	p.closeAngle()
+}
+
+// closeAngle consumes the `>` that closes the generic
+// parameters or the type arguments. The `>>` is split
+// in two, as it closes two nested type arguments, like
+// in `List<List<Int>>`.
+func (p *Parser) closeAngle() {
+	if p.at(ShiftRight) {
+		p.split()
+	}
+	p.expect(Greater)
+}
+
+// atTypeArguments returns true if the `<` at the
+// current token starts the type arguments of a call,
+// like `identity<Int>(3)`, instead of a comparison,
+// that is when the angle brackets are balanced, hold
+// only types, and are followed by `(`.
+func (p *Parser) atTypeArguments() bool {
+	depth := 0
+	for i := p.index; i < len(p.tokens) && i < p.index+maxLookahead; i++ {
+		switch p.tokens[i].Kind {
+		case Less:
+			depth++
+		case Greater:
+			depth--
+		case ShiftRight:
+			depth -= 2
+		case Identifier, Comma, Dot, Question, LeftParen, RightParen, Arrow:
+			continue
+		default:
+			return false
+		}
+
+		if depth <= 0 {
+			return depth == 0 && i+1 < len(p.tokens) && p.tokens[i+1].Kind == LeftParen
+		}
+	}
+	return false
+}
+
+// expression parses an expression, like `a + b * c`.
+func (p *Parser) expression() closedMark {
+	return p.binary(bindingNone)
+}
+
+// binary parses a binary expression, which operators
+// bind tighter than the given binding power, using
+// the precedence climbing algorithm.
+//
+// The binary expressions are ExprNode with the left
+// hand side, the operator and the right hand side.
+func (p *Parser) binary(power int) closedMark {
+	lhs := p.unary()
+	for {
+		operator := p.nth(0)
+		info, ok := p.operator(operator)
+		if !ok || info.Precedence <= power || p.atNewline() && !continuations[operator] {
+			return lhs
+		}
+
+		m := p.openBefore(lhs)
+		p.advance()
+		ranged := operator == Range || operator == RangeInclusive
+		p.enter()
+		switch {
+		case ranged && p.at(RightBracket):
+			// The range of a slice can be open, like `xs[1..]`.
+		case info.Assoc == RightAssociative:
+			p.binary(info.Precedence - 1)
+		default:
+			p.binary(info.Precedence)
+		}
+		p.leave()
+
+		if ranged {
+			p.step()
+			lhs = p.close(m, RangeNode)
+		} else {
+			lhs = p.close(m, ExprNode)
+		}
+	}
+}
+
+// step parses the optional step of a range, like the
+// `by 2` of `0..10 by 2`, that binds tighter than the
+// range, so `0..n by k + 1` steps by `k + 1`.
+func (p *Parser) step() {
+	if _, ok := p.current().AsSoftKeyword(By); !ok || p.atNewline() || !startsExpression(p.nth(1)) {
+		return
+	}
+	p.promote(By)
+	p.advance()
+	p.binary(bindingRange)
+}
+
+// unary parses a prefix unary expression, like `-x`,
+// that is an ExprNode with the operator and the
+// operand, or a postfix expression.
+func (p *Parser) unary() closedMark {
+	p.enter()
+	defer p.leave()
+
+	if !prefixOperators[p.nth(0)] {
+		return p.postfix()
+	}
+
+	m := p.open()
+	p.advance()
+	p.unary()
+	return p.close(m, ExprNode)
+}
+
+// postfix parses the calls, member accesses and
+// indexings that follow a primary expression, like
+// `a.b(c)[d]`. They don't continue in a new line,
+// so a parenthesized expression in the next line
+// isn't a call.
+func (p *Parser) postfix() closedMark {
+	lhs := p.primary()
+	for !p.atNewline() || continuations[p.nth(0)] {
+		switch p.nth(0) {
+		case LeftParen:
+			m := p.openBefore(lhs)
+			p.arguments()
+			if p.at(LeftBrace) && p.restrictions&noTrailingLambda == 0 && !p.atNewline() {
+				p.lambda()
+			}
+			lhs = p.close(m, CallNode)
+		case LeftBrace:
+			// The trailing lambda is the last argument of the
+			// call, like `xs.map { it * 2 }`.
+			if p.restrictions&noTrailingLambda != 0 {
+				return lhs
+			}
+			m := p.openBefore(lhs)
+			p.lambda()
+			lhs = p.close(m, CallNode)
+		case Dot, SafeDot:
+			m := p.openBefore(lhs)
+			p.advance()
+			p.expect(Identifier)
+			lhs = p.close(m, MemberNode)
+		case LeftBracket:
+			m := p.openBefore(lhs)
+			p.advance()
+			p.nested(p.slice)
+			p.expect(RightBracket)
+			lhs = p.close(m, IndexNode)
+		case Less:
+			if !p.atTypeArguments() {
+				return lhs
+			}
+			m := p.openBefore(lhs)
+			p.typeArguments()
+			lhs = p.close(m, TypeApplicationNode)
+		default:
+			return lhs
+		}
+	}
+	return lhs
+}
+
+// slice parses the index of an index expression, that
+// is an expression, or a range, like `1..3`, that can
+// be open at either end, like `1..` or `..3`.
+func (p *Parser) slice() {
+	if !p.at(Range) && !p.at(RangeInclusive) {
+		p.expression()
+		return
+	}
+
+	m := p.open()
+	p.advance()
+	if !p.at(RightBracket) {
+		p.binary(bindingRange)
+	}
+	p.step()
+	p.close(m, RangeNode)
+}
+
+// arguments parses the arguments of a call, between
+// parentheses and separated by commas. They are added
+// to the call node directly, so the call children are
+// the callee, `(`, the arguments and commas, and `)`.
+//
+// The named arguments, like `width: 10`, are wrapped
+// into a NamedArgumentNode, with the name, `:` and the
+// value. They must follow the positional arguments,
+// and their names can't be repeated. The spread
+// arguments, like `...xs`, are SpreadNode, and pass
+// the elements of a list to a variadic parameter.
+func (p *Parser) arguments() {
+	p.expect(LeftParen)
+	p.nested(func() {
+		names := make(map[string]bool)
+		for !p.at(RightParen) && (p.at(Spread) || startsExpression(p.nth(0))) {
+			if p.at(Identifier) && p.nth(1) == Colon {
+				name := p.current().Text
+				if names[name] {
+					p.report(duplicateCode, NewText("duplicate argument"), NewCode(name))
+				}
+				names[name] = true
+
+				m := p.open()
+				p.advance()
+				p.advance() // the `:`
+				p.expression()
+				p.close(m, NamedArgumentNode)
+			} else {
+				if len(names) > 0 {
+					p.report(argumentOrderCode, NewText("the positional arguments can't follow the named ones"))
+				}
+				if p.at(Spread) {
+					m := p.open()
+					p.advance()
+					p.expression()
+					p.close(m, SpreadNode)
+				} else {
+					p.expression()
+				}
+			}
+			p.separator(RightParen)
+		}
+	})
+	p.expect(RightParen)
+}
+
+// primary parses a primary expression, like a literal,
+// an identifier, or a parenthesized expression.
+func (p *Parser) primary() closedMark {
+	switch {
+	case p.at(If):
+		return p.conditional(true)
+	case p.at(LeftBrace):
+		return p.lambda()
+	case p.at(Return), p.at(Break), p.at(Continue):
+		return p.jump()
+	case p.at(LeftParen) && p.restrictions&noArrowLambda == 0 && p.atArrowLambda():
+		return p.arrowLambda()
+	}
+
+	m := p.open()
+	switch p.nth(0) {
+	case Int, Decimal:
+		p.advance()
+		return p.close(m, NumberNode)
+	case String:
+		p.advance()
+		return p.close(m, StringNode)
+	case StringStart:
+		p.interpolation()
+		return p.close(m, StringNode)
+	case Char:
+		p.advance()
+		return p.close(m, CharNode)
+	case Identifier:
+		kind := IdentifierNode
+		if text := p.current().Text; text == "true" || text == "false" {
+			kind = BoolNode
+		}
+		p.advance()
+		return p.close(m, kind)
+	case LeftParen:
+		return p.close(m, p.parenthesized())
+	case When:
+		p.when()
+		return p.close(m, WhenNode)
+	case LeftBracket:
+		p.list()
+		return p.close(m, ListNode)
+	case HashBrace:
+		p.mapping()
+		return p.close(m, MapNode)
+	}
+
+	// The unexpected token is kept in an error node, so
+	// the callers always get a node. The closing tokens
+	// are left to the callers, that expect them.
+	p.report(unexpectedTokenCode, NewText("expected an expression, but found"), NewCode(p.current().Kind.String()))
+	switch p.nth(0) {
+	case EOF, RightParen, RightBracket, RightBrace, Comma, StringMiddle, StringEnd:
+	default:
+		p.advance()
+	}
+	return p.close(m, ErrorNode)
+}
+
+// interpolation parses a string with interpolations,
+// like `"a ${b} c"`, where the literal segments and the
+// expressions between them alternate.
+func (p *Parser) interpolation() {
+	p.expect(StringStart)
+	for !p.eof() {
+		p.nested(func() { p.expression() })
+		if !p.at(StringMiddle) && !p.at(StringEnd) && !p.eof() {
+			p.report(unexpectedTokenCode, NewText("expected the end of the interpolation, but found"), NewCode(p.current().Kind.String()))
+			p.skipInterpolation()
+		}
+		if p.eat(StringEnd) {
+			return
+		}
+		p.eat(StringMiddle)
+	}
+	// The lexer reports the unterminated interpolations.
+}
+
+// skipInterpolation wraps the tokens until the end of
+// the current interpolation into an error node, with the
+// nested strings.
+func (p *Parser) skipInterpolation() {
+	m := p.open()
+	depth := 0
+	for !p.eof() && (depth > 0 || !p.at(StringMiddle) && !p.at(StringEnd)) {
+		switch p.nth(0) {
+		case StringStart:
+			depth++
+		case StringEnd:
+			depth--
+		}
+		p.advance()
+	}
+	p.close(m, ErrorNode)
+}
+
+// label parses a labeled loop, like `@outer while (c) {}`,
+// where the label is the target of the break and continue
+// statements inside of the loop.
+func (p *Parser) label() {
+	m := p.open()
+	label := p.current().Text
+	p.advance()
+	switch p.nth(0) {
+	case While, For, Loop:
+	default:
+		p.report(unexpectedTokenCode, NewText("expected a loop after the label, but found"), NewCode(p.current().Kind.String()))
+		p.close(m, ErrorNode)
+		return
+	}
+	p.loop(m, label)
+}
+
+// loop parses a loop into the given node, that is either
+// a WhileNode, like `while (c) {}`, a ForNode, like
+// `for x in xs {}`, or a LoopNode, like `loop {}`, that
+// runs until a break. The label is empty for the
+// loops without a label.
+func (p *Parser) loop(m openMark, label string) {
+	p.loops = append(p.loops, label)
+	defer func() { p.loops = p.loops[:len(p.loops)-1] }()
+
+	switch p.nth(0) {
+	case While:
+		p.advance()
+		p.expect(LeftParen)
+		p.nested(func() { p.expression() })
+		p.expect(RightParen)
+		p.block()
+		p.close(m, WhileNode)
+	case For:
+		p.advance()
+		if p.eat(LeftParen) {
+			p.nested(p.iteration)
+			p.expect(RightParen)
+		} else {
+			p.restricted(noTrailingLambda, p.iteration)
+		}
+		p.block()
+		p.close(m, ForNode)
+	default:
+		p.advance() // the loop keyword
+		p.block()
+		p.close(m, LoopNode)
+	}
+}
+
+// jump parses a return, like `return x`, into a
+// ReturnNode with the optional value on the same
+// line, or a break or a continue, like `break @outer`,
+// into a BreakNode or a ContinueNode, with the optional
+// label of the loop.
+//
+// The returns outside of the functions, and the breaks
+// and continues outside of the loops, or with labels of
+// no loop around them, are reported.
+func (p *Parser) jump() closedMark {
+	m := p.open()
+	keyword := p.current()
+	p.advance()
+
+	if keyword.Kind == Return {
+		switch {
+		case p.functions == 0:
+			p.errors = append(p.errors, NewDiagnostic(ParserError, ErrorSeverity, misplacedCode, keyword.Location(), NewCode("return"), NewText("outside of a function")))
+		case p.deferred > 0:
+			p.errors = append(p.errors, NewDiagnostic(ParserError, ErrorSeverity, misplacedCode, keyword.Location(), NewCode("return"), NewText("inside of a defer block")))
+		}
+		if !p.atNewline() && startsExpression(p.nth(0)) {
+			p.expression()
+		}
+		return p.close(m, ReturnNode)
+	}
+
+	kind := BreakNode
+	if keyword.Kind == Continue {
+		kind = ContinueNode
+	}
+	switch {
+	case p.at(Annotation) && !p.atNewline():
+		label := p.current()
+		if !slices.Contains(p.loops, label.Text) {
+			p.report(misplacedCode, NewText("there's no loop with the label"), NewCode("@"+label.Text), NewText("around the"), NewCode(keyword.Text))
+		}
+		p.advance()
+	case len(p.loops) == 0:
+		p.errors = append(p.errors, NewDiagnostic(ParserError, ErrorSeverity, misplacedCode, keyword.Location(), NewCode(keyword.Text), NewText("outside of a loop")))
+	}
+	return p.close(m, kind)
+}
+
+// callable parses the given rule as the body of a
+// function or a lambda, where the returns are allowed,
+// and the loops around it can't be broken.
+func (p *Parser) callable(rule func()) {
+	loops, deferred := p.loops, p.deferred
+	p.functions++
+	p.loops, p.deferred = nil, 0
+	defer func() { p.functions, p.loops, p.deferred = p.functions-1, loops, deferred }()
+
+	rule()
+}
+
+// deferral parses a defer statement, like
+// `defer { close(file) }`, into a DeferNode with the
+// block, that runs when the enclosing function exits.
+//
+// The block can't leave the function or the loops
+// around it, so the returns, the breaks and the
+// continues inside of it only target its own
+// functions and loops.
+func (p *Parser) deferral() {
+	m := p.open()
+	keyword := p.current()
+	p.advance() // the defer keyword
+	if p.functions == 0 {
+		p.errors = append(p.errors, NewDiagnostic(ParserError, ErrorSeverity, misplacedCode, keyword.Location(), NewCode("defer"), NewText("outside of a function")))
+	}
+
+	if p.at(LeftBrace) {
+		loops := p.loops
+		p.loops = nil
+		p.deferred++
+		p.block()
+		p.loops = loops
+		p.deferred--
+	} else {
+		p.report(unexpectedTokenCode, NewText("expected the defer block, but found"), NewCode(p.current().Kind.String()))
+	}
+	p.close(m, DeferNode)
+}
+
+// iteration parses the variable and the iterated value
+// of a for loop, like `x in xs`.
+func (p *Parser) iteration() {
+	p.expect(Identifier)
+	if _, ok := p.current().AsSoftKeyword(In); ok {
+		p.promote(In)
+		p.advance()
+	} else {
+		p.report(unexpectedTokenCode, NewText("expected"), NewCode("in"), NewText("but found"), NewCode(p.current().Kind.String()))
+	}
+	p.expression()
+}
+
+// conditional parses an if, like `if (c) a else b`, into
+// an IfNode with the condition, the then branch, and an
+// optional ElseNode, with the else branch, that is either
+// a block, another if, or an expression.
+//
+// The ifs used as expressions must have an else branch,
+// so they always have a value.
+func (p *Parser) conditional(expression bool) closedMark {
+	p.enter()
+	defer p.leave()
+
+	m := p.open()
+	p.advance() // the if keyword
+	p.expect(LeftParen)
+	p.nested(func() { p.expression() })
+	p.expect(RightParen)
+	p.branch()
+
+	if !p.at(Else) {
+		if expression {
+			p.report(missingElseCode, NewText("expected an"), NewCode("else"), NewText("branch, as the if is used as an expression"))
+		}
+		return p.close(m, IfNode)
+	}
+
+	e := p.open()
+	p.advance() // the else keyword
+	if p.at(If) {
+		p.conditional(expression)
+	} else {
+		p.branch()
+	}
+	p.close(e, ElseNode)
+	return p.close(m, IfNode)
+}
+
+// branch parses a branch of an if, that is either a
+// block or an expression.
+func (p *Parser) branch() {
+	if p.at(LeftBrace) {
+		p.block()
+	} else {
+		p.expression()
+	}
+}
+
+// parenthesized parses an expression between parentheses,
+// and returns the kind of the node, that is an ExprNode for
+// the grouped expressions, like `(a + b)`, or a TupleNode
+// for the tuples, with the elements separated by commas,
+// like `(1, "a")`, `(x,)` or `()`.
+func (p *Parser) parenthesized() NodeKind {
+	p.advance() // the `(`
+	kind := ExprNode
+	p.nested(func() {
+		if p.at(RightParen) {
+			kind = TupleNode
+			return
+		}
+		p.expression()
+		for p.eat(Comma) {
+			kind = TupleNode
+			if !startsExpression(p.nth(0)) {
+				break
+			}
+			p.expression()
+		}
+	})
+	p.expect(RightParen)
+	return kind
+}
+
+// list parses the brackets of a list literal, like
+// `[1, ...xs, 3]`, with the elements separated by
+// commas, and the spread elements, that are SpreadNode
+// with the `...` and the spread list.
+func (p *Parser) list() {
+	p.advance() // the `[`
+	p.nested(func() {
+		for p.at(Spread) || startsExpression(p.nth(0)) {
+			if p.at(Spread) {
+				m := p.open()
+				p.advance()
+				p.expression()
+				p.close(m, SpreadNode)
+			} else {
+				p.expression()
+			}
+			p.separator(RightBracket)
+		}
+	})
+	p.expect(RightBracket)
+}
+
+// mapping parses the braces of a map literal, like
+// `#{"a": 1, key: value}`, with the entries separated
+// by commas, that are EntryNode with the key, `:` and
+// the value. The `#{` tells the maps from the lambdas.
+//
+// The keys that are literals or names are reported
+// when they are duplicated.
+func (p *Parser) mapping() {
+	p.advance() // the `#{`
+	p.nested(func() {
+		keys := make(map[Token]bool)
+		for startsExpression(p.nth(0)) {
+			m := p.open()
+			start := p.index
+			p.expression()
+			if p.index == start+1 {
+				key := p.tokens[start]
+				if !keys[mapKey(key)] {
+					keys[mapKey(key)] = true
+				} else {
+					p.errors = append(p.errors, NewDiagnostic(ParserError, ErrorSeverity, duplicateCode, key.Location(), NewText("duplicate map key"), NewCode(key.FullText[len(triviaOf(key)):])))
+				}
+			}
+			p.expect(Colon)
+			p.expression()
+			p.close(m, EntryNode)
+			p.separator(RightBrace)
+		}
+	})
+	p.expect(RightBrace)
+}
+
+// mapKey returns the token that identifies the value of
+// a map key, where the integers are compared by their
+// values, as their texts don't have the prefix of their
+// bases, so `0x10` and `16` are the same key, but not
+// `0x10` and `0b10`.
+func mapKey(key Token) Token {
+	identity := Token{Kind: key.Kind, Text: key.Text, Suffix: key.Suffix}
+	if key.Kind == Int {
+		base := key.Base
+		if base == 0 {
+			base = 10
+		}
+		if value, ok := new(big.Int).SetString(strings.ReplaceAll(key.Text, "_", ""), base); ok {
+			identity.Text = value.String()
+		} else {
+			identity.Base = base
+		}
+	}
+	return identity
+}
+
+// lambda parses a lambda, like `{ x -> x * 2 }`,
+// into a LambdaNode, with the optional parameters
+// before the arrow, and the statements.
+//
+// A lambda without the parameters and the arrow,
+// like `{ it * 2 }`, has a single parameter `it`.
+func (p *Parser) lambda() closedMark {
+	m := p.open()
+	p.advance() // the `{`
+
+	nesting, restrictions := p.nesting, p.restrictions
+	p.nesting, p.restrictions = 0, 0
+	if p.atLambdaParameters() {
+		for p.at(Identifier) {
+			p.lambdaParameter()
+			p.separator(Arrow)
+		}
+		p.expect(Arrow)
+	}
+	p.callable(func() { p.statements(RightBrace) })
+	p.nesting, p.restrictions = nesting, restrictions
+
+	p.expect(RightBrace)
+	return p.close(m, LambdaNode)
+}
+
+// arrowLambda parses a lambda with its parameters
+// between parentheses, like `(a, b) -> a + b`, into
+// a LambdaNode with the parameters, the arrow, and
+// the body, that is a block or an expression.
+func (p *Parser) arrowLambda() closedMark {
+	m := p.open()
+	p.advance() // the `(`
+	p.nested(func() {
+		for p.at(Identifier) {
+			p.lambdaParameter()
+			p.separator(RightParen)
+		}
+	})
+	p.expect(RightParen)
+	p.expect(Arrow)
+	p.callable(p.branch)
+	return p.close(m, LambdaNode)
+}
+
+// lambdaParameter parses a parameter of a lambda,
+// into a ParameterNode, with the optional type.
+func (p *Parser) lambdaParameter() {
+	m := p.open()
+	p.advance() // the name
+	if p.eat(Colon) {
+		p.typeExpression()
+	}
+	p.close(m, ParameterNode)
+}
+
+// atLambdaParameters returns true if the current
+// token starts the parameters of a lambda, that are
+// names and types until an arrow, like in
+// `{ a, b: Int -> a + b }`.
+func (p *Parser) atLambdaParameters() bool {
+	for i := p.index; i < len(p.tokens) && i < p.index+maxLookahead; i++ {
+		switch p.tokens[i].Kind {
+		case Arrow:
+			return true
+		case Identifier, Comma, Colon, Dot, Question, Less, Greater, ShiftRight:
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// atArrowLambda returns true if the `(` at the current
+// token starts the parameters of a lambda, that is when
+// the parentheses hold only names and types, and they
+// are followed by an arrow, like in `(a, b) -> a + b`.
+func (p *Parser) atArrowLambda() bool {
+	depth := 0
+	for i := p.index; i < len(p.tokens) && i < p.index+maxLookahead; i++ {
+		switch p.tokens[i].Kind {
+		case LeftParen:
+			depth++
+		case RightParen:
+			depth--
+			if depth == 0 {
+				return i+1 < len(p.tokens) && p.tokens[i+1].Kind == Arrow
+			}
+		case Identifier, Comma, Colon, Dot, Question, Less, Greater, ShiftRight:
+		case Arrow:
+			if depth < 2 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// when parses a when expression, like:
+//
+//	when (x) {
+//	    1, 2 -> "small"
+//	    is String -> "text"
+//	    else -> "other"
+//	}
+//
+// The subject between parentheses is optional, and
+// without it, the arm conditions are booleans. The
+// arms are separated by commas or newlines.
+func (p *Parser) when() {
+	p.advance() // the when keyword
+	subject := p.eat(LeftParen)
+	if subject {
+		p.nested(func() { p.expression() })
+		p.expect(RightParen)
+	}
+
+	if !p.eat(LeftBrace) {
+		p.report(unexpectedTokenCode, NewText("expected the when arms, but found"), NewCode(p.current().Kind.String()))
+		return
+	}
+
+	nesting := p.nesting
+	p.nesting = 0
+	for !p.at(RightBrace) && !p.eof() {
+		if !p.at(Else) && !p.atSoftKeyword(Is) && !startsExpression(p.nth(0)) {
+			p.report(unexpectedTokenCode, NewText("expected a when arm, but found"), NewCode(p.current().Kind.String()))
+			break
+		}
+
+		p.whenArm(subject)
+		if !p.eat(Comma) && !p.eat(Semi) && !p.at(RightBrace) && !p.atNewline() {
+			p.report(missingSeparatorCode, NewText("expected a newline or"), NewCode(","), NewText("after the when arm, but found"), NewCode(p.current().Kind.String()))
+		}
+	}
+	p.nesting = nesting
+
+	p.expect(RightBrace)
+}
+
+// whenArm parses an arm of a when expression, into a
+// WhenArmNode with the conditions, separated by commas,
+// or `else`, the arrow, and the body, that's either a
+// block or an expression. The conditions can be
+// patterns, when the when has a subject, and they
+// can be followed by a guard, like `is Int if x > 0`,
+// into a GuardNode, so the arm is taken only if the
+// guard is true too.
+func (p *Parser) whenArm(subject bool) {
+	m := p.open()
+	otherwise := p.eat(Else)
+	if !otherwise {
+		for {
+			if p.atSoftKeyword(Is) {
+				p.promote(Is)
+				p.advance()
+				p.typeExpression()
+			} else if subject && p.atPattern() {
+				p.pattern()
+			} else {
+				p.restricted(noArrowLambda, func() { p.expression() })
+			}
+			if !p.eat(Comma) {
+				break
+			}
+		}
+	}
+
+	if p.at(If) {
+		if otherwise {
+			p.report(guardedElseCode, NewText("the"), NewCode("else"), NewText("arm can't have a guard"))
+		}
+		g := p.open()
+		p.advance()
+		p.restricted(noArrowLambda, func() { p.expression() })
+		p.close(g, GuardNode)
+	}
+
+	p.expect(Arrow)
+	p.branch()
+	p.close(m, WhenArmNode)
+}
+
+// separator consumes the comma after an element of a
+// list, that is optional before the given closing token,
+// so the trailing commas are accepted, and kept in the
+// tree. The repeated commas, like in `[1,, 2]`, are
+// reported and skipped into an ErrorNode.
+func (p *Parser) separator(close TokenKind) {
+	if p.at(close) || close == Greater && p.at(ShiftRight) {
+		return
+	}
+	p.expect(Comma)
+	if p.at(Comma) {
+		p.report(missingSeparatorCode, NewText("unexpected"), NewCode(","), NewText("without an element before it"))
+		m := p.open()
+		for p.at(Comma) {
+			p.advance()
+		}
+		p.close(m, ErrorNode)
+	}
+}
+
+// startsExpression returns true if a token of the
+// given kind can start an expression.
+func startsExpression(kind TokenKind) bool {
+	switch kind {
+	case Int, Decimal, String, StringStart, Char, Identifier, LeftParen, LeftBrace, LeftBracket, HashBrace, When, If, Return, Break, Continue:
+		return true
+	}
+	return prefixOperators[kind]
+}
+
+// nested parses the given rule inside of parentheses
+// or brackets, where the newlines don't end the
+// expressions, and there are no restrictions.
+func (p *Parser) nested(rule func()) {
+	restrictions := p.restrictions
+	p.nesting++
+	p.restrictions = 0
+	defer func() { p.nesting, p.restrictions = p.nesting-1, restrictions }()
+
+	rule()
+}
+
+// restricted parses the given rule with the given
+// restriction, like noTrailingLambda.
+func (p *Parser) restricted(restriction restriction, rule func()) {
+	restrictions := p.restrictions
+	p.restrictions |= restriction
+	defer func() { p.restrictions = restrictions }()
+
+	rule()
+}
@@ -0,0 +1,329 @@
+package tonho
+
+import "strings"
+
+// GreenElement represents an element of the green tree, that
+// is either a *GreenNode or a *GreenToken.
+//
+// The green elements are immutable, and they don't know their
+// position or their parent, so the same element can be shared
+// by many trees, and by many places of the same tree.
+type GreenElement interface {
+	// Width gets the length of the full text of the
+	// element, including the trivia.
+	Width() int
+}
+
+// GreenToken is a token of the green tree, with its full
+// text, including the leading trivia.
+type GreenToken struct {
+	Kind     TokenKind
+	FullText string
+}
+
+// GreenNode is a node of the green tree, with its kind and
+// its children, and the width of all of them.
+type GreenNode struct {
+	Kind     NodeKind
+	Children []GreenElement
+
+	width int
+}
+
+// Width gets the length of the full text of the token.
+func (t *GreenToken) Width() int {
+	return len(t.FullText)
+}
+
+// Width gets the length of the full text of the node.
+func (n *GreenNode) Width() int {
+	return n.width
+}
+
+// Text gets the full text of the node, that is exactly the
+// source code that it was parsed from.
+func (n *GreenNode) Text() string {
+	var text strings.Builder
+	text.Grow(n.width)
+	n.write(&text)
+	return text.String()
+}
+
+// write writes the full text of the node to the builder.
+func (n *GreenNode) write(text *strings.Builder) {
+	for _, child := range n.Children {
+		switch child := child.(type) {
+		case *GreenToken:
+			text.WriteString(child.FullText)
+		case *GreenNode:
+			child.write(text)
+		}
+	}
+}
+
+// greenKey is the key of the small nodes in the cache,
+// that have at most three children.
+type greenKey struct {
+	kind     NodeKind
+	count    int
+	children [3]GreenElement
+}
+
+// GreenCache deduplicates the green tokens and the small
+// green nodes, so the equal elements, like the `+` tokens
+// or the `x` identifiers, are shared instead of allocated
+// again. A cache can be reused between the builds, so the
+// trees of the same file share most of their elements.
+type GreenCache struct {
+	tokens map[GreenToken]*GreenToken
+	nodes  map[greenKey]*GreenNode
+}
+
+// NewGreenCache creates a new empty cache.
+func NewGreenCache() *GreenCache {
+	return &GreenCache{
+		tokens: make(map[GreenToken]*GreenToken),
+		nodes:  make(map[greenKey]*GreenNode),
+	}
+}
+
+// Token returns the shared green token of the given kind
+// and full text.
+func (c *GreenCache) Token(kind TokenKind, fullText string) *GreenToken {
+	key := GreenToken{Kind: kind, FullText: fullText}
+	if token, ok := c.tokens[key]; ok {
+		return token
+	}
+	token := &key
+	c.tokens[key] = token
+	return token
+}
+
+// Node returns a green node of the given kind and children,
+// that is shared if it's small enough to be cached.
+func (c *GreenCache) Node(kind NodeKind, children []GreenElement) *GreenNode {
+	width := 0
+	for _, child := range children {
+		width += child.Width()
+	}
+	if len(children) > len(greenKey{}.children) {
+		return &GreenNode{Kind: kind, Children: children, width: width}
+	}
+
+	key := greenKey{kind: kind, count: len(children)}
+	copy(key.children[:], children)
+	if node, ok := c.nodes[key]; ok {
+		return node
+	}
+	node := &GreenNode{Kind: kind, Children: children, width: width}
+	c.nodes[key] = node
+	return node
+}
+
+// BuildGreen replays the events over the tokens, like
+// BuildTree, and returns the root of the green tree. The
+// cache may be nil, and then a new one is used.
+func BuildGreen(events []Event, tokens []Token, cache *GreenCache) *GreenNode {
+	if cache == nil {
+		cache = NewGreenCache()
+	}
+
+	type frame struct {
+		kind     NodeKind
+		children []GreenElement
+	}
+	var stack []frame
+	index := 0
+	closeTop := func() *GreenNode {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := cache.Node(top.kind, top.children)
+		if len(stack) > 0 {
+			parent := &stack[len(stack)-1]
+			parent.children = append(parent.children, node)
+		}
+		return node
+	}
+
+	for _, event := range forwarded(events) {
+		switch event := event.(type) {
+		case OpenEvent:
+			stack = append(stack, frame{kind: event.Kind})
+		case CloseEvent:
+			if len(stack) == 0 {
+				continue
+			}
+			if node := closeTop(); len(stack) == 0 {
+				return node
+			}
+		case AdvanceEvent:
+			if len(stack) == 0 || index >= len(tokens) {
+				continue
+			}
+			top := &stack[len(stack)-1]
+			top.children = append(top.children, cache.Token(tokens[index].Kind, tokens[index].FullText))
+			index++
+		}
+	}
+
+	var root *GreenNode
+	for len(stack) > 0 {
+		root = closeTop()
+	}
+	if root == nil {
+		return cache.Node(FileNode, nil)
+	}
+	return root
+}
+
+// SyntaxElement represents an element of the red tree, that
+// is either a *SyntaxNode or a *SyntaxToken.
+type SyntaxElement interface {
+	// Parent gets the node that holds the element, or
+	// nil for the root node.
+	Parent() *SyntaxNode
+
+	// Offset gets the offset of the full text of the
+	// element, including the trivia, in the source code.
+	Offset() int
+}
+
+// SyntaxNode is a node of the red tree, that wraps a green
+// node, with its parent and its offset in the source code.
+// The red nodes are created on demand, while walking down
+// the tree, so they are cheap to throw away.
+type SyntaxNode struct {
+	green  *GreenNode
+	parent *SyntaxNode
+	offset int
+}
+
+// SyntaxToken is a token of the red tree, that wraps a green
+// token, with its parent and its offset in the source code.
+type SyntaxToken struct {
+	green  *GreenToken
+	parent *SyntaxNode
+	offset int
+}
+
+// NewSyntaxTree creates the red tree of the given green
+// root node, that starts at the offset 0.
+func NewSyntaxTree(root *GreenNode) *SyntaxNode {
+	return &SyntaxNode{green: root}
+}
+
+// ParseSyntax parses the input as a file, like Parse, and
+// returns its red tree, with the diagnostics.
+func ParseSyntax(filename, input string) (*SyntaxNode, []Diagnostic) {
+	parser := NewParser(filename, input)
+	parser.ParseFile()
+	return NewSyntaxTree(BuildGreen(parser.events, parser.tokens, nil)), parser.Diagnostics()
+}
+
+// Kind gets the kind of the node, like ValNode.
+func (n *SyntaxNode) Kind() NodeKind {
+	return n.green.Kind
+}
+
+// Green gets the green node of the node.
+func (n *SyntaxNode) Green() *GreenNode {
+	return n.green
+}
+
+// Parent gets the parent of the node, or nil for the root.
+func (n *SyntaxNode) Parent() *SyntaxNode {
+	return n.parent
+}
+
+// Offset gets the offset of the node in the source code.
+func (n *SyntaxNode) Offset() int {
+	return n.offset
+}
+
+// End gets the offset of the end of the node.
+func (n *SyntaxNode) End() int {
+	return n.offset + n.green.width
+}
+
+// Text gets the full text of the node.
+func (n *SyntaxNode) Text() string {
+	return n.green.Text()
+}
+
+// Children gets the children of the node, that are either
+// nodes or tokens, with their offsets.
+func (n *SyntaxNode) Children() []SyntaxElement {
+	children := make([]SyntaxElement, len(n.green.Children))
+	offset := n.offset
+	for i, child := range n.green.Children {
+		switch child := child.(type) {
+		case *GreenNode:
+			children[i] = &SyntaxNode{green: child, parent: n, offset: offset}
+		case *GreenToken:
+			children[i] = &SyntaxToken{green: child, parent: n, offset: offset}
+		}
+		offset += child.Width()
+	}
+	return children
+}
+
+// Ancestors returns the parents of the node, from the
+// closest to the root.
+func (n *SyntaxNode) Ancestors() []*SyntaxNode {
+	var ancestors []*SyntaxNode
+	for parent := n.parent; parent != nil; parent = parent.parent {
+		ancestors = append(ancestors, parent)
+	}
+	return ancestors
+}
+
+// TokenAt returns the token which full text contains the
+// given offset, or nil if it's outside of the node.
+func (n *SyntaxNode) TokenAt(offset int) *SyntaxToken {
+	if offset < n.offset || offset >= n.End() {
+		return nil
+	}
+	for _, child := range n.Children() {
+		switch child := child.(type) {
+		case *SyntaxNode:
+			if offset < child.End() {
+				return child.TokenAt(offset)
+			}
+		case *SyntaxToken:
+			if offset < child.End() {
+				return child
+			}
+		}
+	}
+	return nil
+}
+
+// Kind gets the kind of the token.
+func (t *SyntaxToken) Kind() TokenKind {
+	return t.green.Kind
+}
+
+// Green gets the green token of the token.
+func (t *SyntaxToken) Green() *GreenToken {
+	return t.green
+}
+
+// Parent gets the node that holds the token.
+func (t *SyntaxToken) Parent() *SyntaxNode {
+	return t.parent
+}
+
+// Offset gets the offset of the full text of the token.
+func (t *SyntaxToken) Offset() int {
+	return t.offset
+}
+
+// End gets the offset of the end of the token.
+func (t *SyntaxToken) End() int {
+	return t.offset + len(t.green.FullText)
+}
+
+// Text gets the full text of the token, with the trivia.
+func (t *SyntaxToken) Text() string {
+	return t.green.FullText
+}
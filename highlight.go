@@ -0,0 +1,103 @@
+package tonho
+
+import (
+	"bufio"
+	"io"
+)
+
+// Theme represents the colors of the syntax highlighting,
+// as the parameters of ANSI SGR escape sequences, like
+// `1;34` for bold blue. An empty color leaves the tokens
+// of the category uncolored.
+type Theme struct {
+	Keyword    string
+	Operator   string
+	Delimiter  string
+	String     string
+	Number     string
+	Comment    string
+	Annotation string
+	Error      string
+}
+
+// DefaultTheme is the theme used by the REPL and the
+// diagnostic snippets.
+var DefaultTheme = Theme{
+	Keyword:    "1;35",
+	Operator:   "36",
+	String:     "32",
+	Number:     "33",
+	Comment:    "2;37",
+	Annotation: "34",
+	Error:      "4;31",
+}
+
+// Highlight lexes the source code and writes it to the
+// writer, with the tokens colorized by the theme, using
+// ANSI escape sequences, for terminals. The text of the
+// source code is kept as is, even when it has errors.
+func Highlight(w io.Writer, source string, theme Theme) error {
+	tokens, _ := LexWithOptions("highlight", source, LexOptions{EmitTrivia: true})
+
+	out := bufio.NewWriter(w)
+	for _, token := range tokens {
+		trivia := triviaOf(token)
+		out.WriteString(trivia)
+
+		text := token.FullText[len(trivia):]
+		if color := theme.color(token.Kind); color != "" && text != "" {
+			out.WriteString("\x1b[" + color + "m" + text + "\x1b[0m")
+		} else {
+			out.WriteString(text)
+		}
+	}
+	return out.Flush()
+}
+
+// color returns the color of the given token kind.
+func (t Theme) color(kind TokenKind) string {
+	switch category(kind) {
+	case "keyword":
+		return t.Keyword
+	case "operator":
+		return t.Operator
+	case "delimiter":
+		return t.Delimiter
+	case "string":
+		return t.String
+	case "number":
+		return t.Number
+	case "comment":
+		return t.Comment
+	case "annotation":
+		return t.Annotation
+	case "error":
+		return t.Error
+	}
+	return ""
+}
+
+// category returns the highlighting category of the
+// given token kind, or an empty string for the kinds
+// that aren't highlighted, like identifiers.
+func category(kind TokenKind) string {
+	switch {
+	case kind.IsKeyword():
+		return "keyword"
+	case kind.IsOperator():
+		return "operator"
+	case kind.IsDelimiter():
+		return "delimiter"
+	case kind == String || kind == Char || kind == StringStart || kind == StringMiddle || kind == StringEnd:
+		return "string"
+	case kind == Int || kind == Decimal:
+		return "number"
+	case kind == Comment:
+		return "comment"
+	case kind == Annotation:
+		return "annotation"
+	case kind == Error:
+		return "error"
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package tonho
+
+import (
+	"io"
+	"iter"
+)
+
+// Lexer represents a scanner that recognizes the tokens of the
+// source code on demand, so they can be consumed lazily, unlike
+// the Lex function, that scans the whole input at once.
+type Lexer struct {
+	lexer lexer
+	done  bool
+	last  Token
+}
+
+// NewLexer creates a new lexer with the given input.
+func NewLexer(filename, input string) *Lexer {
+	return NewLexerWithOptions(filename, input, LexOptions{})
+}
+
+// NewLexerWithOptions creates a new lexer with the given input
+// and options.
+func NewLexerWithOptions(filename, input string, options LexOptions) *Lexer {
+	return &Lexer{lexer: lexer{file: NewSourceFile(filename, input), input: input, options: options}}
+}
+
+// NewReaderLexer creates a new lexer that reads the input from
+// the given reader, as the tokens are requested.
+func NewReaderLexer(filename string, r io.Reader) *Lexer {
+	return &Lexer{lexer: lexer{file: NewSourceFile(filename, ""), reader: r}}
+}
+
+// Next returns the next token of the input. After the end of
+// the input, it keeps returning the EOF token.
+func (x *Lexer) Next() Token {
+	l := &x.lexer
+	for len(l.tokens) == 0 && !x.done {
+		x.done = !l.step()
+	}
+	if len(l.tokens) == 0 {
+		return x.last
+	}
+
+	x.last = l.tokens[0]
+	l.tokens = l.tokens[:copy(l.tokens, l.tokens[1:])]
+	return x.last
+}
+
+// All returns an iterator over the remaining tokens of the
+// input, that ends after yielding the EOF token.
+func (x *Lexer) All() iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		for {
+			token := x.Next()
+			if !yield(token) || token.Kind == EOF {
+				return
+			}
+		}
+	}
+}
+
+// Diagnostics returns the diagnostics that were found so far.
+func (x *Lexer) Diagnostics() []Diagnostic {
+	return x.lexer.errors
+}
+
+// Err returns the error that happened while reading the input,
+// if the lexer was created with a reader.
+func (x *Lexer) Err() error {
+	return x.lexer.err
+}
@@ -0,0 +1,245 @@
+package tonho
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Span is a location that holds its positions, instead
+// of computing them from a source file, like the ones
+// that are decoded from JSON.
+type Span struct {
+	file   string
+	start  int
+	end    int
+	line   int
+	column int
+}
+
+// jsonLocation is the JSON representation of a location.
+// The text of the file isn't included, as it would be
+// repeated for every location.
+type jsonLocation struct {
+	File   string `json:"file"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// jsonToken is the JSON representation of a token.
+type jsonToken struct {
+	Kind     TokenKind     `json:"kind"`
+	Text     string        `json:"text"`
+	FullText string        `json:"fullText"`
+	Base     int           `json:"base,omitempty"`
+	Suffix   string        `json:"suffix,omitempty"`
+	Location *jsonLocation `json:"location,omitempty"`
+}
+
+// jsonNode is the JSON representation of a node. The
+// children are kept raw when decoding, as they can be
+// either tokens or nodes.
+type jsonNode struct {
+	Kind     NodeKind          `json:"kind"`
+	Children []json.RawMessage `json:"children"`
+	Location *jsonLocation     `json:"location,omitempty"`
+}
+
+// NewSpan creates a new span with the given file name,
+// byte offsets, and line and column of the start.
+func NewSpan(file string, start, end, line, column int) Span {
+	return Span{file: file, start: start, end: end, line: line, column: column}
+}
+
+// Start returns the start position of the span.
+func (s Span) Start() int {
+	return s.start
+}
+
+// End returns the end position of the span.
+func (s Span) End() int {
+	return s.end
+}
+
+// Line returns the line of the start of the span.
+func (s Span) Line() int {
+	return s.line
+}
+
+// Column returns the column of the start of the span.
+func (s Span) Column() int {
+	return s.column
+}
+
+// Text returns an empty string, as a span doesn't
+// hold the text of its file.
+func (s Span) Text() string {
+	return ""
+}
+
+// File returns the file name of the span.
+func (s Span) File() string {
+	return s.file
+}
+
+// MarshalJSON encodes the span as a JSON object.
+func (s Span) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newJSONLocation(s))
+}
+
+// UnmarshalJSON decodes the span from a JSON object.
+func (s *Span) UnmarshalJSON(data []byte) error {
+	var location jsonLocation
+	if err := json.Unmarshal(data, &location); err != nil {
+		return err
+	}
+	*s = location.span()
+	return nil
+}
+
+// MarshalJSON encodes the location as a JSON object.
+func (l lexerLocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(newJSONLocation(l))
+}
+
+// MarshalText encodes the token kind as its name.
+func (k TokenKind) MarshalText() ([]byte, error) {
+	name, ok := TokenNames[k]
+	if !ok {
+		return nil, fmt.Errorf("unknown token kind %d", int(k))
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText decodes the token kind from its name.
+func (k *TokenKind) UnmarshalText(text []byte) error {
+	for kind, name := range TokenNames {
+		if name == string(text) {
+			*k = kind
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown token kind %q", text)
+}
+
+// MarshalJSON encodes the token as a JSON object, with
+// its kind, texts, base, suffix and location.
+func (t Token) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonToken{
+		Kind:     t.Kind,
+		Text:     t.Text,
+		FullText: t.FullText,
+		Base:     t.Base,
+		Suffix:   t.Suffix,
+		Location: newJSONLocation(t.Location()),
+	})
+}
+
+// UnmarshalJSON decodes the token from a JSON object.
+// The decoded token has no source file, so its
+// location is a span.
+func (t *Token) UnmarshalJSON(data []byte) error {
+	var token jsonToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return err
+	}
+
+	*t = NewToken(token.Kind, token.Text, token.FullText)
+	t.Base = token.Base
+	t.Suffix = token.Suffix
+	if token.Location != nil {
+		span := token.Location.span()
+		t.span = &span
+	}
+	return nil
+}
+
+// MarshalJSON encodes the node as a JSON object, with
+// the name of its kind, its children and its location.
+//
+// As JSON is a subset of YAML, the encoded trees can be
+// read as YAML too.
+func (n Node) MarshalJSON() ([]byte, error) {
+	children := make([]json.RawMessage, 0, len(n.Children))
+	for _, child := range n.Children {
+		data, err := json.Marshal(child)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, data)
+	}
+
+	return json.Marshal(jsonNode{
+		Kind:     n.Kind,
+		Children: children,
+		Location: newJSONLocation(n.Location()),
+	})
+}
+
+// UnmarshalJSON decodes the node from a JSON object.
+// The children with a `children` field are decoded
+// as nodes, and the others as tokens.
+func (n *Node) UnmarshalJSON(data []byte) error {
+	var node jsonNode
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+
+	children := make([]Tree, 0, len(node.Children))
+	for _, data := range node.Children {
+		child, err := unmarshalTree(data)
+		if err != nil {
+			return err
+		}
+		children = append(children, child)
+	}
+
+	*n = NewNode(node.Kind, children)
+	if node.Location != nil {
+		n.location = node.Location.span()
+	}
+	return nil
+}
+
+// unmarshalTree decodes a tree, that is a node if
+// it has children, or a token otherwise.
+func unmarshalTree(data []byte) (Tree, error) {
+	var probe struct {
+		Children json.RawMessage `json:"children"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+
+	if probe.Children != nil {
+		var node Node
+		err := node.UnmarshalJSON(data)
+		return node, err
+	}
+
+	var token Token
+	err := token.UnmarshalJSON(data)
+	return token, err
+}
+
+// newJSONLocation creates the JSON representation of
+// the given location, or nil if there's no location.
+func newJSONLocation(location Location) *jsonLocation {
+	if location == nil {
+		return nil
+	}
+	return &jsonLocation{
+		File:   location.File(),
+		Start:  location.Start(),
+		End:    location.End(),
+		Line:   location.Line(),
+		Column: location.Column(),
+	}
+}
+
+// span creates a span from the JSON representation
+// of the location.
+func (l jsonLocation) span() Span {
+	return NewSpan(l.File, l.Start, l.End, l.Line, l.Column)
+}
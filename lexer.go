@@ -2,169 +2,177 @@ package tonho
 
 import (
 	"fmt"
+	"io"
+	"strconv"
+	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Token represents a token in the source code.
 type Token struct {
-	Kind int
+	Kind TokenKind
 	Text string
 
-	// Location represents the location of the
-	// token in the source code.
-	location Location
+	// The source file of the token, and the byte
+	// offsets of the token in its text, that are
+	// used to build the location on demand. The
+	// texts of the token are views of the file's
+	// text too, so a token holds no copies.
+	file       *SourceFile
+	start, end int
+
+	// The location of a token that was decoded
+	// from JSON, as it has no source file.
+	span *Span
 
 	// Represents the token with the ignored
 	// tokens present. Like, if the token has
 	// any spaces, or comments, or newlines,
 	// it will appear here, but not on Text.
+	//
+	// The ignored tokens are the ones that precede
+	// the token, so joining the full texts of all
+	// tokens gives back the source code.
 	FullText string
+
+	// Base represents the numeric base of integer
+	// tokens, like 16 for `0x1F`, in that case,
+	// the Text holds only the digits, without
+	// the prefix. It's zero for other kinds.
+	Base int
+
+	// Suffix holds the type suffix of number
+	// tokens, like `i64` for `42i64`, so the
+	// typer can honor the explicit type. It's
+	// empty when the literal has no suffix.
+	Suffix string
 }
 
 // lexerLocation represents a location in the
-// source code.
+// source code, the start and the end are byte
+// offsets in the UTF-8 encoded text.
 type lexerLocation struct {
 	start int
 	end   int
-	text  string
-	file  string
-}
-
-// Token kinds. This defines the tokens that
-// are recognized by the lexer.
-const (
-	EOF = iota
-	Error
-
-	Identifier
-	Decimal
-	Int
-	String
-
-	Fun
-	Val
-	Var
-	For
-	While
-	Loop
-	If
-	Else
-	When
-
-	Plus
-	Minus
-	Asterisk
-	Slash
-	Percent
-	Equal
-	NotEqual
-	Less
-	LessEqual
-	Greater
-	GreaterEqual
-	And
-	Or
-	Not
-	Assign
-
-	LeftParen
-	RightParen
-	LeftBrace
-	RightBrace
-	LeftBracket
-	RightBracket
-
-	Comma
-	Dot
-	Colon
-	Semi
-	Arrow
-
-	Comment
-	Newline
-)
-
-// keywords is used to determine if an
-// identifier is a keyword or not.
-var keywords = map[string]int{
-	"fun":   Fun,
-	"val":   Val,
-	"var":   Var,
-	"for":   For,
-	"while": While,
-	"loop":  Loop,
-	"if":    If,
-	"else":  Else,
-	"when":  When,
-}
-
-// Token names. This is used for debugging
-// purposes.
-var names = map[int]string{
-	EOF:   "EOF",
-	Error: "Error",
-
-	Identifier: "Identifier",
-	Decimal:    "Decimal",
-	Int:        "Int",
-	String:     "String",
-
-	Fun:   "fun",
-	Val:   "val",
-	Var:   "var",
-	For:   "for",
-	While: "while",
-	Loop:  "loop",
-	If:    "if",
-	Else:  "else",
-	When:  "when",
-
-	Plus:         "+",
-	Minus:        "-",
-	Asterisk:     "*",
-	Slash:        "/",
-	Percent:      "%",
-	Equal:        "==",
-	NotEqual:     "!=",
-	Less:         "<",
-	LessEqual:    "<=",
-	Greater:      ">",
-	GreaterEqual: ">=",
-	And:          "&&",
-	Or:           "||",
-	Not:          "!",
-	Assign:       "=",
-
-	LeftParen:    "(",
-	RightParen:   ")",
-	LeftBrace:    "[",
-	RightBrace:   "]",
-	LeftBracket:  "{",
-	RightBracket: "}",
-
-	Comma: ",",
-	Dot:   ".",
-	Colon: ":",
-	Semi:  ";",
-	Arrow: "->",
-
-	Comment: "//",
-	Newline: "\\n",
+	file  *SourceFile
 }
 
 // lexer represents a scanner that will recognize
 // tokens in the source code.
 type lexer struct {
-	filename, input string
-	tokens          []Token
-	position        int
-	start           int
+	file     *SourceFile
+	input    string
+	options  LexOptions
+	reader   io.Reader
+	err      error
+	tokens   []Token
+	errors   []Diagnostic
+	position int
+	start    int
+
+	// The start of the trivia, like spaces and
+	// comments, that precedes the next token.
+	trivia int
+
+	// The stack of the indentation columns, and
+	// the end of the last token that isn't trivia,
+	// that are used by the EmitIndents option.
+	indents []int
+	last    int
+
+	// The number of tokens that were emitted,
+	// that is checked against MaxTokens, and the
+	// kind of the last one that isn't trivia.
+	emitted  int
+	previous TokenKind
+
+	// The stack of the open interpolations of
+	// the strings, with the number of the braces
+	// open inside of each one, so the `}` that
+	// closes the interpolation is known.
+	templates []int
 }
 
-// Lex creates a new lexer with the given input.
-func Lex(filename, input string) []Token {
-	l := lexer{filename: filename, input: input}
-	return l.lex()
+// LexOptions represents the options that change
+// how the lexer recognizes the tokens.
+type LexOptions struct {
+	// Keywords maps the keywords to their token
+	// kinds, replacing the default keywords when
+	// it isn't nil.
+	Keywords map[string]TokenKind
+
+	// EmitNewlines makes the lexer emit Newline
+	// tokens, instead of skipping the newlines
+	// like spaces, so the parser can use them
+	// to terminate statements. A run of blank
+	// lines is emitted as a single token.
+	EmitNewlines bool
+
+	// EmitTrivia makes the lexer emit Whitespace
+	// and Comment tokens, instead of attaching
+	// them to the full text of the next token,
+	// which is useful for tools like formatters
+	// and highlighters.
+	EmitTrivia bool
+
+	// CaseInsensitive makes the keywords match
+	// regardless of the case, so `FUN` is lexed
+	// as the `fun` keyword.
+	CaseInsensitive bool
+
+	// EmitIndents makes the lexer emit Indent and
+	// Dedent tokens, when the first token of a
+	// line is more or less indented than the
+	// enclosing block, for the experimental
+	// indentation based blocks. The Dedent
+	// tokens of the open blocks are emitted
+	// before the EOF.
+	//
+	// The indentation is counted in runes, so a
+	// tab counts as a single column.
+	EmitIndents bool
+
+	// MaxInputSize is the maximum size of the
+	// input in bytes, MaxTokens is the maximum
+	// number of tokens, and MaxTokenLength is
+	// the maximum length in bytes of strings
+	// and comments. A zero means no limit.
+	//
+	// When the input or the tokens go over the
+	// limit, the lexer reports it, and the rest
+	// of the input is emitted as an Error token,
+	// followed by the EOF, so untrusted inputs
+	// can't make the lexer produce too many
+	// tokens.
+	MaxInputSize   int
+	MaxTokens      int
+	MaxTokenLength int
+
+	// Interner makes the lexer intern the texts
+	// of the identifiers, keywords and annotations,
+	// so the tokens share a single copy of each
+	// name, and the later phases can get their
+	// symbols from the same table.
+	Interner *Interner
+}
+
+// Lex creates a new lexer with the given input, and returns
+// the tokens and the diagnostics that were found.
+func Lex(filename, input string) ([]Token, []Diagnostic) {
+	return LexWithOptions(filename, input, LexOptions{})
+}
+
+// LexWithOptions creates a new lexer with the given input and
+// options, and returns the tokens and the diagnostics that were
+// found.
+func LexWithOptions(filename, input string, options LexOptions) ([]Token, []Diagnostic) {
+	l := lexer{file: NewSourceFile(filename, input), input: input, options: options}
+
+	// Most tokens, with their trivia, are a few bytes long, so
+	// this avoids growing the slice while lexing.
+	l.tokens = make([]Token, 0, len(input)/4+1)
+	return l.lex(), l.errors
 }
 
 // NewToken creates a new token with the given
@@ -174,7 +182,7 @@ func Lex(filename, input string) []Token {
 // the token. The full text is the text that
 // is used to create the token, but with the
 // ignored tokens present.
-func NewToken(kind int, text, fullText string) Token {
+func NewToken(kind TokenKind, text, fullText string) Token {
 	return Token{
 		Kind:     kind,
 		Text:     text,
@@ -185,12 +193,26 @@ func NewToken(kind int, text, fullText string) Token {
 // String returns the string representation of
 // the token.
 func (t Token) String() string {
-	return fmt.Sprintf("Token (kind: '%s', text: '%s')", names[t.Kind], t.Text)
+	return fmt.Sprintf("Token (kind: '%s', text: '%s')", t.Kind, t.Text)
 }
 
-// Location returns the location of the token.
+// Location returns the location of the token,
+// or nil if the token wasn't lexed from a file.
 func (t Token) Location() Location {
-	return t.location
+	if t.file == nil {
+		if t.span != nil {
+			return *t.span
+		}
+		return nil
+	}
+	return lexerLocation{start: t.start, end: t.end, file: t.file}
+}
+
+// Source returns the source file that the
+// token was lexed from, or nil if there's no
+// such file.
+func (t Token) Source() *SourceFile {
+	return t.file
 }
 
 // Start returns the start position of the
@@ -205,152 +227,470 @@ func (l lexerLocation) End() int {
 	return l.end
 }
 
-// Text returns the text of the token.
+// Line returns the line of the start of
+// the token.
+func (l lexerLocation) Line() int {
+	line, _ := l.file.PositionFor(l.start)
+	return line
+}
+
+// Column returns the column of the start
+// of the token.
+func (l lexerLocation) Column() int {
+	_, column := l.file.PositionFor(l.start)
+	return column
+}
+
+// Text returns the text of the file of
+// the token.
 func (l lexerLocation) Text() string {
-	return l.text
+	return l.file.Text()
 }
 
 // File returns the file name of the token.
 func (l lexerLocation) File() string {
-	return l.file
+	return l.file.Name()
 }
 
 // lex scans the input and returns the tokens
 // that were found.
 func (l *lexer) lex() []Token {
-	for {
-		l.start = l.position
+	for l.step() {
+	}
+	return l.tokens
+}
 
-		if l.position >= len(l.input) {
-			l.tokens = append(l.tokens, l.newToken(EOF))
-			break
-		}
+// step scans the input until the next token,
+// and returns false when there are no more
+// tokens to scan.
+func (l *lexer) step() bool {
+	if l.position == 0 && (!l.checkSize() || !l.detectEncoding()) {
+		return false
+	}
+	l.start = l.position
 
-		if !l.nextToken() {
-			break
+	if max := l.options.MaxTokens; max > 0 && l.emitted >= max {
+		return l.skipRest(limitCode, NewText("the input has too many tokens, the limit is"), NewCode(strconv.Itoa(max)))
+	}
+
+	if l.eof() {
+		if len(l.templates) > 0 {
+			l.report(unterminatedCode, NewText("unterminated string interpolation, expected"), NewCode("}"))
+			l.templates = nil
 		}
+		l.emit(l.newToken(EOF))
+		return false
 	}
-	return l.tokens
+
+	return l.nextToken()
 }
 
 func (l *lexer) nextToken() bool {
 	switch c := l.peek(); c {
 	case ' ', '\t', '\r':
+		if l.options.EmitTrivia {
+			return l.lexWhitespace()
+		}
+	case '\n':
+		if l.options.EmitNewlines {
+			return l.lexNewline()
+		} else if l.options.EmitTrivia {
+			return l.lexWhitespace()
+		}
+	case '#':
+		// The shebang line makes the scripts executable,
+		// and it's kept as a comment.
+		if l.atStart() && l.match("#!") {
+			return l.skipLineComment()
+		} else if l.match("#{") {
+			return l.lexOperator(HashBrace, 2)
+		}
+		return l.lexUnknown()
+	case '/':
+		if l.match("//") {
+			return l.skipLineComment()
+		} else if l.match("/*") {
+			return l.skipBlockComment()
+		} else if l.match("/=") {
+			return l.lexOperator(SlashAssign, 2)
+		}
+		return l.lexOperator(Slash, 1)
 	case '%':
-		l.tokens = append(l.tokens, l.newToken(Percent))
+		if l.match("%=") {
+			return l.lexOperator(PercentAssign, 2)
+		}
+		return l.lexOperator(Percent, 1)
 	case '.':
-		l.tokens = append(l.tokens, l.newToken(Dot))
+		// The longest dots win, so `...` is never lexed
+		// as a range followed by a dot.
+		if l.match("...") {
+			return l.lexOperator(Spread, 3)
+		} else if l.match("..=") {
+			return l.lexOperator(RangeInclusive, 3)
+		} else if l.match("..") {
+			return l.lexOperator(Range, 2)
+		}
+		return l.lexOperator(Dot, 1)
 	case ',':
-		l.tokens = append(l.tokens, l.newToken(Comma))
+		return l.lexOperator(Comma, 1)
+	case ':':
+		return l.lexOperator(Colon, 1)
 	case ';':
-		l.tokens = append(l.tokens, l.newToken(Comma))
+		return l.lexOperator(Semi, 1)
 	case '{':
-		l.tokens = append(l.tokens, l.newToken(LeftBrace))
+		if n := len(l.templates); n > 0 {
+			l.templates[n-1]++
+		}
+		return l.lexOperator(LeftBrace, 1)
 	case '}':
-		l.tokens = append(l.tokens, l.newToken(RightBrace))
+		if n := len(l.templates); n > 0 {
+			if l.templates[n-1] == 0 {
+				return l.lexTemplate()
+			}
+			l.templates[n-1]--
+		}
+		return l.lexOperator(RightBrace, 1)
 	case '[':
-		l.tokens = append(l.tokens, l.newToken(LeftBracket))
+		return l.lexOperator(LeftBracket, 1)
 	case ']':
-		l.tokens = append(l.tokens, l.newToken(RightBracket))
+		return l.lexOperator(RightBracket, 1)
 	case '(':
-		l.tokens = append(l.tokens, l.newToken(LeftParen))
+		return l.lexOperator(LeftParen, 1)
 	case ')':
-		l.tokens = append(l.tokens, l.newToken(RightParen))
+		return l.lexOperator(RightParen, 1)
 	case '+':
-		l.tokens = append(l.tokens, l.newToken(Plus))
-	case '/':
-		l.tokens = append(l.tokens, l.newToken(Slash))
+		if l.match("+=") {
+			return l.lexOperator(PlusAssign, 2)
+		}
+		return l.lexOperator(Plus, 1)
 	case '*':
-		l.tokens = append(l.tokens, l.newToken(Asterisk))
+		if l.match("*=") {
+			return l.lexOperator(AsteriskAssign, 2)
+		}
+		return l.lexOperator(Asterisk, 1)
 	case '-':
-		lookahead := l.lookahead(1)
-		switch lookahead {
-		case '>':
-			l.tokens = append(l.tokens, l.newToken(Arrow))
-			l.advance(2)
-			return true
-		default:
-			l.tokens = append(l.tokens, l.newToken(Minus))
+		if l.match("-=") {
+			return l.lexOperator(MinusAssign, 2)
+		} else if l.match("->") {
+			return l.lexOperator(Arrow, 2)
 		}
-		l.tokens = append(l.tokens, l.newToken(Minus))
+		return l.lexOperator(Minus, 1)
 	case '|':
-		lookahead := l.lookahead(1)
-		switch lookahead {
-		case '|':
-			l.tokens = append(l.tokens, l.newToken(Or))
-			l.advance(2)
-			return true
+		if l.match("||") {
+			return l.lexOperator(Or, 2)
+		} else if l.match("|>") {
+			return l.lexOperator(Pipeline, 2)
 		}
+		return l.lexOperator(BitOr, 1)
 	case '&':
-		lookahead := l.lookahead(1)
-		switch lookahead {
-		case '&':
-			l.tokens = append(l.tokens, l.newToken(And))
-			l.advance(2)
-			return true
+		if l.match("&&") {
+			return l.lexOperator(And, 2)
+		}
+		return l.lexOperator(BitAnd, 1)
+	case '?':
+		if l.match("?.") {
+			return l.lexOperator(SafeDot, 2)
+		} else if l.match("?:") {
+			return l.lexOperator(Elvis, 2)
 		}
+		return l.lexOperator(Question, 1)
+	case '^':
+		return l.lexOperator(BitXor, 1)
+	case '~':
+		return l.lexOperator(BitNot, 1)
 	case '!':
-		lookahead := l.lookahead(1)
-		switch lookahead {
-		case '=':
-			l.tokens = append(l.tokens, l.newToken(NotEqual))
-			l.advance(2)
-			return true
-		default:
-			l.tokens = append(l.tokens, l.newToken(Equal))
+		if l.match("!=") {
+			return l.lexOperator(NotEqual, 2)
 		}
+		return l.lexOperator(Not, 1)
 	case '>':
-		lookahead := l.lookahead(1)
-		switch lookahead {
-		case '=':
-			l.tokens = append(l.tokens, l.newToken(GreaterEqual))
-			l.advance(2)
-			return true
-		default:
-			l.tokens = append(l.tokens, l.newToken(Greater))
+		if l.match(">>") {
+			return l.lexOperator(ShiftRight, 2)
+		} else if l.match(">=") {
+			return l.lexOperator(GreaterEqual, 2)
 		}
+		return l.lexOperator(Greater, 1)
 	case '<':
-		lookahead := l.lookahead(1)
-		switch lookahead {
-		case '=':
-			l.tokens = append(l.tokens, l.newToken(LessEqual))
-			l.advance(2)
-			return true
-		default:
-			l.tokens = append(l.tokens, l.newToken(Less))
+		if l.atHeredoc() {
+			return l.lexHeredoc()
+		} else if l.match("<<") {
+			return l.lexOperator(ShiftLeft, 2)
+		} else if l.match("<=") {
+			return l.lexOperator(LessEqual, 2)
 		}
+		return l.lexOperator(Less, 1)
 	case '=':
-		lookahead := l.lookahead(1)
-		switch lookahead {
-		case '=':
-			l.tokens = append(l.tokens, l.newToken(Equal))
-			l.advance(2)
-			return true
-		default:
-			l.tokens = append(l.tokens, l.newToken(Assign))
+		if l.match("=>") {
+			return l.lexOperator(FatArrow, 2)
+		} else if l.match("==") {
+			return l.lexOperator(Equal, 2)
 		}
+		return l.lexOperator(Assign, 1)
 	default:
-		if unicode.IsLetter(c) {
+		if unicode.IsLetter(c) || c == '_' {
 			return l.lexIdentifier()
 		} else if unicode.IsDigit(c) {
 			return l.lexNumber()
 		} else if c == '"' {
 			return l.lexString()
+		} else if c == '\'' {
+			return l.lexChar()
+		} else if c == '@' {
+			return l.lexAnnotation()
+		} else if c == '`' {
+			return l.lexEscapedIdentifier()
 		}
-		l.tokens = append(l.tokens, l.newToken(Error))
+		return l.lexUnknown()
 	}
-	l.position++
+	l.advance(1)
 	return true
 }
 
+// lexUnknown scans the run of characters that
+// can't start any token, and reports them, as
+// a single error token and diagnostic, so the
+// lexer recovers at the next valid character.
+func (l *lexer) lexUnknown() bool {
+	l.advance(1) // skip the first character
+	for !l.eof() && isUnknown(l.peek()) {
+		l.advance(1)
+	}
+
+	text := l.input[l.start:l.position]
+	message := "unexpected character"
+	if !utf8.ValidString(text) {
+		message = "invalid UTF-8 encoding, unexpected bytes"
+	} else if utf8.RuneCountInString(text) > 1 {
+		message = "unexpected characters"
+	}
+	l.report(unexpectedCharacterCode, NewText(message), NewCode(strings.Trim(strconv.QuoteToGraphic(text), `"`)))
+
+	l.emit(l.newToken(Error))
+	return true
+}
+
+// checkSize reports the input that is larger
+// than the MaxInputSize option, as a single
+// error token, without reading the rest of it.
+// It returns false if the input can't be lexed.
+func (l *lexer) checkSize() bool {
+	max := l.options.MaxInputSize
+	if max <= 0 || !l.fill(max+1) {
+		return true
+	}
+
+	l.reader = nil // stop reading the input
+	return l.skipRest(limitCode, NewText("the input is larger than the limit of"), NewCode(strconv.Itoa(max)), NewText("bytes"))
+}
+
+// detectEncoding skips the UTF-8 byte order
+// mark, keeping it as trivia, and reports the
+// inputs encoded in UTF-16, as a single error
+// token. It returns false if the input can't
+// be lexed.
+func (l *lexer) detectEncoding() bool {
+	if l.match(byteOrderMark) {
+		l.advance(1)
+		return true
+	}
+
+	// The UTF-16 inputs either start with their byte order
+	// mark, or have a null byte in the first characters.
+	if !l.match("\xFE\xFF") && !l.match("\xFF\xFE") && !(l.fill(2) && (l.input[0] == 0 || l.input[1] == 0)) {
+		return true
+	}
+	return l.skipRest(encodingCode, NewText("the input is encoded in UTF-16, expected UTF-8"))
+}
+
+// skipRest reports the given error, and emits the
+// rest of the input as an Error token, followed by
+// the EOF, so the lexing stops.
+func (l *lexer) skipRest(code string, text ...ErrorText) bool {
+	for !l.eof() {
+		l.position = len(l.input)
+	}
+	l.report(code, text...)
+	l.emit(l.newToken(Error))
+
+	l.start = l.position
+	l.emit(l.newToken(EOF))
+	return false
+}
+
+// atStart returns true if the lexer position
+// is at the start of the input, after the
+// byte order mark.
+func (l *lexer) atStart() bool {
+	return l.position == 0 || (l.position == len(byteOrderMark) && strings.HasPrefix(l.input, byteOrderMark))
+}
+
+// lexWhitespace scans the input and returns
+// the whitespace token, that holds a run of
+// spaces, and newlines when they aren't
+// emitted as tokens.
+func (l *lexer) lexWhitespace() bool {
+	for !l.eof() && isWhitespace(l.peek()) && (l.peek() != '\n' || !l.options.EmitNewlines) {
+		l.advance(1)
+	}
+
+	l.emit(l.newToken(Whitespace))
+	return true
+}
+
+// lexNewline scans the input and returns the
+// newline token, that holds the blank lines
+// following it too, so a single token ends
+// the statement.
+func (l *lexer) lexNewline() bool {
+	end := l.position
+	for !l.eof() && unicode.IsSpace(l.peek()) {
+		l.advance(1)
+		if l.input[l.position-1] == '\n' {
+			end = l.position
+		}
+	}
+	l.position = end
+
+	l.emit(l.newToken(Newline))
+	return true
+}
+
+// lexOperator advances the lexer over the
+// operator with the given width, and appends
+// its token.
+func (l *lexer) lexOperator(kind TokenKind, width int) bool {
+	l.advance(width)
+	l.emit(l.newToken(kind))
+	return true
+}
+
+// emit appends the given token, attaching
+// the trivia that precedes it to its full
+// text.
+func (l *lexer) emit(token Token) {
+	if l.options.EmitIndents && !token.Kind.IsTrivia() {
+		l.indent(token)
+	}
+	token.FullText = l.input[l.trivia:l.position]
+	l.tokens = append(l.tokens, token)
+	l.trivia = l.position
+	l.emitted++
+	if !token.Kind.IsTrivia() {
+		l.previous = token.Kind
+	}
+}
+
+// indent emits the Indent or Dedent tokens
+// before the given token, if it's the first
+// token of its line.
+func (l *lexer) indent(token Token) {
+	first := l.indents == nil
+	if first {
+		l.indents = []int{0}
+	}
+
+	gap := l.input[l.last:token.start]
+	l.last = token.end
+	newline := strings.LastIndexByte(gap, '\n')
+	if newline < 0 && !first && token.Kind != EOF {
+		return
+	}
+
+	column := 0
+	if token.Kind != EOF {
+		column = utf8.RuneCountInString(strings.TrimPrefix(gap[newline+1:], byteOrderMark))
+	}
+
+	top := l.indents[len(l.indents)-1]
+	if column > top {
+		l.indents = append(l.indents, column)
+		l.tokens = append(l.tokens, Token{Kind: Indent, file: l.file, start: token.start, end: token.start})
+		return
+	}
+	for column < top {
+		l.indents = l.indents[:len(l.indents)-1]
+		l.tokens = append(l.tokens, Token{Kind: Dedent, file: l.file, start: token.start, end: token.start})
+		top = l.indents[len(l.indents)-1]
+	}
+	if column != top {
+		l.report(indentationCode, NewText("inconsistent indentation, expected a column of"), NewCode(strconv.Itoa(top)))
+	}
+}
+
+// skipLineComment skips the comment that
+// goes until the end of the line, keeping
+// it as trivia of the next token, unless
+// the trivia is emitted.
+func (l *lexer) skipLineComment() bool {
+	for !l.eof() && l.peek() != '\n' {
+		l.advance(1)
+	}
+	return l.emitComment()
+}
+
+// skipBlockComment skips the comment that
+// goes until the closing `*/`, keeping it
+// as trivia of the next token, unless the
+// trivia is emitted.
+func (l *lexer) skipBlockComment() bool {
+	l.advance(2) // skip the opening
+	for !l.eof() && !l.match("*/") {
+		l.advance(1)
+	}
+
+	if l.eof() {
+		l.report(unterminatedCode, NewText("unterminated block comment, expected"), NewCode("*/"))
+		return l.emitComment()
+	}
+	l.advance(2)
+	return l.emitComment()
+}
+
+// emitComment emits the comment that was
+// skipped as a token, if the trivia should
+// be emitted.
+func (l *lexer) emitComment() bool {
+	l.checkLength("comment")
+	if l.options.EmitTrivia {
+		l.emit(l.newToken(Comment))
+	}
+	return true
+}
+
+// checkLength reports the token that was scanned,
+// like the given string or comment, if it's longer
+// than the MaxTokenLength option.
+func (l *lexer) checkLength(name string) {
+	if max := l.options.MaxTokenLength; max > 0 && l.position-l.start > max {
+		l.report(limitCode, NewText("the "+name+" is longer than the limit of"), NewCode(strconv.Itoa(max)), NewText("bytes"))
+	}
+}
+
+// keyword returns the token kind of the given
+// identifier, if it's a keyword.
+func (l *lexer) keyword(identifier string) (TokenKind, bool) {
+	table := l.options.Keywords
+	if table == nil {
+		table = keywords
+	}
+	if l.options.CaseInsensitive {
+		identifier = strings.ToLower(identifier)
+	}
+
+	kind, ok := table[identifier]
+	return kind, ok
+}
+
 // newToken creates a new token with the given
 // lexer state and kind.
-func (l *lexer) newToken(kind int) Token {
+func (l *lexer) newToken(kind TokenKind) Token {
 	text := l.input[l.start:l.position]
 
 	// build the token
 	token := NewToken(kind, text, text)
-	token.location = l.location()
+	token.file = l.file
+	token.start = l.start
+	token.end = l.position
 	return token
 }
 
@@ -366,92 +706,749 @@ func (l *lexer) lexIdentifier() bool {
 	identifier := l.input[l.start:l.position]
 
 	// Check if the identifier is a keyword.
-	if keyword, ok := keywords[identifier]; ok {
-		l.tokens = append(l.tokens, l.newToken(keyword))
+	kind := Identifier
+	if keyword, ok := l.keyword(identifier); ok {
+		kind = keyword
+	}
+
+	token := l.newToken(kind)
+	token.Text = l.intern(token.Text)
+	l.emit(token)
+	return true
+}
+
+// intern returns the interned copy of the given
+// text, if the lexer has an interner.
+func (l *lexer) intern(text string) string {
+	if l.options.Interner == nil {
+		return text
+	}
+	return l.options.Interner.Intern(text).String()
+}
+
+// lexEscapedIdentifier scans the input and
+// returns the identifier token escaped with
+// backticks, like `fun`, so keywords can be
+// used as names. The token text is the name
+// without the backticks, that can't span
+// multiple lines.
+func (l *lexer) lexEscapedIdentifier() bool {
+	l.advance(1) // skip the opening backtick
+
+	for !l.eof() && l.peek() != '`' && l.peek() != '\n' {
+		l.advance(1)
+	}
+
+	token := l.newToken(Identifier)
+	token.Text = l.intern(l.input[l.start+1 : l.position])
+	if l.eof() || l.peek() != '`' {
+		l.report(unterminatedCode, NewText("unterminated escaped identifier, expected"), NewCode("`"))
 	} else {
-		l.tokens = append(l.tokens, l.newToken(Identifier))
+		l.advance(1) // skip the closing backtick
+		token.end = l.position
+	}
+	if token.Text == "" {
+		l.report(malformedTokenCode, NewText("escaped identifier can't be empty"))
+	}
+
+	l.emit(token)
+	return true
+}
+
+// lexAnnotation scans the input and returns
+// the annotation token, like `@inline`, the
+// token text is the name without the `@`.
+func (l *lexer) lexAnnotation() bool {
+	l.advance(1) // skip the at sign
+
+	if l.eof() || !unicode.IsLetter(l.peek()) {
+		l.report(malformedTokenCode, NewText("expected annotation name after"), NewCode("@"))
+	}
+	for !l.eof() && isIdentifierSegment(l.peek()) {
+		l.advance(1)
 	}
 
+	token := l.newToken(Annotation)
+	token.Text = l.intern(l.input[l.start+1 : l.position])
+
+	l.emit(token)
 	return true
 }
 
 // lexString scans the input and returns
 // the string token.
+//
+// A string can't span multiple lines, for
+// that, the raw string syntax should be used.
+// The token text has the escapes decoded.
 func (l *lexer) lexString() bool {
+	if l.match(`"""`) {
+		return l.lexRawString()
+	}
+
 	l.advance(1) // skip the first quote
-	for !l.eof() && l.peek() != '"' {
-		l.advance(1)
+	text, _ := l.lexQuoted('"')
+	if l.match("${") {
+		l.advance(2)
+		token := l.newStringToken(1, 2)
+		token.Kind, token.Text = StringStart, text
+		l.templates = append(l.templates, 0)
+		l.emit(token)
+		return true
+	}
+
+	if l.eof() || l.peek() != '"' {
+		l.report(unterminatedCode, NewText("unterminated string literal, expected"), NewCode(`"`))
+		token := l.newStringToken(1, 0)
+		token.Text = text
+		l.emit(token)
+		return true
 	}
 	l.advance(1)
 
-	// build the token of string
-	text := l.input[l.start+1 : l.position-1]
-	fullText := l.input[l.start:l.position]
-	token := NewToken(String, text, fullText)
-	token.location = l.location()
+	token := l.newStringToken(1, 1)
+	token.Text = text
+	l.emit(token)
+	return true
+}
 
-	l.tokens = append(l.tokens, token)
+// lexTemplate scans the input after the `}` that
+// closes an interpolation, and returns either the
+// middle segment, that opens another interpolation,
+// like `} and ${`, or the end segment of the string,
+// like `} end"`.
+func (l *lexer) lexTemplate() bool {
+	l.advance(1) // skip the brace
+	text, _ := l.lexQuoted('"')
+	if l.match("${") {
+		l.advance(2)
+		token := l.newStringToken(1, 2)
+		token.Kind, token.Text = StringMiddle, text
+		l.emit(token)
+		return true
+	}
+
+	l.templates = l.templates[:len(l.templates)-1]
+	close := 0
+	if l.eof() || l.peek() != '"' {
+		l.report(unterminatedCode, NewText("unterminated string literal, expected"), NewCode(`"`))
+	} else {
+		l.advance(1)
+		close = 1
+	}
+	token := l.newStringToken(1, close)
+	token.Kind, token.Text = StringEnd, text
+	l.emit(token)
+	return true
+}
+
+// lexRawString scans the input and returns
+// the raw string token.
+//
+// A raw string is delimited by triple quotes,
+// it can span multiple lines and it has no
+// escape processing.
+func (l *lexer) lexRawString() bool {
+	l.advance(3) // skip the first quotes
+	for !l.eof() && !l.match(`"""`) {
+		l.advance(1)
+	}
+
+	if l.eof() {
+		l.report(unterminatedCode, NewText("unterminated raw string literal, expected"), NewCode(`"""`))
+		l.emit(l.newStringToken(3, 0))
+		return true
+	}
+	l.advance(3)
+
+	l.emit(l.newStringToken(3, 3))
+	return true
+}
+
+// atHeredoc returns true if the lexer is at
+// the start of a heredoc, like `<<EOF`, that
+// is told apart from a left shift, as the tag
+// ends the line, and it can't follow operands,
+// like in `x <<EOF`.
+func (l *lexer) atHeredoc() bool {
+	if !l.match("<<") || !unicode.IsLetter(l.lookahead(2)) {
+		return false
+	}
+	switch l.previous {
+	case Identifier, Decimal, Int, String, Char, RightParen, RightBracket:
+		return false
+	}
+
+	n := 3
+	for isIdentifierSegment(l.lookahead(n)) {
+		n++
+	}
+	for c := l.lookahead(n); c == ' ' || c == '\t' || c == '\r'; c = l.lookahead(n) {
+		n++
+	}
+	return l.lookahead(n) == '\n'
+}
+
+// lexHeredoc scans the input and returns the
+// heredoc string token, like:
+//
+//	<<SQL
+//	select * from users
+//	SQL
+//
+// The text goes from the line after the tag
+// until the line that holds only the tag, and
+// the token text is the lines in between.
+func (l *lexer) lexHeredoc() bool {
+	l.advance(2) // skip the `<<`
+	begin := l.position
+	for !l.eof() && isIdentifierSegment(l.peek()) {
+		l.advance(1)
+	}
+	tag := l.input[begin:l.position]
+	for !l.eof() && l.peek() != '\n' {
+		l.advance(1)
+	}
+	l.advance(1) // skip the newline
+
+	body := l.position
+	for {
+		line := l.position
+		for !l.eof() && l.peek() != '\n' {
+			l.advance(1)
+		}
+
+		if strings.TrimSpace(l.input[line:l.position]) == tag {
+			token := l.newToken(String)
+			token.Text = l.input[body:max(body, line-1)]
+			l.emit(token)
+			return true
+		}
+		if l.eof() {
+			l.report(unterminatedCode, NewText("unterminated heredoc, expected a line with"), NewCode(tag))
+			token := l.newToken(String)
+			token.Text = l.input[body:l.position]
+			l.emit(token)
+			return true
+		}
+		l.advance(1)
+	}
+}
+
+// newStringToken creates a new string token,
+// without the opening and closing delimiters
+// on the text.
+func (l *lexer) newStringToken(open, close int) Token {
+	l.checkLength("string literal")
+	token := l.newToken(String)
+	token.Text = l.input[l.start+open : l.position-close]
+	return token
+}
+
+// lexChar scans the input and returns
+// the char token.
+//
+// A char literal holds exactly one rune,
+// that can be written as an escape, and
+// the token text is the decoded rune.
+func (l *lexer) lexChar() bool {
+	l.advance(1) // skip the first quote
+	text, count := l.lexQuoted('\'')
+
+	if l.eof() || l.peek() != '\'' {
+		l.report(unterminatedCode, NewText("unterminated char literal, expected"), NewCode("'"))
+	} else {
+		l.advance(1)
+	}
+
+	if count != 1 {
+		l.report(malformedTokenCode, NewText("char literal must contain exactly one rune"))
+	}
+
+	token := l.newToken(Char)
+	token.Text = text
+
+	l.emit(token)
 	return true
 }
 
+// lexQuoted scans the contents of a string or
+// char literal, until the given closing quote
+// or the end of the line, and returns the text
+// with the escapes decoded, and its rune count.
+func (l *lexer) lexQuoted(quote rune) (string, int) {
+	// The decoded value is only built when there are
+	// escapes, otherwise the text is a view of the input.
+	begin := l.position
+	count, escaped := 0, false
+	var value strings.Builder
+	for !l.eof() && l.peek() != quote && l.peek() != '\n' {
+		if quote == '"' && l.match("${") {
+			break
+		}
+		count++
+		if l.peek() == '\\' {
+			if !escaped {
+				value.WriteString(l.input[begin:l.position])
+				escaped = true
+			}
+			value.WriteRune(l.lexEscape())
+			continue
+		}
+		if escaped {
+			value.WriteRune(l.peek())
+		}
+		l.advance(1)
+	}
+
+	if escaped {
+		return value.String(), count
+	}
+	return l.input[begin:l.position], count
+}
+
+// lexEscape scans an escape sequence, that
+// starts with a backslash, and returns the
+// rune it represents. The diagnostics point
+// at the escape, instead of the literal.
+func (l *lexer) lexEscape() rune {
+	begin := l.position
+	l.advance(1) // skip the backslash
+	if l.eof() {
+		l.reportAt(begin, invalidEscapeCode, NewText("unterminated escape sequence"))
+		return utf8.RuneError
+	}
+
+	c := l.peek()
+	l.advance(1)
+	switch c {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case '0':
+		return 0
+	case '\\', '\'', '"', '$':
+		return c
+	case 'u':
+		return l.lexUnicodeEscape(begin)
+	}
+
+	l.reportAt(begin, invalidEscapeCode, NewText("unknown escape sequence"), NewCode("\\"+string(c)))
+	return c
+}
+
+// lexUnicodeEscape scans the `{...}` part of
+// an unicode escape sequence, that starts at
+// the given offset, and holds the hexadecimal
+// code point, that must be a valid Unicode
+// scalar value, so not a surrogate.
+func (l *lexer) lexUnicodeEscape(begin int) rune {
+	if l.eof() || l.peek() != '{' {
+		l.reportAt(begin, invalidEscapeCode, NewText("expected"), NewCode("{"), NewText("after unicode escape"))
+		return utf8.RuneError
+	}
+	l.advance(1)
+
+	start := l.position
+	for !l.eof() && isHexDigit(l.peek()) {
+		l.advance(1)
+	}
+	digits := l.input[start:l.position]
+
+	if l.eof() || l.peek() != '}' {
+		l.reportAt(begin, invalidEscapeCode, NewText("unterminated unicode escape, expected"), NewCode("}"))
+		return utf8.RuneError
+	}
+	l.advance(1)
+
+	if digits == "" {
+		l.reportAt(begin, invalidEscapeCode, NewText("empty unicode escape, expected hexadecimal digits"))
+		return utf8.RuneError
+	} else if len(digits) > 6 {
+		l.reportAt(begin, invalidEscapeCode, NewText("unicode escape must have at most 6 hexadecimal digits"))
+		return utf8.RuneError
+	}
+
+	value, _ := strconv.ParseUint(digits, 16, 32)
+	switch {
+	case value > unicode.MaxRune:
+		l.reportAt(begin, invalidEscapeCode, NewText("unicode escape out of range, the maximum is"), NewCode(`\u{10FFFF}`))
+		return utf8.RuneError
+	case value >= 0xD800 && value <= 0xDFFF:
+		l.reportAt(begin, invalidEscapeCode, NewText("unicode escape can't be a surrogate"), NewCode(l.input[begin:l.position]))
+		return utf8.RuneError
+	}
+	return rune(value)
+}
+
+// Number states. This defines the states of
+// the number lexing state machine, in the
+// order they can happen in a literal.
+const (
+	numberInt = iota
+	numberFraction
+	numberExponent
+	numberSuffix
+	numberEnd
+)
+
 // lexNumber scans the input and returns
 // the number token.
 //
 // The number token can be a decimal or
-// an integer.
+// an integer, and it's recognized by a state
+// machine going over the integer, fraction,
+// exponent and suffix parts of the literal.
 func (l *lexer) lexNumber() bool {
-	l.advance(1) // skip the first digit
-	for !l.eof() && unicode.IsDigit(l.peek()) {
-		l.advance(1)
+	if l.peek() == '0' {
+		switch l.lookahead(1) {
+		case 'x', 'X':
+			return l.lexRadixNumber(16)
+		case 'o', 'O':
+			return l.lexRadixNumber(8)
+		case 'b', 'B':
+			return l.lexRadixNumber(2)
+		}
+	}
 
-		if !l.eof() && l.peek() == '.' {
-			l.advance(1)
-			for !l.eof() && unicode.IsDigit(l.peek()) {
+	kind := Int
+	end := l.position
+	for state := numberInt; state != numberEnd; {
+		switch state {
+		case numberInt:
+			for !l.eof() && isDigitSegment(l.peek()) {
 				l.advance(1)
 			}
-			l.tokens = append(l.tokens, l.newToken(Decimal))
-			break
+			state = numberFraction
+		case numberFraction:
+			// The dot is only part of the number if a digit
+			// follows it, so `1.foo` and `1..2` keep their
+			// dots as separate tokens.
+			if !l.eof() && l.peek() == '.' && unicode.IsDigit(l.lookahead(1)) {
+				l.advance(1)
+				for !l.eof() && isDigitSegment(l.peek()) {
+					l.advance(1)
+				}
+				kind = Decimal
+			}
+			state = numberExponent
+		case numberExponent:
+			if l.lexExponent() {
+				kind = Decimal
+			}
+			state = numberSuffix
+		case numberSuffix:
+			end = l.position
+			for !l.eof() && isSuffixSegment(l.peek()) {
+				l.advance(1)
+			}
+			state = numberEnd
 		}
 	}
-	l.tokens = append(l.tokens, l.newToken(Int))
+
+	token := l.newToken(kind)
+	token.Text = l.stripSeparators(l.input[l.start:end], ".eE+-")
+	token.Suffix = l.numberSuffix(kind, l.input[end:l.position])
+	if kind == Int {
+		token.Base = 10
+	}
+
+	l.emit(token)
 	return true
 }
 
-// advance advances the lexer position.
+// lexExponent scans the exponent part of a
+// number, like `e-3`, if there's one, and
+// returns true if it was found.
+func (l *lexer) lexExponent() bool {
+	if l.eof() || (l.peek() != 'e' && l.peek() != 'E') {
+		return false
+	}
+
+	// the exponent sign is optional, and the separators
+	// before the digits are reported, like in `1e_5`
+	digits := 1
+	if l.lookahead(1) == '+' || l.lookahead(1) == '-' {
+		digits = 2
+	}
+	separators := 0
+	for l.lookahead(digits+separators) == '_' {
+		separators++
+	}
+	if !unicode.IsDigit(l.lookahead(digits + separators)) {
+		return false
+	}
+
+	l.advance(digits)
+	for !l.eof() && isDigitSegment(l.peek()) {
+		l.advance(1)
+	}
+	return true
+}
+
+// lexRadixNumber scans the input and returns
+// the integer token, written with a prefix
+// like `0x`, in the given base.
+func (l *lexer) lexRadixNumber(base int) bool {
+	l.advance(2) // skip the prefix
+	for !l.eof() && (l.peek() == '_' || isDigitOf(l.peek(), base)) {
+		l.advance(1)
+	}
+
+	// The rest of the segment is either a suffix, like
+	// in `0xFFu8`, or digits that are invalid in the base,
+	// that are reported once for the whole literal, and
+	// left out of the text, so `0xFG` has the text `F`.
+	end := l.position
+	for !l.eof() && isSuffixSegment(l.peek()) {
+		l.advance(1)
+	}
+	rest := l.input[end:l.position]
+	invalid := false
+	if _, ok := numberSuffixes[rest]; !ok && rest != "" {
+		digits := strings.Map(func(c rune) rune {
+			if c == '_' || isDigitOf(c, base) {
+				return -1
+			}
+			return c
+		}, rest)
+		if utf8.RuneCountInString(digits) == 1 {
+			l.report(malformedNumberCode, NewText(fmt.Sprintf("invalid digit for a base %d literal", base)), NewCode(digits))
+		} else {
+			l.report(malformedNumberCode, NewText(fmt.Sprintf("invalid digits for a base %d literal", base)), NewCode(digits))
+		}
+		rest, invalid = "", true
+	}
+
+	text := l.stripSeparators(l.input[l.start+2:end], "")
+	switch {
+	case text == "" && invalid:
+		l.report(malformedNumberCode, NewText("no valid digits after the prefix"), NewCode(l.input[l.start:l.start+2]))
+	case text == "":
+		l.report(malformedNumberCode, NewText("expected digits after the prefix"), NewCode(l.input[l.start:l.position]))
+	}
+
+	token := l.newToken(Int)
+	token.Text = text
+	token.Base = base
+	token.Suffix = l.numberSuffix(Int, rest)
+
+	l.emit(token)
+	return true
+}
+
+// numberSuffixes holds the type suffixes of the
+// number literals, and if they are only valid on
+// integers.
+var numberSuffixes = map[string]bool{
+	"i8": true, "i16": true, "i32": true, "i64": true,
+	"u": true, "u8": true, "u16": true, "u32": true, "u64": true,
+	"f32": false, "f64": false,
+}
+
+// numberSuffix reports the given suffix of a number
+// literal of the given kind, if it isn't valid, and
+// returns it, or an empty string if it's invalid.
+func (l *lexer) numberSuffix(kind TokenKind, suffix string) string {
+	if suffix == "" {
+		return ""
+	}
+
+	integer, ok := numberSuffixes[suffix]
+	if !ok {
+		l.report(malformedNumberCode, NewText("invalid suffix on number literal"), NewCode(suffix))
+		return ""
+	}
+	if integer && kind == Decimal {
+		l.report(malformedNumberCode, NewText("integer suffix on a decimal literal"), NewCode(suffix))
+		return ""
+	}
+	return suffix
+}
+
+// stripSeparators reports the misplaced digit
+// separators in the given number text, and
+// returns it without the separators.
+//
+// The separators should be placed between
+// digits, like `1_000`, so they can't be next
+// to the given marks, like the dot and the
+// exponent marker in `1_.5` and `1e_5`.
+func (l *lexer) stripSeparators(text, marks string) string {
+	if !strings.Contains(text, "_") {
+		return text
+	}
+
+	for _, digits := range strings.FieldsFunc(text, func(c rune) bool { return strings.ContainsRune(marks, c) }) {
+		switch {
+		case strings.HasPrefix(digits, "_"):
+			l.report(malformedNumberCode, NewText("digit separator can't be at the start of a number"))
+		case strings.HasSuffix(digits, "_"):
+			l.report(malformedNumberCode, NewText("digit separator can't be at the end of a number"))
+		case strings.Contains(digits, "__"):
+			l.report(malformedNumberCode, NewText("digit separators can't be consecutive"))
+		}
+	}
+
+	return strings.ReplaceAll(text, "_", "")
+}
+
+// advance advances the lexer position by the
+// given amount of runes.
+//
+// The position is a byte offset, so it moves
+// by the UTF-8 width of each rune.
 func (l *lexer) advance(amount int) {
-	l.position += amount
+	for ; amount > 0 && !l.eof(); amount-- {
+		if l.input[l.position] < utf8.RuneSelf {
+			l.position++
+			continue
+		}
+
+		l.fill(utf8.UTFMax)
+		_, size := utf8.DecodeRuneInString(l.input[l.position:])
+		l.position += size
+	}
 }
 
-// peek returns the rune that is
-// at the lexer position.
+// eofRune is the sentinel that is returned
+// by peek and lookahead at the end of the
+// input, that isn't a valid rune, so it
+// never matches any character.
+const eofRune rune = -1
+
+// peek returns the rune that is at the
+// lexer position, or eofRune at the end
+// of the input.
 func (l *lexer) peek() rune {
-	return rune(l.input[l.position])
+	if l.position < len(l.input) && l.input[l.position] < utf8.RuneSelf {
+		return rune(l.input[l.position])
+	}
+
+	if !l.fill(1) {
+		return eofRune
+	}
+	l.fill(utf8.UTFMax)
+	r, _ := utf8.DecodeRuneInString(l.input[l.position:])
+	return r
+}
+
+// match returns true if the input at the
+// lexer position starts with the given text.
+func (l *lexer) match(text string) bool {
+	l.fill(len(text))
+	return strings.HasPrefix(l.input[l.position:], text)
 }
 
 // eof returns true if the lexer
 // position is at the end of the
 // input.
 func (l *lexer) eof() bool {
-	return l.position >= len(l.input)
+	return !l.fill(1)
 }
 
-// lookahead returns the rune that is
-// ahead of the lexer position.
+// lookahead returns the rune that is the
+// given amount of runes ahead of the lexer
+// position, or eofRune if it's past the end
+// of the input, so it never goes out of the
+// bounds of the input.
 func (l *lexer) lookahead(amount int) rune {
-	return rune(l.input[l.position+amount])
+	l.fill((amount + 1) * utf8.UTFMax)
+	position := l.position
+	for ; amount > 0 && position < len(l.input); amount-- {
+		_, size := utf8.DecodeRuneInString(l.input[position:])
+		position += size
+	}
+
+	if position >= len(l.input) {
+		return eofRune
+	}
+	r, _ := utf8.DecodeRuneInString(l.input[position:])
+	return r
+}
+
+// report adds a lexer diagnostic, at the
+// current token location.
+func (l *lexer) report(code string, text ...ErrorText) {
+	l.errors = append(l.errors, NewDiagnostic(LexerError, ErrorSeverity, code, l.location(), text...))
+}
+
+// reportAt adds a lexer diagnostic, from the
+// given offset to the lexer position.
+func (l *lexer) reportAt(start int, code string, text ...ErrorText) {
+	l.errors = append(l.errors, NewDiagnostic(LexerError, ErrorSeverity, code, lexerLocation{start: start, end: l.position, file: l.file}, text...))
 }
 
 func (l *lexer) location() Location {
 	return lexerLocation{
 		start: l.start,
 		end:   l.position,
-		text:  l.input,
-		file:  l.filename,
+		file:  l.file,
+	}
+}
+
+// byteOrderMark is the UTF-8 encoding of the
+// byte order mark, that some editors write at
+// the start of the files.
+const byteOrderMark = "\uFEFF"
+
+// punctuation holds the characters, besides
+// letters, digits and whitespaces, that can
+// start a token.
+const punctuation = "%.,:;{}[]()+-*/|&?^~!<>=\"'@`#"
+
+// isUnknown returns true if the given rune
+// can't start any token.
+func isUnknown(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && !isWhitespace(r) && !strings.ContainsRune(punctuation, r)
+}
+
+// isWhitespace returns true if the given rune
+// is a whitespace that separates tokens.
+func isWhitespace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+// isHexDigit returns true if the given rune
+// is a valid hexadecimal digit.
+func isHexDigit(r rune) bool {
+	return unicode.IsDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+// isDigitOf returns true if the given rune is
+// a valid digit in the given base.
+func isDigitOf(r rune, base int) bool {
+	switch base {
+	case 2:
+		return r == '0' || r == '1'
+	case 8:
+		return r >= '0' && r <= '7'
+	case 16:
+		return isHexDigit(r)
 	}
+	return unicode.IsDigit(r)
+}
+
+// isDigitSegment returns true if the given
+// rune is a valid decimal number segment.
+func isDigitSegment(r rune) bool {
+	return unicode.IsDigit(r) || r == '_'
+}
+
+// isSuffixSegment returns true if the given
+// rune is a valid number suffix segment.
+func isSuffixSegment(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
 }
 
 // isIdentifierSegment returns true if the
 // given rune is a valid identifier segment.
+//
+// The dot isn't part of identifiers, so it
+// can be lexed as member access or range.
 func isIdentifierSegment(r rune) bool {
-	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '\''
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '\''
 }
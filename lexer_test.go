@@ -0,0 +1,235 @@
+package tonho_test
+
+import (
+	"slices"
+	"testing"
+
+	"tonho"
+)
+
+// lexed lexes the input, and returns the kinds and the
+// texts of its tokens, without the EOF, failing the test
+// on any diagnostic.
+func lexed(t *testing.T, input string) ([]tonho.TokenKind, []string) {
+	t.Helper()
+	tokens, diagnostics := tonho.Lex("test", input)
+	if len(diagnostics) > 0 {
+		t.Fatalf("lexing %q: %v", input, diagnostics)
+	}
+	if len(tokens) == 0 || tokens[len(tokens)-1].Kind != tonho.EOF {
+		t.Fatalf("lexing %q: the tokens don't end with EOF", input)
+	}
+	var kinds []tonho.TokenKind
+	var texts []string
+	for _, token := range tokens[:len(tokens)-1] {
+		kinds = append(kinds, token.Kind)
+		texts = append(texts, token.Text)
+	}
+	return kinds, texts
+}
+
+func TestLexOperators(t *testing.T) {
+	tests := []struct {
+		input string
+		kinds []tonho.TokenKind
+		texts []string
+	}{
+		{"+", []tonho.TokenKind{tonho.Plus}, []string{"+"}},
+		{"-", []tonho.TokenKind{tonho.Minus}, []string{"-"}},
+		{"*", []tonho.TokenKind{tonho.Asterisk}, []string{"*"}},
+		{"/", []tonho.TokenKind{tonho.Slash}, []string{"/"}},
+		{"%", []tonho.TokenKind{tonho.Percent}, []string{"%"}},
+		{"==", []tonho.TokenKind{tonho.Equal}, []string{"=="}},
+		{"!=", []tonho.TokenKind{tonho.NotEqual}, []string{"!="}},
+		{"<", []tonho.TokenKind{tonho.Less}, []string{"<"}},
+		{"<=", []tonho.TokenKind{tonho.LessEqual}, []string{"<="}},
+		{">", []tonho.TokenKind{tonho.Greater}, []string{">"}},
+		{">=", []tonho.TokenKind{tonho.GreaterEqual}, []string{">="}},
+		{"&&", []tonho.TokenKind{tonho.And}, []string{"&&"}},
+		{"||", []tonho.TokenKind{tonho.Or}, []string{"||"}},
+		{"!", []tonho.TokenKind{tonho.Not}, []string{"!"}},
+		{"&", []tonho.TokenKind{tonho.BitAnd}, []string{"&"}},
+		{"|", []tonho.TokenKind{tonho.BitOr}, []string{"|"}},
+		{"^", []tonho.TokenKind{tonho.BitXor}, []string{"^"}},
+		{"~", []tonho.TokenKind{tonho.BitNot}, []string{"~"}},
+		{"<<", []tonho.TokenKind{tonho.ShiftLeft}, []string{"<<"}},
+		{">>", []tonho.TokenKind{tonho.ShiftRight}, []string{">>"}},
+		{"|>", []tonho.TokenKind{tonho.Pipeline}, []string{"|>"}},
+		{"=", []tonho.TokenKind{tonho.Assign}, []string{"="}},
+		{"+=", []tonho.TokenKind{tonho.PlusAssign}, []string{"+="}},
+		{"-=", []tonho.TokenKind{tonho.MinusAssign}, []string{"-="}},
+		{"*=", []tonho.TokenKind{tonho.AsteriskAssign}, []string{"*="}},
+		{"/=", []tonho.TokenKind{tonho.SlashAssign}, []string{"/="}},
+		{"%=", []tonho.TokenKind{tonho.PercentAssign}, []string{"%="}},
+		{".", []tonho.TokenKind{tonho.Dot}, []string{"."}},
+		{"..", []tonho.TokenKind{tonho.Range}, []string{".."}},
+		{"..=", []tonho.TokenKind{tonho.RangeInclusive}, []string{"..="}},
+		{"...", []tonho.TokenKind{tonho.Spread}, []string{"..."}},
+		{"?", []tonho.TokenKind{tonho.Question}, []string{"?"}},
+		{"?.", []tonho.TokenKind{tonho.SafeDot}, []string{"?."}},
+		{"?:", []tonho.TokenKind{tonho.Elvis}, []string{"?:"}},
+		{"->", []tonho.TokenKind{tonho.Arrow}, []string{"->"}},
+		{"=>", []tonho.TokenKind{tonho.FatArrow}, []string{"=>"}},
+		{"#{", []tonho.TokenKind{tonho.HashBrace}, []string{"#{"}},
+
+		// The longest operator wins, and the rest is lexed
+		// as the next operator.
+		{">>=", []tonho.TokenKind{tonho.ShiftRight, tonho.Assign}, []string{">>", "="}},
+		{"..<", []tonho.TokenKind{tonho.Range, tonho.Less}, []string{"..", "<"}},
+		{"....", []tonho.TokenKind{tonho.Spread, tonho.Dot}, []string{"...", "."}},
+		{"|>>", []tonho.TokenKind{tonho.Pipeline, tonho.Greater}, []string{"|>", ">"}},
+		{"|||", []tonho.TokenKind{tonho.Or, tonho.BitOr}, []string{"||", "|"}},
+		{"->>", []tonho.TokenKind{tonho.Arrow, tonho.Greater}, []string{"->", ">"}},
+		{"-->", []tonho.TokenKind{tonho.Minus, tonho.Arrow}, []string{"-", "->"}},
+		{"=>=", []tonho.TokenKind{tonho.FatArrow, tonho.Assign}, []string{"=>", "="}},
+		{"===", []tonho.TokenKind{tonho.Equal, tonho.Assign}, []string{"==", "="}},
+		{"?.:", []tonho.TokenKind{tonho.SafeDot, tonho.Colon}, []string{"?.", ":"}},
+
+		// The `-` and the `!` are only operators, so a
+		// negative number is a minus and a literal, and the
+		// negations aren't merged.
+		{"-1", []tonho.TokenKind{tonho.Minus, tonho.Int}, []string{"-", "1"}},
+		{"- 1", []tonho.TokenKind{tonho.Minus, tonho.Int}, []string{"-", "1"}},
+		{"--a", []tonho.TokenKind{tonho.Minus, tonho.Minus, tonho.Identifier}, []string{"-", "-", "a"}},
+		{"!!a", []tonho.TokenKind{tonho.Not, tonho.Not, tonho.Identifier}, []string{"!", "!", "a"}},
+		{"!==", []tonho.TokenKind{tonho.NotEqual, tonho.Assign}, []string{"!=", "="}},
+		{"a!=b", []tonho.TokenKind{tonho.Identifier, tonho.NotEqual, tonho.Identifier}, []string{"a", "!=", "b"}},
+		{"a-=b", []tonho.TokenKind{tonho.Identifier, tonho.MinusAssign, tonho.Identifier}, []string{"a", "-=", "b"}},
+
+		// An operator at the end of the input.
+		{"a +", []tonho.TokenKind{tonho.Identifier, tonho.Plus}, []string{"a", "+"}},
+		{"a |>", []tonho.TokenKind{tonho.Identifier, tonho.Pipeline}, []string{"a", "|>"}},
+		{"a ..", []tonho.TokenKind{tonho.Identifier, tonho.Range}, []string{"a", ".."}},
+		{"a -", []tonho.TokenKind{tonho.Identifier, tonho.Minus}, []string{"a", "-"}},
+		{"a !", []tonho.TokenKind{tonho.Identifier, tonho.Not}, []string{"a", "!"}},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			kinds, texts := lexed(t, test.input)
+			if !slices.Equal(kinds, test.kinds) {
+				t.Errorf("got the kinds %v, want %v", kinds, test.kinds)
+			}
+			if !slices.Equal(texts, test.texts) {
+				t.Errorf("got the texts %q, want %q", texts, test.texts)
+			}
+		})
+	}
+}
+
+func TestLexEveryOperator(t *testing.T) {
+	for kind, text := range tonho.TokenNames {
+		if !kind.IsOperator() {
+			continue
+		}
+		t.Run(text, func(t *testing.T) {
+			kinds, texts := lexed(t, text)
+			if !slices.Equal(kinds, []tonho.TokenKind{kind}) || !slices.Equal(texts, []string{text}) {
+				t.Errorf("got the kinds %v and the texts %q, want %v", kinds, texts, kind)
+			}
+		})
+	}
+}
+
+func TestLexNumbers(t *testing.T) {
+	tests := []struct {
+		input string
+		kinds []tonho.TokenKind
+		texts []string
+	}{
+		{"1", []tonho.TokenKind{tonho.Int}, []string{"1"}},
+		{"1.5", []tonho.TokenKind{tonho.Decimal}, []string{"1.5"}},
+		{"1e3", []tonho.TokenKind{tonho.Decimal}, []string{"1e3"}},
+		{"1.5e-3", []tonho.TokenKind{tonho.Decimal}, []string{"1.5e-3"}},
+		{"1_000.5", []tonho.TokenKind{tonho.Decimal}, []string{"1000.5"}},
+		{"1i64", []tonho.TokenKind{tonho.Int}, []string{"1"}},
+		{"1.5f32", []tonho.TokenKind{tonho.Decimal}, []string{"1.5"}},
+
+		// The dot is only part of the number if a digit
+		// follows it, so the others are member accesses and
+		// ranges.
+		{"1.", []tonho.TokenKind{tonho.Int, tonho.Dot}, []string{"1", "."}},
+		{".5", []tonho.TokenKind{tonho.Dot, tonho.Int}, []string{".", "5"}},
+		{"1..2", []tonho.TokenKind{tonho.Int, tonho.Range, tonho.Int}, []string{"1", "..", "2"}},
+		{"1..=2", []tonho.TokenKind{tonho.Int, tonho.RangeInclusive, tonho.Int}, []string{"1", "..=", "2"}},
+		{"1...2", []tonho.TokenKind{tonho.Int, tonho.Spread, tonho.Int}, []string{"1", "...", "2"}},
+		{"1.e3", []tonho.TokenKind{tonho.Int, tonho.Dot, tonho.Identifier}, []string{"1", ".", "e3"}},
+		{"1.foo", []tonho.TokenKind{tonho.Int, tonho.Dot, tonho.Identifier}, []string{"1", ".", "foo"}},
+		{"1.0.", []tonho.TokenKind{tonho.Decimal, tonho.Dot}, []string{"1.0", "."}},
+		{"x.0", []tonho.TokenKind{tonho.Identifier, tonho.Dot, tonho.Int}, []string{"x", ".", "0"}},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			kinds, texts := lexed(t, test.input)
+			if !slices.Equal(kinds, test.kinds) {
+				t.Errorf("got the kinds %v, want %v", kinds, test.kinds)
+			}
+			if !slices.Equal(texts, test.texts) {
+				t.Errorf("got the texts %q, want %q", texts, test.texts)
+			}
+		})
+	}
+}
+
+func TestLexRadixNumberDiagnostics(t *testing.T) {
+	tests := []struct {
+		input, text string
+		diagnostics int
+	}{
+		{"0xFF", "FF", 0},
+		{"0xFFu8", "FF", 0},
+		{"0x", "", 1},
+		{"0x1G", "1", 1},
+		{"0xFG", "F", 1},
+		{"0b12_3", "1", 1},
+		{"0xFFzz", "FF", 1},
+
+		// The invalid digits are reported once, and the
+		// missing valid digits once more.
+		{"0xZZ", "", 2},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			tokens, diagnostics := tonho.Lex("test", test.input)
+			if len(tokens) != 2 || tokens[0].Kind != tonho.Int {
+				t.Fatalf("got the tokens %v, want an Int and EOF", tokens)
+			}
+			if tokens[0].Text != test.text {
+				t.Errorf("got the text %q, want %q", tokens[0].Text, test.text)
+			}
+			if len(diagnostics) != test.diagnostics {
+				t.Errorf("got %d diagnostics, want %d", len(diagnostics), test.diagnostics)
+			}
+			for _, diagnostic := range diagnostics {
+				if diagnostic.Code() != "T0004" {
+					t.Errorf("got the code %s, want T0004", diagnostic.Code())
+				}
+			}
+		})
+	}
+}
+
+func TestLexMisplacedSeparators(t *testing.T) {
+	tests := []struct {
+		input, text string
+	}{
+		{"1_", "1"},
+		{"1__0", "10"},
+		{"1_.5", "1.5"},
+		{"1_e5", "1e5"},
+		{"1e_5", "1e5"},
+		{"1e+_5", "1e+5"},
+		{"1e5_", "1e5"},
+		{"0x_FF", "FF"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			tokens, diagnostics := tonho.Lex("test", test.input)
+			if tokens[0].Text != test.text {
+				t.Errorf("got the text %q, want %q", tokens[0].Text, test.text)
+			}
+			if len(diagnostics) != 1 || diagnostics[0].Code() != "T0004" {
+				t.Errorf("got the diagnostics %v, want a T0004", diagnostics)
+			}
+		})
+	}
+}
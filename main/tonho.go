@@ -1,11 +1,11 @@
 package main
 
 import (
-	"fmt"
+	"os"
 	"tonho"
 )
 
 func main() {
-	tokens := tonho.Lex("test", "fun main() { println(\"hello world\") }")
-	fmt.Printf("%v", tokens)
+	tokens, _ := tonho.Lex("test", "fun main() { println(\"hello world\") }")
+	tonho.DumpTokens(os.Stdout, tokens, tonho.TextFormat)
 }
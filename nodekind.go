@@ -0,0 +1,590 @@
+package tonho
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// NodeCategory is a set of the categories of a node kind,
+// like a declaration or an expression. A kind can be in
+// many categories, like TypeApplicationNode, that is both
+// an expression, like `f<Int>`, and a type, like `List<Int>`.
+type NodeCategory int
+
+// The categories of the node kinds.
+const (
+	// DeclCategory holds the declarations, like FunNode.
+	DeclCategory NodeCategory = 1 << iota
+
+	// StmtCategory holds the statements that aren't
+	// declarations or expressions, like WhileNode.
+	StmtCategory
+
+	// ExprCategory holds the expressions, like CallNode.
+	ExprCategory
+
+	// TypeCategory holds the types, like TypeNameNode.
+	TypeCategory
+
+	// PatternCategory holds the patterns, like
+	// BindingPatternNode.
+	PatternCategory
+)
+
+// NodeKindInfo describes a node kind, with its name, its
+// categories, and the shape of its children, that is a
+// pattern over them, like a regular expression, where:
+//
+//   - a quoted name, like '(' or 'fun', matches a token
+//     which kind has the name;
+//   - a name of a node kind, like BlockNode, matches a
+//     node of the kind;
+//   - a name of a token kind, like Identifier, matches a
+//     token of the kind;
+//   - expr, type, pattern and decl match the nodes of
+//     the categories, and stmt matches the declarations,
+//     the statements and the expressions;
+//   - operator and assignment match the operator and the
+//     assignment tokens, and any matches any child;
+//   - the items can be grouped between parentheses, with
+//     the alternatives separated by `|`, and followed by
+//     `?`, `*` or `+`, like `(ParameterNode ','?)*`.
+//
+// The shapes describe the trees without syntax errors, as
+// the parser recovers from them, leaving out the missing
+// tokens, and holding the unexpected ones in ErrorNode.
+// The lists separated by commas are the exception, as the
+// repeated commas, like in `[1,, 2]`, are kept in an
+// ErrorNode after the comma, that their shapes allow.
+type NodeKindInfo struct {
+	Name     string
+	Category NodeCategory
+	Shape    string
+}
+
+// builtinNodeKinds describes the node kinds of the parser.
+var builtinNodeKinds = []NodeKindInfo{
+	FileNode:            {"FileNode", 0, "(stmt | ';')* EOF"},
+	ValNode:             {"ValNode", DeclCategory, "AttributesNode? 'val' (Identifier | PatternNode) (':' type)? ('=' expr)?"},
+	VarNode:             {"VarNode", DeclCategory, "AttributesNode? 'var' (Identifier | PatternNode) (':' type)? ('=' expr)?"},
+	WhileNode:           {"WhileNode", StmtCategory, "Annotation? 'while' '(' expr ')' BlockNode"},
+	ForNode:             {"ForNode", StmtCategory, "Annotation? 'for' ('(' Identifier 'in' expr ')' | Identifier 'in' expr) BlockNode"},
+	LoopNode:            {"LoopNode", StmtCategory, "Annotation? 'loop' BlockNode"},
+	ExprNode:            {"ExprNode", ExprCategory, "expr operator expr | operator expr | '(' expr ')'"},
+	AssignNode:          {"AssignNode", StmtCategory, "expr assignment expr"},
+	FunNode:             {"FunNode", DeclCategory, "AttributesNode? 'fun' Identifier GenericsNode? '(' (ParameterNode (',' ErrorNode?)?)* ')' ('->' type)? BlockNode"},
+	StructNode:          {"StructNode", DeclCategory, "AttributesNode? 'struct' Identifier GenericsNode? '{' (FieldNode (',' ErrorNode?)?)* '}'"},
+	EnumNode:            {"EnumNode", DeclCategory, "AttributesNode? 'enum' Identifier GenericsNode? '{' (VariantNode (',' ErrorNode?)?)* '}'"},
+	WhenNode:            {"WhenNode", ExprCategory, "'when' ('(' expr ')')? '{' (WhenArmNode (',' | ';')?)* '}'"},
+	IfNode:              {"IfNode", ExprCategory, "'if' '(' expr ')' expr ElseNode?"},
+	ElseNode:            {"ElseNode", 0, "'else' expr"},
+	CallNode:            {"CallNode", ExprCategory, "expr '(' ((expr | NamedArgumentNode | SpreadNode) (',' ErrorNode?)?)* ')' LambdaNode? | expr LambdaNode"},
+	NumberNode:          {"NumberNode", ExprCategory, "Int | Decimal"},
+	StringNode:          {"StringNode", ExprCategory, "String | StringStart expr (StringMiddle expr)* StringEnd"},
+	CharNode:            {"CharNode", ExprCategory, "Char"},
+	BoolNode:            {"BoolNode", ExprCategory, "Identifier"},
+	IdentifierNode:      {"IdentifierNode", ExprCategory, "Identifier"},
+	ParameterNode:       {"ParameterNode", 0, "Identifier (':' '...'? type)? ('=' expr)?"},
+	TypeNameNode:        {"TypeNameNode", TypeCategory, "Identifier"},
+	TypeApplicationNode: {"TypeApplicationNode", ExprCategory | TypeCategory, "(TypeNameNode | expr) '<' (type (',' ErrorNode?)?)* '>'"},
+	GenericsNode:        {"GenericsNode", 0, "'<' (TypeParameterNode (',' ErrorNode?)?)* '>'"},
+	MemberNode:          {"MemberNode", ExprCategory, "expr ('.' | '?.') Identifier"},
+	IndexNode:           {"IndexNode", ExprCategory, "expr '[' expr ']'"},
+	BlockNode:           {"BlockNode", ExprCategory, "'{' (stmt | ';')* '}'"},
+	FieldNode:           {"FieldNode", 0, "Identifier ':' type ('=' expr)?"},
+	VariantNode:         {"VariantNode", 0, "Identifier ('(' (type (',' ErrorNode?)?)* ')')?"},
+	WhenArmNode:         {"WhenArmNode", 0, "('else' | ('is' type | pattern | expr) (',' ('is' type | pattern | expr))*) GuardNode? '->' expr"},
+	ErrorNode:           {"ErrorNode", 0, "any*"},
+	TypeParameterNode:   {"TypeParameterNode", 0, "Identifier (':' type)?"},
+	FunctionTypeNode:    {"FunctionTypeNode", TypeCategory, "'(' (type (',' ErrorNode?)?)* ')' '->' type"},
+	OptionalTypeNode:    {"OptionalTypeNode", TypeCategory, "type '?'"},
+	TupleTypeNode:       {"TupleTypeNode", TypeCategory, "'(' (type (',' ErrorNode?)?)* ')'"},
+	ModuleNode:          {"ModuleNode", DeclCategory, "'module' PathNode"},
+	ImportNode:          {"ImportNode", DeclCategory, "'import' PathNode ('.' '{' (ImportItemNode (',' ErrorNode?)?)* '}' | ('as' Identifier)?)"},
+	ImportItemNode:      {"ImportItemNode", 0, "Identifier ('as' Identifier)?"},
+	PathNode:            {"PathNode", 0, "Identifier ('.' Identifier)*"},
+	LambdaNode:          {"LambdaNode", ExprCategory, "'{' ((ParameterNode (',' ErrorNode?)?)* '->')? (stmt | ';')* '}' | '(' (ParameterNode (',' ErrorNode?)?)* ')' '->' expr"},
+	ListNode:            {"ListNode", ExprCategory, "'[' ((expr | SpreadNode) (',' ErrorNode?)?)* ']'"},
+	SpreadNode:          {"SpreadNode", 0, "'...' expr"},
+	MapNode:             {"MapNode", ExprCategory, "'#{' (EntryNode (',' ErrorNode?)?)* '}'"},
+	EntryNode:           {"EntryNode", 0, "expr ':' expr"},
+	TupleNode:           {"TupleNode", ExprCategory, "'(' (expr (',' ErrorNode?)?)* ')'"},
+	PatternNode:         {"PatternNode", PatternCategory, "'(' (pattern (',' ErrorNode?)?)* ')'"},
+	ReturnNode:          {"ReturnNode", ExprCategory, "'return' expr?"},
+	BreakNode:           {"BreakNode", ExprCategory, "'break' Annotation?"},
+	ContinueNode:        {"ContinueNode", ExprCategory, "'continue' Annotation?"},
+	AttributesNode:      {"AttributesNode", 0, "AttributeNode+"},
+	AttributeNode:       {"AttributeNode", 0, "Annotation ('(' ((expr | NamedArgumentNode | SpreadNode) (',' ErrorNode?)?)* ')')?"},
+	DeferNode:           {"DeferNode", StmtCategory, "'defer' BlockNode"},
+	WildcardPatternNode: {"WildcardPatternNode", PatternCategory, "Identifier"},
+	LiteralPatternNode:  {"LiteralPatternNode", PatternCategory, "'-'? (Int | Decimal) | String | Char | Identifier"},
+	BindingPatternNode:  {"BindingPatternNode", PatternCategory, "Identifier"},
+	VariantPatternNode:  {"VariantPatternNode", PatternCategory, "Identifier ('.' Identifier)* ('(' (pattern (',' ErrorNode?)?)* ')')?"},
+	GuardNode:           {"GuardNode", 0, "'if' expr"},
+	RangeNode:           {"RangeNode", ExprCategory, "expr? ('..' | '..=') expr? ('by' expr)?"},
+	NamedArgumentNode:   {"NamedArgumentNode", 0, "Identifier ':' expr"},
+}
+
+// nodeKindRegistry holds the node kinds, the builtin
+// ones and the registered ones, with their compiled
+// shapes. It's guarded by a lock, as the trees can be
+// validated by many goroutines.
+var nodeKindRegistry = func() *nodeKindsTable {
+	table := &nodeKindsTable{names: make(map[string]NodeKind)}
+	for kind, info := range builtinNodeKinds {
+		table.infos = append(table.infos, info)
+		table.names[info.Name] = NodeKind(kind)
+	}
+	for _, info := range builtinNodeKinds {
+		shape, err := table.compile(info.Shape)
+		if err != nil {
+			panic(fmt.Sprintf("the shape of %s: %v", info.Name, err))
+		}
+		table.shapes = append(table.shapes, shape)
+	}
+	return table
+}()
+
+// nodeKindsTable is the table of the node kinds, indexed
+// by the kinds.
+type nodeKindsTable struct {
+	mu     sync.RWMutex
+	infos  []NodeKindInfo
+	shapes []shape
+	names  map[string]NodeKind
+}
+
+// String returns the name of the node kind.
+func (k NodeKind) String() string {
+	if info, ok := k.Info(); ok {
+		return info.Name
+	}
+	return fmt.Sprintf("NodeKind(%d)", int(k))
+}
+
+// Info returns the description of the node kind, or
+// false if the kind isn't registered.
+func (k NodeKind) Info() (NodeKindInfo, bool) {
+	table := nodeKindRegistry
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	if k < 0 || int(k) >= len(table.infos) {
+		return NodeKindInfo{}, false
+	}
+	return table.infos[k], true
+}
+
+// Is returns true if the node kind is in any of the
+// given categories.
+func (k NodeKind) Is(category NodeCategory) bool {
+	info, _ := k.Info()
+	return info.Category&category != 0
+}
+
+// NodeKindNamed returns the node kind with the given name,
+// like FunNode, or false if there's none.
+func NodeKindNamed(name string) (NodeKind, bool) {
+	table := nodeKindRegistry
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	kind, ok := table.names[name]
+	return kind, ok
+}
+
+// NodeKinds returns the node kinds, the builtin ones and
+// the registered ones, in order.
+func NodeKinds() []NodeKind {
+	table := nodeKindRegistry
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	kinds := make([]NodeKind, len(table.infos))
+	for i := range kinds {
+		kinds[i] = NodeKind(i)
+	}
+	return kinds
+}
+
+// RegisterNodeKind adds a node kind, so the plugins can
+// build trees with their own nodes, that are validated,
+// dumped and encoded like the builtin ones, like:
+//
+//	kind, err := tonho.RegisterNodeKind(tonho.NodeKindInfo{
+//		Name:     "MacroNode",
+//		Category: tonho.ExprCategory,
+//		Shape:    "Annotation '(' (expr ','?)* ')'",
+//	})
+//
+// The name must be unique, and the shape can only refer to
+// the node kinds that are registered already.
+func RegisterNodeKind(info NodeKindInfo) (NodeKind, error) {
+	table := nodeKindRegistry
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	if info.Name == "" {
+		return 0, fmt.Errorf("the node kind has no name")
+	}
+	if _, ok := table.names[info.Name]; ok {
+		return 0, fmt.Errorf("the node kind %s is registered already", info.Name)
+	}
+	shape, err := table.compile(info.Shape)
+	if err != nil {
+		return 0, fmt.Errorf("the shape of %s: %w", info.Name, err)
+	}
+
+	kind := NodeKind(len(table.infos))
+	table.infos = append(table.infos, info)
+	table.shapes = append(table.shapes, shape)
+	table.names[info.Name] = kind
+	return kind, nil
+}
+
+// Validate returns an error if a node of the tree has an
+// unregistered kind, or children that don't match the
+// shape of its kind, like a FunNode without its body, so
+// the trees built by the plugins and the rewrites can be
+// checked. The trees with syntax errors aren't valid.
+func Validate(tree Tree) error {
+	return validate(tree, nil)
+}
+
+// validate validates the tree at the given path of child
+// indices from the root.
+func validate(tree Tree, path []int) error {
+	node, ok := tree.(Node)
+	if !ok {
+		return nil
+	}
+
+	table := nodeKindRegistry
+	table.mu.RLock()
+	if node.Kind < 0 || int(node.Kind) >= len(table.shapes) {
+		table.mu.RUnlock()
+		return fmt.Errorf("the node at %v has the unknown kind %d", path, int(node.Kind))
+	}
+	info := table.infos[node.Kind]
+	matched := table.shapes[node.Kind].match(node.Children, 0, func(end int) bool { return end == len(node.Children) })
+	table.mu.RUnlock()
+
+	if !matched {
+		kinds := make([]string, len(node.Children))
+		for i, child := range node.Children {
+			kinds[i] = childName(child)
+		}
+		return fmt.Errorf("the %s at %v has the children [%s], that don't match its shape %q",
+			info.Name, path, strings.Join(kinds, " "), info.Shape)
+	}
+	for i, child := range node.Children {
+		if err := validate(child, appendPath(path, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// childName returns the name of the kind of the child,
+// like in the shapes, where the keywords and the
+// punctuation are quoted.
+func childName(tree Tree) string {
+	switch tree := tree.(type) {
+	case Token:
+		if name := tree.Kind.String(); name[0] < 'A' || name[0] > 'Z' {
+			return "'" + name + "'"
+		}
+		return tree.Kind.String()
+	case Node:
+		return tree.Kind.String()
+	}
+	return "?"
+}
+
+// MarshalText encodes the node kind as its name.
+func (k NodeKind) MarshalText() ([]byte, error) {
+	info, ok := k.Info()
+	if !ok {
+		return nil, fmt.Errorf("unknown node kind %d", int(k))
+	}
+	return []byte(info.Name), nil
+}
+
+// UnmarshalJSON decodes the node kind from its name, or
+// from its number, as the nodes were encoded before.
+func (k *NodeKind) UnmarshalJSON(data []byte) error {
+	var number int
+	if err := json.Unmarshal(data, &number); err == nil {
+		*k = NodeKind(number)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	kind, ok := NodeKindNamed(name)
+	if !ok {
+		return fmt.Errorf("unknown node kind %q", name)
+	}
+	*k = kind
+	return nil
+}
+
+// shape is a compiled shape, that matches the children
+// from the index, and calls the continuation with the end
+// of each match, until it returns true, like a regular
+// expression with backtracking.
+type shape interface {
+	match(children []Tree, i int, next func(int) bool) bool
+}
+
+// shapeItem matches a child that passes the test.
+type shapeItem func(Tree) bool
+
+// shapeSequence matches its shapes one after another.
+type shapeSequence []shape
+
+// shapeChoice matches any of its shapes.
+type shapeChoice []shape
+
+// shapeRepeat matches its shape repeated at least min
+// times, and at most max times, or unbounded if max is
+// negative.
+type shapeRepeat struct {
+	shape    shape
+	min, max int
+}
+
+func (s shapeItem) match(children []Tree, i int, next func(int) bool) bool {
+	return i < len(children) && s(children[i]) && next(i+1)
+}
+
+func (s shapeSequence) match(children []Tree, i int, next func(int) bool) bool {
+	if len(s) == 0 {
+		return next(i)
+	}
+	return s[0].match(children, i, func(j int) bool {
+		return s[1:].match(children, j, next)
+	})
+}
+
+func (s shapeChoice) match(children []Tree, i int, next func(int) bool) bool {
+	for _, choice := range s {
+		if choice.match(children, i, next) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s shapeRepeat) match(children []Tree, i int, next func(int) bool) bool {
+	return s.repeat(children, i, 0, next)
+}
+
+// repeat matches the shape again, greedily, after the
+// given count of matches, and only continues with the
+// matches that consume children, so it always ends.
+func (s shapeRepeat) repeat(children []Tree, i, count int, next func(int) bool) bool {
+	if s.max < 0 || count < s.max {
+		matched := s.shape.match(children, i, func(j int) bool {
+			return j > i && s.repeat(children, j, count+1, next)
+		})
+		if matched {
+			return true
+		}
+	}
+	return count >= s.min && next(i)
+}
+
+// compile compiles the source of a shape. The table must
+// be locked by the caller.
+func (t *nodeKindsTable) compile(source string) (shape, error) {
+	c := &shapeCompiler{table: t, source: source}
+	shape, err := c.choice()
+	if err != nil {
+		return nil, err
+	}
+	if c.skip(); c.offset < len(c.source) {
+		return nil, c.errorf("unexpected %q", c.source[c.offset])
+	}
+	return shape, nil
+}
+
+// shapeCompiler compiles the source of a shape.
+type shapeCompiler struct {
+	table  *nodeKindsTable
+	source string
+	offset int
+}
+
+// choice compiles the alternatives separated by `|`.
+func (c *shapeCompiler) choice() (shape, error) {
+	var choices shapeChoice
+	for {
+		sequence, err := c.sequence()
+		if err != nil {
+			return nil, err
+		}
+		choices = append(choices, sequence)
+		if c.skip(); !c.eat('|') {
+			break
+		}
+	}
+	if len(choices) == 1 {
+		return choices[0], nil
+	}
+	return choices, nil
+}
+
+// sequence compiles the items until a `|`, a `)` or the
+// end of the shape.
+func (c *shapeCompiler) sequence() (shape, error) {
+	var sequence shapeSequence
+	for {
+		c.skip()
+		if c.offset >= len(c.source) || c.source[c.offset] == '|' || c.source[c.offset] == ')' {
+			return sequence, nil
+		}
+		item, err := c.item()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case c.eat('?'):
+			item = shapeRepeat{item, 0, 1}
+		case c.eat('*'):
+			item = shapeRepeat{item, 0, -1}
+		case c.eat('+'):
+			item = shapeRepeat{item, 1, -1}
+		}
+		sequence = append(sequence, item)
+	}
+}
+
+// item compiles a group, a quoted token or a name.
+func (c *shapeCompiler) item() (shape, error) {
+	switch {
+	case c.eat('('):
+		group, err := c.choice()
+		if err != nil {
+			return nil, err
+		}
+		if c.skip(); !c.eat(')') {
+			return nil, c.errorf("expected `)`")
+		}
+		return group, nil
+	case c.eat('\''):
+		end := strings.IndexByte(c.source[c.offset:], '\'')
+		if end < 0 {
+			return nil, c.errorf("unterminated quote")
+		}
+		name := c.source[c.offset : c.offset+end]
+		c.offset += end + 1
+		kind, ok := tokenKindNamed(name)
+		if !ok {
+			return nil, c.errorf("unknown token %q", name)
+		}
+		return tokenItem(kind), nil
+	}
+
+	start := c.offset
+	for c.offset < len(c.source) && isShapeName(c.source[c.offset]) {
+		c.offset++
+	}
+	name := c.source[start:c.offset]
+	if name == "" {
+		return nil, c.errorf("unexpected %q", c.source[c.offset])
+	}
+
+	switch name {
+	case "any":
+		return shapeItem(func(Tree) bool { return true }), nil
+	case "stmt":
+		return categoryItem(DeclCategory|StmtCategory|ExprCategory, c.table), nil
+	case "decl":
+		return categoryItem(DeclCategory, c.table), nil
+	case "expr":
+		return categoryItem(ExprCategory, c.table), nil
+	case "type":
+		return categoryItem(TypeCategory, c.table), nil
+	case "pattern":
+		return categoryItem(PatternCategory, c.table), nil
+	case "operator":
+		return shapeItem(func(tree Tree) bool {
+			token, ok := tree.(Token)
+			return ok && (token.Kind.IsOperator() || token.Kind == FatArrow) && !token.Kind.IsAssignmentOp()
+		}), nil
+	case "assignment":
+		return shapeItem(func(tree Tree) bool {
+			token, ok := tree.(Token)
+			return ok && token.Kind.IsAssignmentOp()
+		}), nil
+	}
+	if kind, ok := c.table.names[name]; ok {
+		return shapeItem(func(tree Tree) bool {
+			node, ok := tree.(Node)
+			return ok && node.Kind == kind
+		}), nil
+	}
+	if kind, ok := tokenKindNamed(name); ok {
+		return tokenItem(kind), nil
+	}
+	c.offset = start
+	return nil, c.errorf("unknown name %q", name)
+}
+
+// skip skips the spaces.
+func (c *shapeCompiler) skip() {
+	for c.offset < len(c.source) && c.source[c.offset] == ' ' {
+		c.offset++
+	}
+}
+
+// eat skips the character if it's at the offset.
+func (c *shapeCompiler) eat(char byte) bool {
+	if c.offset >= len(c.source) || c.source[c.offset] != char {
+		return false
+	}
+	c.offset++
+	return true
+}
+
+// errorf creates an error at the offset of the shape.
+func (c *shapeCompiler) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", c.offset, fmt.Sprintf(format, args...))
+}
+
+// isShapeName returns true if the character can be part
+// of a name in a shape.
+func isShapeName(char byte) bool {
+	return char == '_' || 'a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || '0' <= char && char <= '9'
+}
+
+// tokenItem returns the item that matches the tokens of
+// the kind.
+func tokenItem(kind TokenKind) shapeItem {
+	return func(tree Tree) bool {
+		token, ok := tree.(Token)
+		return ok && token.Kind == kind
+	}
+}
+
+// categoryItem returns the item that matches the nodes of
+// any of the categories. The categories are looked up in
+// the table, that is locked while the trees are validated.
+func categoryItem(category NodeCategory, table *nodeKindsTable) shapeItem {
+	return func(tree Tree) bool {
+		node, ok := tree.(Node)
+		return ok && node.Kind >= 0 && int(node.Kind) < len(table.infos) && table.infos[node.Kind].Category&category != 0
+	}
+}
+
+// tokenKindNamed returns the token kind with the given
+// name, like `fun` or Identifier.
+func tokenKindNamed(name string) (TokenKind, bool) {
+	for kind, other := range TokenNames {
+		if other == name {
+			return kind, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,29 @@
+package tonho_test
+
+import (
+	"testing"
+
+	"tonho"
+)
+
+func TestValidateRepeatedCommas(t *testing.T) {
+	for _, input := range []string{
+		"val a = [1,, 2]",
+		"val a = #{1: 2,, 3: 4}",
+		"f(1,, 2)",
+		"fun f<A,, B>() {}",
+		"fun f(a: Int,, b: Int) {}",
+		"val (a,, b) = c",
+		"import a.{b,, c}",
+	} {
+		t.Run(input, func(t *testing.T) {
+			tree, diagnostics := tonho.Parse("test", input)
+			if len(diagnostics) != 1 {
+				t.Errorf("got the diagnostics %v, want the repeated comma", diagnostics)
+			}
+			if err := tonho.Validate(tree); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package tonho
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Associativity represents how the binary operators of
+// the same precedence group, like `a - b - c`.
+type Associativity int
+
+const (
+	// LeftAssociative groups to the left, like
+	// `(a - b) - c`.
+	LeftAssociative Associativity = iota
+
+	// RightAssociative groups to the right, like
+	// `a ?: (b ?: c)`.
+	RightAssociative
+)
+
+// OperatorInfo describes a binary operator, with the token
+// of the operator, its precedence, where the operators with
+// a higher precedence bind tighter, and its associativity.
+type OperatorInfo struct {
+	Token      TokenKind
+	Precedence int
+	Assoc      Associativity
+}
+
+// Operators returns the default binary operators, from the
+// loosest to the tightest. Their precedences are spaced by
+// ten, so the registered operators can go between them.
+func Operators() []OperatorInfo {
+	operators := make([]OperatorInfo, 0, len(infixOperators))
+	for kind := range infixOperators {
+		info, _ := defaultOperator(kind)
+		operators = append(operators, info)
+	}
+	sort.Slice(operators, func(i, j int) bool {
+		if operators[i].Precedence != operators[j].Precedence {
+			return operators[i].Precedence < operators[j].Precedence
+		}
+		return operators[i].Token < operators[j].Token
+	})
+	return operators
+}
+
+// RegisterOperator adds a binary operator to the parser, or
+// changes the precedence and the associativity of one that
+// it has, so the embedders can extend the expressions, like:
+//
+//	parser := tonho.NewParser("rules.tn", input)
+//	parser.RegisterOperator(tonho.OperatorInfo{
+//		Token:      tonho.FatArrow,
+//		Precedence: tonho.Operators()[0].Precedence - 5,
+//	})
+//
+// The token must be an operator that the lexer produces, and
+// that has no other meaning to the parser, like `=>`, and the
+// precedence must be positive.
+func (p *Parser) RegisterOperator(info OperatorInfo) error {
+	switch {
+	case info.Precedence <= bindingNone:
+		return fmt.Errorf("the precedence of the operator %s must be positive", info.Token)
+	case info.Assoc != LeftAssociative && info.Assoc != RightAssociative:
+		return fmt.Errorf("the operator %s has an invalid associativity %d", info.Token, info.Assoc)
+	case info.Token.IsAssignmentOp(), info.Token == Dot, info.Token == SafeDot:
+		return fmt.Errorf("the operator %s can't be a binary operator", info.Token)
+	case !info.Token.IsOperator() && info.Token != FatArrow:
+		return fmt.Errorf("the token %s isn't an operator", info.Token)
+	}
+
+	if p.operators == nil {
+		p.operators = make(map[TokenKind]OperatorInfo, len(infixOperators)+1)
+		for kind := range infixOperators {
+			p.operators[kind], _ = defaultOperator(kind)
+		}
+	}
+	p.operators[info.Token] = info
+	return nil
+}
+
+// operator returns the binary operator of the given token,
+// if the parser has one.
+func (p *Parser) operator(kind TokenKind) (OperatorInfo, bool) {
+	if p.operators != nil {
+		info, ok := p.operators[kind]
+		return info, ok
+	}
+	return defaultOperator(kind)
+}
+
+// defaultOperator returns the default binary operator of
+// the given token, from the binding power tables.
+func defaultOperator(kind TokenKind) (OperatorInfo, bool) {
+	binding, ok := infixOperators[kind]
+	if !ok {
+		return OperatorInfo{}, false
+	}
+	info := OperatorInfo{Token: kind, Precedence: binding}
+	if rightAssociative[kind] {
+		info.Assoc = RightAssociative
+	}
+	return info, true
+}
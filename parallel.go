@@ -0,0 +1,50 @@
+package tonho
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// LexAll lexes the given files, mapping the file names to
+// their inputs, in parallel, and returns the tokens of each
+// file and the diagnostics of all files.
+//
+// The files are lexed by a pool of workers, one for each
+// processor, and the diagnostics are ordered by the file
+// names, so the results don't depend on the scheduling.
+func LexAll(files map[string]string) (map[string][]Token, []Diagnostic) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tokens := make([][]Token, len(names))
+	errors := make([][]Diagnostic, len(names))
+
+	jobs := make(chan int)
+	var group sync.WaitGroup
+	for range min(runtime.GOMAXPROCS(0), len(names)) {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for n := range jobs {
+				tokens[n], errors[n] = Lex(names[n], files[names[n]])
+			}
+		}()
+	}
+	for n := range names {
+		jobs <- n
+	}
+	close(jobs)
+	group.Wait()
+
+	results := make(map[string][]Token, len(names))
+	var diagnostics []Diagnostic
+	for n, name := range names {
+		results[name] = tokens[n]
+		diagnostics = append(diagnostics, errors[n]...)
+	}
+	return results, diagnostics
+}
@@ -1,17 +1,46 @@
 package tonho
 
+import (
+	"slices"
+	"strings"
+)
+
+// Event represents a step of the parsing, that is
+// replayed to build the concrete syntax tree.
 type Event interface {
 	Event()
 }
 
+// OpenEvent opens a node of the given kind, that
+// holds the following nodes and tokens.
+//
+// The Forward is the distance to the open event of the
+// parent of the node, when the parent was opened later,
+// wrapping the node, like the binary expression around
+// its left hand side, or zero otherwise. The open event
+// of the parent is skipped where it is, as it's opened
+// before the node instead.
 type OpenEvent struct {
-	Kind int
+	Kind    NodeKind
+	Forward int
 }
 
+// CloseEvent closes the last open node.
 type CloseEvent struct{}
 
+// AdvanceEvent adds the next token to the last
+// open node.
 type AdvanceEvent struct{}
 
+// Event marks OpenEvent as an event.
+func (OpenEvent) Event() {}
+
+// Event marks CloseEvent as an event.
+func (CloseEvent) Event() {}
+
+// Event marks AdvanceEvent as an event.
+func (AdvanceEvent) Event() {}
+
 // Parser is a struct that contains the state of the parser.
 //
 // It is used to parse a list of tokens to produce a list of events,
@@ -24,17 +53,457 @@ type Parser struct {
 	events []Event
 
 	// The fuel is the maximum number of tokens that the parser will
-	// consume before stopping. This is used to prevent infinite loops
-	// in the parser.
+	// look at without consuming any of them. This is used to prevent
+	// infinite loops in the parser, and it's refilled every time a
+	// token is consumed.
 	//
-	// If the maximum number of tokens is reached, the parser will
-	// panic.
-	fuel int
+	// If the fuel runs out, the parser reports a compiler error, and
+	// it's stuck, seeing only the end of the input, so the rules stop
+	// and return the partial tree.
+	fuel  int
+	stuck bool
+
+	// The depth is the number of the nested rules, like the
+	// parenthesized expressions, the blocks and the types,
+	// that are parsed recursively. When it's deeper than
+	// the maximum depth, the parser gets stuck too, instead
+	// of running out of stack.
+	depth int
+
+	// The floor is the lowest depth since the last token
+	// was consumed. The parser is refueled when it leaves
+	// a rule below it, as the rules that unwind look at the
+	// tokens after their children, like a missing `)`,
+	// without consuming them, but they can't loop.
+	floor int
+
+	// The nesting is the number of open parentheses and brackets,
+	// inside of which the newlines don't end the expressions.
+	nesting int
+
+	// The restrictions are the syntaxes that are ambiguous where
+	// the current expression is, so they aren't parsed, like the
+	// trailing lambdas in `for x in xs {}`. They are lifted inside
+	// of parentheses, brackets and braces.
+	restrictions restriction
+
+	// The functions is the number of functions and lambdas around
+	// the current token, and the loops are the labels of the loops
+	// around it, inside of the closest function, so the returns,
+	// the breaks and the continues are checked. The loops without
+	// a label have an empty label.
+	functions int
+	loops     []string
+
+	// The deferred is the number of defer blocks around the
+	// current token, inside of the closest function, where
+	// the returns aren't allowed.
+	deferred int
+
+	// The operators are the binary operators of the parser, when
+	// more of them are registered, otherwise it's nil, and the
+	// default ones are used.
+	operators map[TokenKind]OperatorInfo
+}
+
+// restriction represents a syntax that isn't parsed
+// in the current expression.
+type restriction int
+
+const (
+	// noTrailingLambda forbids the trailing lambdas,
+	// where a block follows the expression.
+	noTrailingLambda restriction = 1 << iota
+
+	// noArrowLambda forbids the lambdas with their
+	// parameters between parentheses, where an arrow
+	// follows the expression, like in the when arms.
+	noArrowLambda
+)
+
+// maxFuel is the fuel of the parser after consuming a token.
+const maxFuel = 256
+
+// maxDepth is the maximum depth of the nested rules.
+const maxDepth = 1000
+
+// maxLookahead is the maximum number of tokens that the
+// parser looks ahead of the current one, to tell apart
+// the ambiguous syntaxes, like the type arguments.
+const maxLookahead = 256
+
+// openMark is the position of an open event, that is
+// closed by the close function.
+type openMark struct {
+	index int
+}
+
+// closedMark is the position of the open event of a
+// closed node, so another node can be opened before
+// it, wrapping it.
+type closedMark struct {
+	index int
 }
 
 // NewParser creates a new parser with the given input.
 func NewParser(filename, input string) Parser {
-	tokens := Lex(filename, input)
+	tokens, errors := Lex(filename, input)
+
+	return Parser{input: input, tokens: tokens, errors: errors, fuel: maxFuel}
+}
+
+// Parse parses the input as a file, and returns its tree,
+// with the diagnostics of the lexer and the parser.
+func Parse(filename, input string) (Node, []Diagnostic) {
+	parser := NewParser(filename, input)
+	return parser.ParseFile(), parser.Diagnostics()
+}
+
+// ParseExpression parses the input as a single expression,
+// like `a + b`, and returns its tree, with the diagnostics.
+func ParseExpression(input string) (Node, []Diagnostic) {
+	parser := NewParser("expression", input)
+	return parser.ParseExpression(), parser.Diagnostics()
+}
+
+// ParseStatement parses the input as a single statement,
+// like `val x = 1`, and returns its tree, with the
+// diagnostics.
+func ParseStatement(input string) (Node, []Diagnostic) {
+	parser := NewParser("statement", input)
+	return parser.ParseStatement(), parser.Diagnostics()
+}
+
+// ParseExpression parses the input as a single expression,
+// and returns its tree. The diagnostics are reported to the
+// parser, so they can be got with the Diagnostics function.
+func (p *Parser) ParseExpression() Node {
+	return first(p.parse(func(p *Parser) { p.expression() }))
+}
+
+// ParseStatement parses the input as a single statement,
+// and returns its tree, like ParseExpression.
+func (p *Parser) ParseStatement() Node {
+	return first(p.parse(func(p *Parser) { p.statement() }))
+}
+
+// ParseFile parses the input as a file, that is a list of
+// statements, and returns its tree.
+func (p *Parser) ParseFile() Node {
+	return p.parse(func(p *Parser) { p.statements(EOF) })
+}
+
+// first returns the first child of the given root node,
+// that is the parsed fragment, or the root node if the
+// fragment is missing.
+func first(root Node) Node {
+	if len(root.Children) > 0 {
+		if node, ok := root.Children[0].(Node); ok {
+			return node
+		}
+	}
+	return root
+}
+
+// Diagnostics returns the diagnostics of the lexer and
+// the parser.
+func (p *Parser) Diagnostics() []Diagnostic {
+	return p.errors
+}
+
+// parse parses the input with the given rule, and reports
+// the tokens that follow it, wrapping all of them into a
+// file node, that is returned.
+func (p *Parser) parse(rule func(p *Parser)) Node {
+	m := p.open()
+	rule(p)
+
+	// The parser is unstuck, and refueled, so the tokens
+	// after the rule and the EOF are always consumed, even
+	// if the fuel ran out at the last lookahead, and the
+	// tree keeps all of the source code.
+	stuck := p.stuck
+	p.stuck, p.fuel = false, maxFuel
+	if !stuck && !p.eof() {
+		p.report(unexpectedTokenCode, NewText("unexpected"), NewCode(p.current().Kind.String()), NewText("expected the end of the input"))
+	}
+
+	if !p.eof() {
+		e := p.open()
+		for !p.eof() {
+			p.advance()
+		}
+		p.close(e, ErrorNode)
+	}
+	p.advance() // the EOF token holds the trailing trivia
+	p.close(m, FileNode)
+
+	return BuildTree(p.events, p.tokens)
+}
+
+// BuildTree replays the events over the tokens, and returns
+// the root node, so the parser only records the events, and
+// the tree is materialized once at the end.
+//
+// The open nodes are closed at the end of the events, and
+// the advances past the end of the tokens are ignored, so
+// the tree is always built, even from unbalanced events.
+func BuildTree(events []Event, tokens []Token) Node {
+	var stack []Node
+	index := 0
+	for _, event := range forwarded(events) {
+		switch event := event.(type) {
+		case OpenEvent:
+			stack = append(stack, NewNode(event.Kind, nil))
+		case CloseEvent:
+			if len(stack) == 0 {
+				continue
+			}
+			node := stack[len(stack)-1]
+			node.location = spanning(node.Children)
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return node
+			}
+			parent := &stack[len(stack)-1]
+			parent.Children = append(parent.Children, node)
+		case AdvanceEvent:
+			if len(stack) == 0 || index >= len(tokens) {
+				continue
+			}
+			top := &stack[len(stack)-1]
+			top.Children = append(top.Children, tokens[index])
+			index++
+		}
+	}
+
+	for len(stack) > 1 {
+		node := stack[len(stack)-1]
+		node.location = spanning(node.Children)
+		stack = stack[:len(stack)-1]
+		parent := &stack[len(stack)-1]
+		parent.Children = append(parent.Children, node)
+	}
+	if len(stack) == 1 {
+		return stack[0].WithLocation(spanning(stack[0].Children))
+	}
+	return NewNode(FileNode, nil)
+}
+
+// forwarded returns the events with the open events of
+// the parents, that were opened after their first child,
+// moved before it, so the events are replayed in order.
+func forwarded(events []Event) []Event {
+	moved := make([]bool, len(events))
+	ordered := make([]Event, 0, len(events))
+	var parents []Event
+	for i, event := range events {
+		open, ok := event.(OpenEvent)
+		if !ok {
+			ordered = append(ordered, event)
+			continue
+		}
+		if moved[i] {
+			continue
+		}
+
+		parents = append(parents[:0], OpenEvent{Kind: open.Kind})
+		for j := i; open.Forward > 0 && j+open.Forward < len(events); {
+			j += open.Forward
+			if open, ok = events[j].(OpenEvent); !ok {
+				break
+			}
+			moved[j] = true
+			parents = append(parents, OpenEvent{Kind: open.Kind})
+		}
+		for k := len(parents) - 1; k >= 0; k-- {
+			ordered = append(ordered, parents[k])
+		}
+	}
+	return ordered
+}
+
+// Events returns the events recorded by the parser, that
+// are replayed by BuildTree.
+func (p *Parser) Events() []Event {
+	return p.events
+}
+
+// open opens a new node, which kind is set when it's
+// closed.
+func (p *Parser) open() openMark {
+	mark := openMark{index: len(p.events)}
+	p.events = append(p.events, OpenEvent{})
+	return mark
+}
+
+// openBefore opens a new node before the given closed
+// node, so it becomes the first child of the new node,
+// like the left hand side of a binary expression.
+//
+// The new open event is added at the end, and linked
+// from the closed node, instead of inserted before it,
+// so the long chains of binary expressions aren't slow.
+func (p *Parser) openBefore(m closedMark) openMark {
+	mark := p.open()
+	event := p.events[m.index].(OpenEvent)
+	event.Forward = mark.index - m.index
+	p.events[m.index] = event
+	return mark
+}
+
+// close closes the given node with the given kind.
+func (p *Parser) close(m openMark, kind NodeKind) closedMark {
+	p.events[m.index] = OpenEvent{Kind: kind, Forward: p.events[m.index].(OpenEvent).Forward}
+	p.events = append(p.events, CloseEvent{})
+	return closedMark{index: m.index}
+}
+
+// kindOf returns the kind of the given closed node.
+func (p *Parser) kindOf(m closedMark) NodeKind {
+	return p.events[m.index].(OpenEvent).Kind
+}
+
+// advance consumes the current token, adding it to the
+// open node. The stuck parser doesn't consume tokens.
+func (p *Parser) advance() {
+	if p.stuck || p.index >= len(p.tokens) {
+		return
+	}
+	p.fuel, p.floor = maxFuel, p.depth
+	p.events = append(p.events, AdvanceEvent{})
+	p.index++
+}
+
+// nth returns the kind of the token that is n tokens
+// ahead, or EOF past the end of the tokens, or when the
+// parser is stuck.
+func (p *Parser) nth(n int) TokenKind {
+	if p.stuck {
+		return EOF
+	}
+	if p.fuel == 0 {
+		if !p.stuck {
+			p.stuck = true
+			p.errors = append(p.errors, NewDiagnostic(CompilerError, ErrorSeverity, parserStuckCode, p.current().Location(), NewText("the parser is stuck, and stopped parsing here")))
+		}
+		return EOF
+	}
+	p.fuel--
+
+	if p.index+n >= len(p.tokens) {
+		return EOF
+	}
+	return p.tokens[p.index+n].Kind
+}
+
+// current returns the current token, or the last one
+// past the end of the tokens.
+func (p *Parser) current() Token {
+	if len(p.tokens) == 0 {
+		return Token{Kind: EOF}
+	}
+	if p.index >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.index]
+}
+
+// at returns true if the current token is of the
+// given kind.
+func (p *Parser) at(kind TokenKind) bool {
+	return p.nth(0) == kind
+}
+
+// eof returns true if the parser is at the end of the
+// tokens.
+func (p *Parser) eof() bool {
+	return p.at(EOF)
+}
+
+// eat consumes the current token if it's of the given
+// kind, and returns true if it was consumed.
+func (p *Parser) eat(kind TokenKind) bool {
+	if !p.at(kind) {
+		return false
+	}
+	p.advance()
+	return true
+}
+
+// expect consumes the current token if it's of the
+// given kind, or reports that it was expected.
+func (p *Parser) expect(kind TokenKind) {
+	if p.eat(kind) {
+		return
+	}
+	p.report(unexpectedTokenCode, NewText("expected"), NewCode(kind.String()), NewText("but found"), NewCode(p.current().Kind.String()))
+}
+
+// enter enters a nested rule, and gets the parser stuck
+// if it's nested too deeply, so the rules stop, and the
+// partial tree is returned. It's paired with leave.
+func (p *Parser) enter() {
+	p.depth++
+	if p.depth > maxDepth && !p.stuck {
+		p.stuck = true
+		p.errors = append(p.errors, NewDiagnostic(CompilerError, ErrorSeverity, nestingCode, p.current().Location(), NewText("the code is nested too deeply, and the parser stopped here")))
+	}
+}
+
+// leave leaves the nested rule entered by enter.
+func (p *Parser) leave() {
+	p.depth--
+	if p.depth < p.floor {
+		p.floor, p.fuel = p.depth, maxFuel
+	}
+}
+
+// atSoftKeyword returns true if the current token is
+// an identifier, that is the given soft keyword, and
+// is followed by another identifier, like `is Int`.
+func (p *Parser) atSoftKeyword(kind TokenKind) bool {
+	_, ok := p.current().AsSoftKeyword(kind)
+	return ok && p.nth(1) == Identifier
+}
+
+// promote promotes the current token to the given soft
+// keyword, so it appears as a keyword in the tree.
+func (p *Parser) promote(kind TokenKind) {
+	if token, ok := p.current().AsSoftKeyword(kind); ok && p.index < len(p.tokens) {
+		p.tokens[p.index] = token
+	}
+}
+
+// split splits the current `>>` token in two `>`
+// tokens, so each one closes a type argument list.
+// The leading trivia stays with the first one.
+func (p *Parser) split() {
+	token := p.tokens[p.index]
+	first, second := token, token
+	first.Kind, first.Text, first.FullText = Greater, ">", token.FullText[:len(token.FullText)-1]
+	second.Kind, second.Text, second.FullText = Greater, ">", ">"
+	if token.file != nil {
+		first.end = token.start + 1
+		second.start = token.start + 1
+	}
+	p.tokens[p.index] = first
+	p.tokens = slices.Insert(p.tokens, p.index+1, second)
+}
+
+// atNewline returns true if the current token starts
+// a new line, where the expressions end, unless they
+// are inside of parentheses or brackets.
+func (p *Parser) atNewline() bool {
+	return p.nesting == 0 && strings.Contains(triviaOf(p.current()), "\n")
+}
 
-	return Parser{input: input, tokens: tokens, fuel: 256}
+// report adds a parser diagnostic, at the location of
+// the current token, unless the parser is stuck, as the
+// rules only see the end of the input then.
+func (p *Parser) report(code string, text ...ErrorText) {
+	if p.stuck {
+		return
+	}
+	p.errors = append(p.errors, NewDiagnostic(ParserError, ErrorSeverity, code, p.current().Location(), text...))
 }
@@ -0,0 +1,168 @@
+package tonho_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tonho"
+)
+
+// update rewrites the golden files with the dumps of the
+// trees, like `go test -run TestParseGolden -update`.
+var update = flag.Bool("update", false, "update the golden files")
+
+// parseTests are the parses that are compared to the golden
+// files in testdata/parse, by the name of the file, where the
+// inputs are parsed as files, without any diagnostic.
+var parseTests = []struct {
+	name, input string
+}{
+	// The binary operators are parsed by their precedence, and
+	// the unary and postfix ones bind tighter than all of them.
+	{"binary", "1 + 2 * 3 - 4"},
+	{"binary_logical", "a || b && !c == d"},
+	{"binary_comparison", "a < b + 1 && c >= d"},
+	{"unary", "-a + !b"},
+	{"postfix", "a.b(c)[d].e"},
+	{"parens", "(1 + 2) * 3"},
+
+	{"val", "val x = 1"},
+	{"var_typed", "var x: Int = 1"},
+	{"assign", "x = y + 1"},
+	{"assign_compound", "x += 1"},
+	{"statements", "val x = 1\nx = 2\nf(x)"},
+
+	{"fun", "fun f(a: Int, b: String) -> Int { a }"},
+	{"fun_empty", "fun f() {}"},
+	{"fun_statements", "fun f(x: Int) {\n  val y = x\n  y\n}"},
+
+	{"struct", "struct P { x: Int, y: Int }"},
+	{"struct_empty", "struct Unit {}"},
+
+	{"enum", "enum Color { Red, Green, Blue }"},
+	{"enum_payload", "enum Shape { Circle(Float), Rect(Float, Float) }"},
+
+	{"when", "when (x) {\n  1 -> a\n  else -> b\n}"},
+	{"when_subjectless", "when {\n  x > 1 -> a\n  else -> b\n}"},
+
+	{"if_else", "val x = if (a) 1 else 2"},
+	{"if_else_if", "if (a) { b } else if (c) { d } else { e }"},
+
+	{"while", "while (x < 10) { x += 1 }"},
+	{"for_in", "for (x in xs) { f(x) }"},
+	{"loop", "loop { break }"},
+
+	{"generic_fun", "fun f<T: Show, U>(x: T) -> U { g(x) }"},
+	{"generic_struct", "struct Box<T> { value: T }"},
+
+	{"type_application", "val x: Map<String, List<Int>> = m"},
+	{"type_function", "val f: (Int, Int) -> Bool = g"},
+	{"type_optional", "val x: Int? = y"},
+	{"type_tuple", "val p: (Int, String) = q"},
+
+	{"module", "module a.b"},
+	{"import", "import a.b as c"},
+	{"import_items", "import a.b.{c, d as e}"},
+
+	{"lambda", "val f = { a, b -> a + b }"},
+	{"lambda_it", "val f = { it }"},
+	{"lambda_trailing", "xs.map { it * 2 }"},
+
+	{"list", "val xs = [1, 2, 3]"},
+	{"list_empty", "val xs = []"},
+
+	{"map", "val m = #{\"a\": 1, \"b\": 2}"},
+	{"map_empty", "val m = #{}"},
+
+	{"tuple", "val p = (1, \"a\")"},
+	{"tuple_destructuring", "val (a, b) = p"},
+
+	{"trailing_commas", "f(1, 2,)\nval xs = [1,]\nstruct P { x: Int, }"},
+
+	{"call_chain", "xs\n  .map { it }\n  .filter(p)"},
+
+	{"jumps", "fun f() {\n  return 1\n}\n@a loop {\n  continue @a\n  break @a\n}"},
+
+	{"interpolation", "val s = \"a ${b + 1} c\""},
+
+	{"attributes", "@inline @deprecated(\"old\")\nfun f() {}"},
+
+	{"defer", "fun f() {\n  defer { close() }\n  g()\n}"},
+
+	{"patterns", "when (x) {\n  Shape.Circle(r) -> r\n  (a, _) -> a\n  _ -> 0\n}"},
+
+	{"guards", "when (s) {\n  Circle(r) if r > 0 -> r\n  else -> 0\n}"},
+
+	{"ranges", "for (i in 0..n by 2) {}\nval ys = xs[1..=3]"},
+
+	{"named_arguments", "f(1, ...rest, b: 2)"},
+
+	{"default_parameters", "fun f(a: Int, b: Int = 1) {}"},
+
+	{"variadic_parameters", "fun f(a: Int, xs: ...Int) {}"},
+}
+
+func TestParseGolden(t *testing.T) {
+	for _, test := range parseTests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, diagnostics := tonho.Parse("test", test.input)
+			if len(diagnostics) > 0 {
+				t.Fatalf("parsing %q: %v", test.input, diagnostics)
+			}
+			checkGolden(t, test.name, test.input, tree.Dump()+"\n")
+		})
+	}
+}
+
+// recoveryTests are the parses with errors that are compared
+// to the golden files in testdata/parse, with their
+// diagnostics after the trees.
+var recoveryTests = []struct {
+	name, input string
+}{
+	{"recovery_statement", "val x = )\nval y = 1"},
+	{"recovery_argument", "f(1, , 2)"},
+	{"recovery_block", "fun f() {\n  val = 1\n  g()\n}"},
+}
+
+func TestParseRecovery(t *testing.T) {
+	for _, test := range recoveryTests {
+		t.Run(test.name, func(t *testing.T) {
+			tree, diagnostics := tonho.Parse("test", test.input)
+			if len(diagnostics) == 0 {
+				t.Fatalf("parsing %q, got no diagnostics", test.input)
+			}
+			if got := tonho.Print(tree); got != test.input {
+				t.Fatalf("parsing %q, got the text %q", test.input, got)
+			}
+			checkGolden(t, test.name, test.input, tree.Dump()+"\n"+diagnosticsText(diagnostics))
+		})
+	}
+}
+
+// checkGolden compares the dump of the parse of the input
+// to the golden file with the given name, or rewrites the
+// file with it, if the tests are run with -update.
+func checkGolden(t *testing.T, name, input, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", "parse", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Errorf("parsing %q, got the tree:\n%s\nwant:\n%s", input, got, want)
+	}
+}
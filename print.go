@@ -0,0 +1,87 @@
+package tonho
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Print returns the source code of the tree, that is the
+// full texts of its tokens, so the source code that the
+// tree was parsed from is printed back exactly, with its
+// trivia.
+func Print(tree Tree) string {
+	var text strings.Builder
+	for _, token := range leaves(tree, nil) {
+		text.WriteString(token.FullText)
+	}
+	return text.String()
+}
+
+// PrintNormalized returns the source code of the tree,
+// without the comments, and with the trivia between the
+// tokens normalized to a newline if it had one, to a space
+// if it wasn't empty, or to nothing, so the printed code
+// parses into the same tree, regardless of its formatting.
+//
+// The trivia that is kept is the one before the first
+// token, as the lexer looks at the first bytes for the
+// encoding and the shebang, and the one between a shift
+// like `<<EOF` and a newline, as without its comments the
+// shift would be lexed as a heredoc.
+func PrintNormalized(tree Tree) string {
+	var text strings.Builder
+	tokens := leaves(tree, nil)
+	for i, token := range tokens {
+		trivia := triviaOf(token)
+		switch {
+		case i == 0:
+			text.WriteString(trivia)
+		case i > 1 && tokens[i-2].Kind == ShiftLeft && triviaOf(tokens[i-1]) == "" && strings.Contains(trivia, "\n"):
+			text.WriteString(trivia)
+		case strings.Contains(trivia, "\n"):
+			text.WriteByte('\n')
+		case trivia != "":
+			text.WriteByte(' ')
+		}
+		text.WriteString(token.FullText[len(trivia):])
+	}
+	return text.String()
+}
+
+// VerifyPrint parses the source code, prints it back both
+// exactly and normalized, and returns an error if the
+// exact print isn't the source code, or if the parses of
+// the prints aren't the same tree, with the same number
+// of syntax errors, as the parse of the source code.
+func VerifyPrint(filename, source string) error {
+	tree, diagnostics := Parse(filename, source)
+	if printed := Print(tree); printed != source {
+		return fmt.Errorf("%s: the printed code %q isn't the source code", filename, printed)
+	}
+
+	printed := PrintNormalized(tree)
+	reparsed, rediagnostics := Parse(filename, printed)
+	if edits := Diff(tree, reparsed); len(edits) > 0 {
+		edit := edits[0]
+		return fmt.Errorf("%s: the normalized code parses into another tree, with %d edits, the first one a %s at %v",
+			filename, len(edits), edit.Kind, edit.OldPath)
+	}
+	if got, want := syntaxErrors(rediagnostics), syntaxErrors(diagnostics); got != want {
+		return fmt.Errorf("%s: the normalized code has %d syntax errors, instead of %d",
+			filename, got, want)
+	}
+	return nil
+}
+
+// syntaxErrors counts the diagnostics that aren't from the
+// lexer, as the ones of the comments, like an unterminated
+// one, are gone from the normalized code.
+func syntaxErrors(diagnostics []Diagnostic) int {
+	count := 0
+	for _, diagnostic := range diagnostics {
+		if diagnostic.Kind() != LexerError {
+			count++
+		}
+	}
+	return count
+}
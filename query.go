@@ -0,0 +1,347 @@
+package tonho
+
+import (
+	"fmt"
+	"iter"
+	"strings"
+)
+
+// Selector is a compiled query, that matches the nodes of
+// a tree, like the CSS selectors match the HTML elements.
+//
+// A query is a list of alternatives separated by commas,
+// and each alternative is a list of steps separated by
+// the combinators, that are either `>` to match a child of
+// the previous step, or spaces to match any descendant:
+//
+//	FunNode > ParameterNode[name=x], ReturnNode
+//
+// Each step is a node name, like FunNode, or `*` to match
+// any node, with optional filters between brackets, that
+// are the attribute to test, and the value to compare it
+// with, either bare or quoted. Without a value, the filter
+// only checks that the attribute isn't empty. The
+// attributes are:
+//
+//   - name: the text of the first identifier token of the
+//     node, like the name of a function or a parameter.
+//   - text: the text of the node, without its leading
+//     trivia.
+type Selector struct {
+	source       string
+	alternatives [][]selectorStep
+}
+
+// selectorStep is a step of a selector, that matches a node
+// of the kind, or of any kind if it's negative.
+type selectorStep struct {
+	// combinator joins the step to the previous one,
+	// and is either `>` or a space, or 0 for the first.
+	combinator byte
+	kind       NodeKind
+	filters    []selectorFilter
+}
+
+// selectorFilter is a filter of a step, like `[name=x]`.
+type selectorFilter struct {
+	attribute string
+	value     string
+	compare   bool
+}
+
+// Query compiles the query into a selector, or returns an
+// error if it's malformed, or if it names unknown node kinds
+// or attributes.
+func Query(query string) (*Selector, error) {
+	q := &queryParser{source: query}
+	selector := &Selector{source: query}
+	for {
+		steps, err := q.alternative()
+		if err != nil {
+			return nil, err
+		}
+		selector.alternatives = append(selector.alternatives, steps)
+		q.spaces()
+		if q.done() {
+			return selector, nil
+		}
+		if !q.eat(',') {
+			return nil, q.errorf("expected `,` or a combinator")
+		}
+	}
+}
+
+// MustQuery compiles the query like Query, but panics if
+// it's malformed, so the selectors can be global variables.
+func MustQuery(query string) *Selector {
+	selector, err := Query(query)
+	if err != nil {
+		panic(err)
+	}
+	return selector
+}
+
+// String returns the query of the selector.
+func (s *Selector) String() string {
+	return s.source
+}
+
+// Match returns true if the node at the cursor matches the
+// selector, looking at its ancestors for the combinators.
+func (s *Selector) Match(cursor *Cursor) bool {
+	for _, steps := range s.alternatives {
+		if matchSteps(steps, cursor) {
+			return true
+		}
+	}
+	return false
+}
+
+// All returns the cursors at the nodes of the tree that
+// match the selector, in the order of the source code.
+func (s *Selector) All(root Node) iter.Seq[*Cursor] {
+	return func(yield func(*Cursor) bool) {
+		selectAll(s, NewCursor(root), yield)
+	}
+}
+
+// selectAll yields the matching nodes under the cursor,
+// and returns false if the iteration was stopped.
+func selectAll(s *Selector, cursor *Cursor, yield func(*Cursor) bool) bool {
+	node, ok := cursor.tree.(Node)
+	if !ok {
+		return true
+	}
+	if s.Match(cursor) && !yield(cursor) {
+		return false
+	}
+	for i := range node.Children {
+		if !selectAll(s, cursor.Child(i), yield) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSteps returns true if the cursor matches the last
+// step, and its ancestors match the steps before it.
+func matchSteps(steps []selectorStep, cursor *Cursor) bool {
+	last := steps[len(steps)-1]
+	if !last.match(cursor.tree) {
+		return false
+	}
+	if len(steps) == 1 {
+		return true
+	}
+	rest := steps[:len(steps)-1]
+	for parent := cursor.parent; parent != nil; parent = parent.parent {
+		if matchSteps(rest, parent) {
+			return true
+		}
+		if last.combinator == '>' {
+			return false
+		}
+	}
+	return false
+}
+
+// match returns true if the tree is a node of the kind of
+// the step, that passes all of its filters.
+func (s selectorStep) match(tree Tree) bool {
+	node, ok := tree.(Node)
+	if !ok || s.kind >= 0 && node.Kind != s.kind {
+		return false
+	}
+	for _, filter := range s.filters {
+		value := attribute(node, filter.attribute)
+		if filter.compare && value != filter.value || !filter.compare && value == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// attribute gets the attribute of the node, that is
+// either its name or its text.
+func attribute(node Node, name string) string {
+	switch name {
+	case "name":
+		for _, child := range node.Children {
+			if token, ok := child.(Token); ok && token.Kind == Identifier {
+				return token.Text
+			}
+		}
+	case "text":
+		var text strings.Builder
+		for i, token := range leaves(node, nil) {
+			if i == 0 {
+				text.WriteString(token.FullText[len(triviaOf(token)):])
+			} else {
+				text.WriteString(token.FullText)
+			}
+		}
+		return text.String()
+	}
+	return ""
+}
+
+// queryParser parses the source of a query.
+type queryParser struct {
+	source string
+	offset int
+}
+
+// alternative parses the steps of an alternative, until a
+// comma or the end of the query.
+func (q *queryParser) alternative() ([]selectorStep, error) {
+	var steps []selectorStep
+	for {
+		spaced := q.spaces()
+		if q.done() || q.peek() == ',' {
+			break
+		}
+		var combinator byte
+		switch {
+		case q.eat('>'):
+			combinator = '>'
+			q.spaces()
+		case spaced:
+			combinator = ' '
+		}
+		if len(steps) == 0 && combinator == '>' {
+			return nil, q.errorf("expected a node name before `>`")
+		}
+		if len(steps) > 0 && combinator == 0 {
+			return nil, q.errorf("expected a combinator")
+		}
+		step, err := q.step()
+		if err != nil {
+			return nil, err
+		}
+		if len(steps) == 0 {
+			step.combinator = 0
+		} else {
+			step.combinator = combinator
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, q.errorf("expected a node name")
+	}
+	return steps, nil
+}
+
+// step parses a node name, or `*`, with its filters.
+func (q *queryParser) step() (selectorStep, error) {
+	step := selectorStep{kind: -1}
+	if !q.eat('*') {
+		start := q.offset
+		name := q.word()
+		if name == "" {
+			return step, q.errorf("expected a node name")
+		}
+		kind, ok := NodeKindNamed(name)
+		if !ok {
+			q.offset = start
+			return step, q.errorf("unknown node kind %q", name)
+		}
+		step.kind = kind
+	}
+	for q.eat('[') {
+		q.spaces()
+		start := q.offset
+		filter := selectorFilter{attribute: q.word()}
+		if filter.attribute != "name" && filter.attribute != "text" {
+			q.offset = start
+			return step, q.errorf("unknown attribute %q", filter.attribute)
+		}
+		q.spaces()
+		if q.eat('=') {
+			q.spaces()
+			value, err := q.value()
+			if err != nil {
+				return step, err
+			}
+			filter.value, filter.compare = value, true
+			q.spaces()
+		}
+		if !q.eat(']') {
+			return step, q.errorf("expected `]`")
+		}
+		step.filters = append(step.filters, filter)
+	}
+	return step, nil
+}
+
+// value parses the value of a filter, either a word or a
+// quoted string, where `\` escapes the next character.
+func (q *queryParser) value() (string, error) {
+	if !q.eat('"') {
+		return q.word(), nil
+	}
+	var value strings.Builder
+	for !q.done() {
+		c := q.source[q.offset]
+		q.offset++
+		switch {
+		case c == '"':
+			return value.String(), nil
+		case c == '\\' && !q.done():
+			value.WriteByte(q.source[q.offset])
+			q.offset++
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", q.errorf("unterminated string")
+}
+
+// word parses the letters, digits and underscores at the
+// offset, that may be empty.
+func (q *queryParser) word() string {
+	start := q.offset
+	for !q.done() {
+		c := q.source[q.offset]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			break
+		}
+		q.offset++
+	}
+	return q.source[start:q.offset]
+}
+
+// spaces skips the spaces, and returns true if any.
+func (q *queryParser) spaces() bool {
+	start := q.offset
+	for !q.done() && (q.peek() == ' ' || q.peek() == '\t' || q.peek() == '\n') {
+		q.offset++
+	}
+	return q.offset > start
+}
+
+// eat skips the character if it's at the offset.
+func (q *queryParser) eat(c byte) bool {
+	if q.peek() != c || q.done() {
+		return false
+	}
+	q.offset++
+	return true
+}
+
+// peek gets the character at the offset, or 0 at the end.
+func (q *queryParser) peek() byte {
+	if q.done() {
+		return 0
+	}
+	return q.source[q.offset]
+}
+
+// done returns true at the end of the query.
+func (q *queryParser) done() bool {
+	return q.offset >= len(q.source)
+}
+
+// errorf creates an error at the offset of the query.
+func (q *queryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("query %q, at %d: %s", q.source, q.offset, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,128 @@
+package tonho
+
+import "sort"
+
+// TextEdit represents an edit of the source code, that replaces
+// the text between the Start and End byte offsets with Text.
+type TextEdit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+// Apply returns the given text with the edit applied.
+func (e TextEdit) Apply(text string) string {
+	return text[:e.Start] + e.Text + text[e.End:]
+}
+
+// Relex re-tokenizes the source code of the given tokens, with
+// the edit applied, and returns the new tokens.
+//
+// Only the region affected by the edit is scanned again, the
+// tokens before it, and the ones after the first token boundary
+// that is the same in both texts, are reused, with their
+// locations moved to the new text. The tokens are expected to
+// be lexed with the default options.
+func Relex(old []Token, edit TextEdit) []Token {
+	if len(old) == 0 || old[len(old)-1].Location() == nil {
+		return nil
+	}
+
+	last := old[len(old)-1].Location()
+	source := last.Text()
+	edit.Start = clamp(edit.Start, 0, len(source))
+	edit.End = clamp(edit.End, edit.Start, len(source))
+
+	input := edit.Apply(source)
+	delta := len(edit.Text) - (edit.End - edit.Start)
+	editEnd := edit.Start + len(edit.Text)
+	file := NewSourceFile(last.File(), input)
+
+	// The token before the first one touched by the edit is
+	// scanned again too, as the edit can join them, like when
+	// a digit is typed after `1.`.
+	first := sort.Search(len(old), func(i int) bool { return old[i].Location().End() >= edit.Start })
+	if first > 0 {
+		first--
+	}
+
+	// The lexing restarts out of the strings, before the one
+	// that holds the interpolation touched by the edit, and it
+	// can stop only out of the strings too, where the depth
+	// of the interpolations is zero.
+	depths := make([]int, len(old))
+	var open []int
+	for i, token := range old {
+		switch token.Kind {
+		case StringStart:
+			open = append(open, i)
+		case StringEnd:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+		depths[i] = len(open)
+		if i == first-1 && len(open) > 0 {
+			first = open[0]
+		}
+	}
+	restart := old[first].Location().End() - len(old[first].FullText)
+
+	tokens := make([]Token, 0, len(old)+1)
+	for _, token := range old[:first] {
+		tokens = append(tokens, token.relocated(0, file))
+	}
+
+	l := lexer{file: file, input: input, position: restart, trivia: restart}
+	if first > 0 {
+		l.previous = old[first-1].Kind
+	}
+	for {
+		more := l.step()
+		for _, token := range l.tokens {
+			tokens = append(tokens, token)
+
+			// When a new token ends at the same place as an old
+			// one, after the edit, the rest of the text is the
+			// same, and so are the tokens.
+			end := token.Location().End()
+			if end <= editEnd || token.Kind == EOF {
+				continue
+			}
+			i := sort.Search(len(old), func(i int) bool { return old[i].Location().End() >= end-delta })
+			if i < len(old) && old[i].Kind != EOF && old[i].Location().End() == end-delta && old[i].Kind == token.Kind && len(l.templates) == 0 && depths[i] == 0 {
+				for _, token := range old[i+1:] {
+					tokens = append(tokens, token.relocated(delta, file))
+				}
+				return tokens
+			}
+		}
+		l.tokens = l.tokens[:0]
+
+		if !more {
+			return tokens
+		}
+	}
+}
+
+// relocated returns the token with its location moved by the
+// given delta, into the given source file.
+func (t Token) relocated(delta int, file *SourceFile) Token {
+	if t.file != nil {
+		t.start += delta
+		t.end += delta
+		t.file = file
+	}
+	return t
+}
+
+// clamp returns the given value limited to the given range.
+func clamp(value, low, high int) int {
+	if value < low {
+		return low
+	}
+	if value > high {
+		return high
+	}
+	return value
+}
@@ -0,0 +1,40 @@
+package tonho_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"tonho"
+)
+
+// tokenText formats the token, with its texts, its number
+// base and suffix, and its span, to compare them.
+func tokenText(token tonho.Token) string {
+	location := token.Location()
+	return fmt.Sprintf("%s %q %q %d %q %d-%d %d:%d", token.Kind, token.Text, token.FullText, token.Base, token.Suffix,
+		location.Start(), location.End(), location.Line(), location.Column())
+}
+
+func TestRelexMatchesLex(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for range 1000 {
+		source := editSource
+		tokens, _ := tonho.Lex("test", source)
+		for range 5 {
+			edit := randomEdit(r, source)
+			source = edit.Apply(source)
+			tokens = tonho.Relex(tokens, edit)
+
+			want, _ := tonho.Lex("test", source)
+			if len(tokens) != len(want) {
+				t.Fatalf("relexing %q, got %d tokens, want %d", source, len(tokens), len(want))
+			}
+			for i := range tokens {
+				if got, want := tokenText(tokens[i]), tokenText(want[i]); got != want {
+					t.Fatalf("relexing %q, got the token %d %s, want %s", source, i, got, want)
+				}
+			}
+		}
+	}
+}
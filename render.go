@@ -0,0 +1,465 @@
+package tonho
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// snippetLines is the number of lines of a location that
+// are shown, as the first and the last lines of a larger
+// one are shown around a `...`.
+const snippetLines = 6
+
+// Renderer renders the diagnostics for a terminal, like
+// rustc, with a header, the lines of the source code at
+// the location, and the markers under it:
+//
+//	error[T0002]: unterminated string literal, expected `"`
+//	 --> main.tn:3:16
+//	  |
+//	3 | val greeting = "hello
+//	  |                ^^^^^^
+//
+// The renderer colors the diagnostics with ANSI escapes,
+// if Color is true, like the ones of NewRenderer for a
+// terminal.
+type Renderer struct {
+	// Color enables the colors, with the header and the
+	// markers colored by the severity, and the line
+	// numbers dimmed.
+	Color bool
+
+	// Sources holds the source code of the files, by
+	// name, for the locations that don't have their text,
+	// like the spans decoded from JSON. The diagnostics
+	// of the files without it have no snippet.
+	Sources map[string]string
+
+	files map[string]*SourceFile
+}
+
+// NewRenderer creates a renderer for the given writer,
+// with the colors enabled if it's a terminal, unless the
+// NO_COLOR environment variable is set, or TERM is dumb.
+func NewRenderer(w io.Writer) *Renderer {
+	return &Renderer{Color: colorEnabled(w)}
+}
+
+// colorEnabled returns true if the writer is a terminal,
+// that supports the colors, and the user didn't disable
+// them, like https://no-color.org says.
+func colorEnabled(w io.Writer) bool {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// The ANSI styles of the parts of the diagnostics.
+const (
+	boldStyle    = "1"
+	dimStyle     = "2"
+	errorStyle   = "1;31"
+	warningStyle = "1;33"
+	infoStyle    = "1;34"
+	hintStyle    = "1;36"
+
+	// secondaryStyle is the style of the markers and the
+	// texts of the secondary labels.
+	secondaryStyle = "1;34"
+)
+
+// severityStyle returns the style of the header and the
+// markers of a diagnostic of the given severity.
+func severityStyle(severity Severity) string {
+	switch severity {
+	case WarningSeverity:
+		return warningStyle
+	case InfoSeverity:
+		return infoStyle
+	case HintSeverity:
+		return hintStyle
+	}
+	return errorStyle
+}
+
+// paint returns the text with the given style, if the
+// colors are enabled.
+func (r *Renderer) paint(text, style string) string {
+	if !r.Color || text == "" {
+		return text
+	}
+	return "\x1b[" + style + "m" + text + "\x1b[0m"
+}
+
+// Render writes the diagnostic to the writer.
+func (r *Renderer) Render(w io.Writer, diagnostic Diagnostic) error {
+	out := bufio.NewWriter(w)
+	style := severityStyle(diagnostic.Severity())
+	header := diagnostic.Severity().String()
+	if code := diagnostic.Code(); code != "" {
+		header += "[" + code + "]"
+	}
+	fmt.Fprintf(out, "%s%s\n", r.paint(header, style), r.paint(": "+message(diagnostic.Error()), boldStyle))
+
+	r.snippets(out, diagnostic, style)
+	return out.Flush()
+}
+
+// RenderAll writes the diagnostics to the writer, with a
+// blank line between them.
+func (r *Renderer) RenderAll(w io.Writer, diagnostics []Diagnostic) error {
+	for i, diagnostic := range diagnostics {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := r.Render(w, diagnostic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// annotation is a location that is marked in the snippets
+// of a diagnostic, either the primary location or one of
+// its labels, with the text of the label.
+type annotation struct {
+	location    Location
+	primary     bool
+	text        string
+	first, last int // the lines of the location
+}
+
+// annotations returns the primary location and the labels
+// of the diagnostic, grouped by file, in the order of the
+// files of their locations, from the one of the primary
+// location. The primary location isn't repeated, if a
+// primary label is at it.
+func annotations(diagnostic Diagnostic) [][]annotation {
+	var all []annotation
+	location := diagnostic.Location()
+	labeled := slices.ContainsFunc(diagnostic.Labels(), func(label Label) bool {
+		return label.Primary && label.Location != nil && location != nil &&
+			label.Location.File() == location.File() && label.Location.Start() == location.Start() && label.Location.End() == location.End()
+	})
+	if location != nil && !labeled {
+		all = append(all, annotation{location: location, primary: true})
+	}
+	for _, label := range diagnostic.Labels() {
+		if label.Location != nil {
+			all = append(all, annotation{location: label.Location, primary: label.Primary, text: message(label.Text)})
+		}
+	}
+
+	var groups [][]annotation
+	for _, current := range all {
+		index := slices.IndexFunc(groups, func(group []annotation) bool {
+			return group[0].location.File() == current.location.File()
+		})
+		if index < 0 {
+			groups = append(groups, nil)
+			index = len(groups) - 1
+		}
+		groups[index] = append(groups[index], current)
+	}
+	return groups
+}
+
+// snippets writes the positions of the locations of the
+// diagnostic, and the lines of the source code they span,
+// with the markers under them, `^` for the primary ones
+// and `-` for the others, and the texts of their labels,
+// if their files are known:
+//
+//	error: mismatched types
+//	 --> main.tn:3:14
+//	  |
+//	1 | fun f(): Int {
+//	  |          --- expected due to this
+//	2 |     val x = 1
+//	3 |     return "a"
+//	  |            ^^^ expected `Int`, but found `String`
+func (r *Renderer) snippets(out *bufio.Writer, diagnostic Diagnostic, style string) {
+	groups := annotations(diagnostic)
+	files := make([]*SourceFile, len(groups))
+	width := 0
+	for i, group := range groups {
+		files[i] = r.source(group[0].location)
+		if files[i] == nil {
+			continue
+		}
+		for j := range group {
+			start, end := span(group[j].location)
+			group[j].first, _ = files[i].PositionFor(start)
+			group[j].last, _ = files[i].PositionFor(max(end-1, start))
+			width = max(width, len(strconv.Itoa(group[j].last)))
+		}
+	}
+	gutter := strings.Repeat(" ", max(width, 1))
+	bar := r.paint("|", dimStyle)
+
+	for i, group := range groups {
+		arrow := "-->"
+		if i > 0 || !group[0].primary {
+			arrow = ":::"
+		}
+		location := group[0].location
+		fmt.Fprintf(out, "%s%s %s:%d:%d\n", gutter, r.paint(arrow, dimStyle), location.File(), location.Line(), location.Column())
+		if files[i] == nil {
+			// Without the source code, the labels are
+			// written as notes after the position.
+			for _, annotation := range group {
+				if annotation.text != "" {
+					fmt.Fprintf(out, "%s %s %d:%d: %s\n", gutter, r.paint("=", dimStyle), annotation.location.Line(), annotation.location.Column(), annotation.text)
+				}
+			}
+			continue
+		}
+
+		fmt.Fprintf(out, "%s %s\n", gutter, bar)
+		previous := 0
+		for _, n := range snippetLinesOf(group) {
+			if previous > 0 && n > previous+1 {
+				fmt.Fprintf(out, "%s\n", r.paint("...", dimStyle))
+			}
+			previous = n
+			r.line(out, files[i], n, group, gutter, style)
+		}
+	}
+}
+
+// snippetLinesOf returns the lines shown for the given
+// annotations, in order, with only the first and the last
+// lines of the long ones, and the lines between the ones
+// that are shown, if there's only one.
+func snippetLinesOf(group []annotation) []int {
+	var lines []int
+	for _, annotation := range group {
+		for n := annotation.first; n <= annotation.last; n++ {
+			if annotation.last-annotation.first >= snippetLines && n == annotation.first+snippetLines/2 {
+				n = annotation.last - snippetLines/2 + 1
+			}
+			lines = append(lines, n)
+		}
+	}
+	slices.Sort(lines)
+	lines = slices.Compact(lines)
+	for i := len(lines) - 1; i > 0; i-- {
+		if lines[i] == lines[i-1]+2 {
+			lines = slices.Insert(lines, i, lines[i]-1)
+		}
+	}
+	return lines
+}
+
+// segment is the part of a line under an annotation, in
+// the columns of the line, with the text of the label on
+// the last line of the annotation.
+type segment struct {
+	from, to int
+	primary  bool
+	text     string
+}
+
+// line writes a line of a snippet, and the markers and the
+// labels of the annotations on it. The rightmost label is
+// written after the markers, and the others under them,
+// like:
+//
+//	3 |     val x: Int = "a"
+//	  |            ---   ^^^ expected `Int`
+//	  |            |
+//	  |            expected due to this
+func (r *Renderer) line(out *bufio.Writer, file *SourceFile, n int, group []annotation, gutter, style string) {
+	text := file.LineText(n)
+	offset := file.OffsetFor(n, 1)
+	fmt.Fprintf(out, "%s", r.paint(fmt.Sprintf("%*d |", len(gutter), n), dimStyle))
+	if text != "" {
+		fmt.Fprintf(out, " %s", expandTabs(text))
+	}
+	out.WriteByte('\n')
+
+	// The markers are under the part of the line that the
+	// location spans, or under its start, if it's empty,
+	// like the location of the end of the file.
+	var segments []segment
+	for _, annotation := range group {
+		if n < annotation.first || n > annotation.last {
+			continue
+		}
+		start, end := span(annotation.location)
+		from := clamp(start-offset, 0, len(text))
+		to := clamp(end-offset, from, len(text))
+		s := segment{from: displayWidth(text[:from]), primary: annotation.primary}
+		s.to = s.from + displayWidth(text[from:to])
+		if s.to == s.from && n == annotation.first {
+			s.to++
+		}
+		if n == annotation.last {
+			s.text = annotation.text
+		}
+		if s.to > s.from {
+			segments = append(segments, s)
+		}
+	}
+	if len(segments) == 0 {
+		return
+	}
+	slices.SortStableFunc(segments, func(a, b segment) int { return a.from - b.from })
+
+	// The primary markers are drawn over the secondary ones,
+	// where the annotations overlap.
+	columns := 0
+	for _, s := range segments {
+		columns = max(columns, s.to)
+	}
+	marks := make([]byte, columns)
+	for _, primary := range []bool{false, true} {
+		for _, s := range segments {
+			if s.primary != primary {
+				continue
+			}
+			for column := s.from; column < s.to; column++ {
+				marks[column] = '-'
+				if primary {
+					marks[column] = '^'
+				}
+			}
+		}
+	}
+
+	var labels []segment
+	for _, s := range segments {
+		if s.text != "" {
+			labels = append(labels, s)
+		}
+	}
+	var inline segment
+	if len(labels) > 0 && labels[len(labels)-1].from == segments[len(segments)-1].from {
+		inline, labels = labels[len(labels)-1], labels[:len(labels)-1]
+	}
+
+	fmt.Fprintf(out, "%s %s ", gutter, r.paint("|", dimStyle))
+	for column := 0; column < len(marks); {
+		end := column
+		for end < len(marks) && marks[end] == marks[column] {
+			end++
+		}
+		switch marks[column] {
+		case 0:
+			out.WriteString(strings.Repeat(" ", end-column))
+		case '^':
+			out.WriteString(r.paint(string(marks[column:end]), style))
+		default:
+			out.WriteString(r.paint(string(marks[column:end]), secondaryStyle))
+		}
+		column = end
+	}
+	if inline.text != "" {
+		fmt.Fprintf(out, " %s", r.paint(inline.text, r.labelStyle(inline, style)))
+	}
+	out.WriteByte('\n')
+
+	// The other labels are written from the rightmost one,
+	// under connectors from their markers.
+	for i := len(labels) - 1; i >= 0; i-- {
+		r.connectors(out, labels[:i+1], gutter, style, false)
+		r.connectors(out, labels[:i+1], gutter, style, true)
+	}
+}
+
+// connectors writes a line with a `|` under the start of
+// each of the labels, or the text of the last one, if
+// text is true.
+func (r *Renderer) connectors(out *bufio.Writer, labels []segment, gutter, style string, text bool) {
+	fmt.Fprintf(out, "%s %s ", gutter, r.paint("|", dimStyle))
+	column := 0
+	for i, label := range labels {
+		mark := "|"
+		if text && i == len(labels)-1 {
+			mark = label.text
+		} else if label.from < column {
+			continue
+		}
+		out.WriteString(strings.Repeat(" ", max(label.from-column, 0)))
+		out.WriteString(r.paint(mark, r.labelStyle(label, style)))
+		column = label.from + 1
+	}
+	out.WriteByte('\n')
+}
+
+// labelStyle returns the style of the markers and the
+// text of a label.
+func (r *Renderer) labelStyle(label segment, style string) string {
+	if label.primary {
+		return style
+	}
+	return secondaryStyle
+}
+
+// span returns the start and the end of the location,
+// where the end isn't before the start.
+func span(location Location) (int, int) {
+	return location.Start(), max(location.End(), location.Start())
+}
+
+// source returns the source file of the location, or nil
+// if it isn't known.
+func (r *Renderer) source(location Location) *SourceFile {
+	if location, ok := location.(lexerLocation); ok && location.file != nil {
+		return location.file
+	}
+	text, ok := r.Sources[location.File()]
+	if !ok {
+		return nil
+	}
+	if r.files == nil {
+		r.files = make(map[string]*SourceFile)
+	}
+	if _, ok := r.files[location.File()]; !ok {
+		r.files[location.File()] = NewSourceFile(location.File(), text)
+	}
+	return r.files[location.File()]
+}
+
+// message joins the parts of the message of a diagnostic,
+// with spaces between them, but around the newlines.
+func message(text []ErrorText) string {
+	var message strings.Builder
+	for i, part := range text {
+		if i > 0 && part.kind != NewlineKind && text[i-1].kind != NewlineKind {
+			message.WriteByte(' ')
+		}
+		message.WriteString(part.String())
+	}
+	return message.String()
+}
+
+// tabWidth is the number of columns of a tab, that the
+// snippets expand, so the markers are aligned.
+const tabWidth = 4
+
+// expandTabs returns the text with the tabs replaced by
+// spaces.
+func expandTabs(text string) string {
+	return strings.ReplaceAll(text, "\t", strings.Repeat(" ", tabWidth))
+}
+
+// displayWidth returns the number of columns of the text,
+// counting a column for each rune, but for the tabs.
+func displayWidth(text string) int {
+	return utf8.RuneCountInString(text) + strings.Count(text, "\t")*(tabWidth-1)
+}
@@ -0,0 +1,268 @@
+package tonho
+
+import (
+	"slices"
+	"sort"
+)
+
+// Reparse parses the source code of the given file tree again,
+// with the edit applied, and returns the new tree, with the
+// diagnostics of the new text, given the diagnostics of the old
+// tree, like the ones returned by Parse.
+//
+// When the edit is inside of a block, only the innermost block
+// around it is lexed and parsed again, and the rest of the tree
+// is reused, with the tokens moved to the new text. Otherwise,
+// like when the edit breaks the braces of the block, the whole
+// file is parsed again.
+//
+// The diagnostics of the block replace the old ones inside of
+// it, and the old ones outside of it are kept, moved to the new
+// text, so they are the same as the ones of Parse.
+func Reparse(old Node, diagnostics []Diagnostic, edit TextEdit) (Node, []Diagnostic) {
+	tokens := unsplit(leaves(old, nil))
+	if len(tokens) == 0 || tokens[len(tokens)-1].Kind != EOF || tokens[len(tokens)-1].Location() == nil {
+		return old, nil
+	}
+
+	last := tokens[len(tokens)-1].Location()
+	source := last.Text()
+	edit.Start = clamp(edit.Start, 0, len(source))
+	edit.End = clamp(edit.End, edit.Start, len(source))
+
+	path := enclosingBlock(old, edit, nil)
+	if path == nil {
+		return Parse(last.File(), edit.Apply(source))
+	}
+
+	// The functions and the loops around the block are
+	// entered again, so its jumps are checked the same.
+	p := Parser{fuel: maxFuel}
+	target := old
+	for _, i := range path {
+		switch target.Kind {
+		case FunNode, LambdaNode:
+			p.functions++
+			p.loops = nil
+			p.deferred = 0
+		case DeferNode:
+			p.loops = nil
+			p.deferred++
+		case WhileNode, ForNode, LoopNode:
+			label := ""
+			if token, ok := target.Children[0].(Token); ok && token.Kind == Annotation {
+				label = token.Text
+			}
+			p.loops = append(p.loops, label)
+		}
+		target = target.Children[i].(Node)
+	}
+
+	// The block is parsed again only if its braces are still
+	// there after the edit, and the same tokens follow it.
+	relexed := Relex(tokens, edit)
+	delta := len(edit.Text) - (edit.End - edit.Start)
+	left := target.Children[0].(Token).Location().Start()
+	right := target.Children[len(target.Children)-1].(Token).Location().Start() + delta
+	open := sort.Search(len(relexed), func(i int) bool { return relexed[i].Location().Start() >= left })
+	close := sort.Search(len(relexed), func(i int) bool { return relexed[i].Location().Start() >= right })
+	if close >= len(relexed) || open >= close || relexed[open].Kind != LeftBrace || relexed[close].Kind != RightBrace || relexed[close].Location().Start() != right {
+		return Parse(last.File(), edit.Apply(source))
+	}
+	if after := len(relexed) - close; after > len(tokens) || !sameKinds(relexed[close:], tokens[len(tokens)-after:]) {
+		return Parse(last.File(), edit.Apply(source))
+	}
+
+	// The new block must end at the same closing brace, and
+	// not inside of a nested block, that is left unclosed. The
+	// tokens are copied, as the parser can split them.
+	p.tokens = slices.Clone(relexed[open : close+1])
+	p.block()
+	block := BuildTree(p.events, p.tokens)
+	if token, ok := block.Children[len(block.Children)-1].(Token); !ok || token.Kind != RightBrace || p.index != len(p.tokens) {
+		return Parse(last.File(), edit.Apply(source))
+	}
+
+	// The tokens out of the block are the same, so they are
+	// only moved to the new text.
+	file := relexed[0].Source()
+	end := target.Children[len(target.Children)-1].(Token).Location().End()
+	lexed := relexBlock(file, relexed, open, close)
+	diagnostics = replaceDiagnostics(diagnostics, lexed, p.Diagnostics(), left, end, delta, file)
+	var rebuild func(node Node, path []int) Node
+	rebuild = func(node Node, path []int) Node {
+		children := make([]Tree, len(node.Children))
+		for i, child := range node.Children {
+			switch child := child.(type) {
+			case Node:
+				switch {
+				case len(path) == 1 && i == path[0]:
+					children[i] = block
+				case len(path) > 1 && i == path[0]:
+					children[i] = rebuild(child, path[1:])
+				default:
+					children[i] = rebuild(child, nil)
+				}
+			case Token:
+				if child.Location().Start() >= edit.End {
+					children[i] = child.relocated(delta, file)
+				} else {
+					children[i] = child.relocated(0, file)
+				}
+			default:
+				children[i] = child
+			}
+		}
+		return NewNode(node.Kind, children)
+	}
+	return rebuild(old, path), diagnostics
+}
+
+// relexBlock lexes the block between the given tokens again,
+// and returns its lexer diagnostics, as Relex doesn't report
+// them.
+func relexBlock(file *SourceFile, tokens []Token, open, close int) []Diagnostic {
+	start, end := tokens[open].Location().Start(), tokens[close].Location().End()
+	l := lexer{file: file, input: file.Text(), position: start, trivia: start}
+	if open > 0 {
+		l.previous = tokens[open-1].Kind
+	}
+	for l.position < end && l.step() {
+		l.tokens = l.tokens[:0]
+	}
+	return l.errors
+}
+
+// replaceDiagnostics replaces the old diagnostics in the given
+// range of the old text with the lexer and the parser ones of
+// the text parsed again, and moves the others to the new text,
+// keeping the lexer diagnostics before the others, like Parse.
+func replaceDiagnostics(old, lexed, parsed []Diagnostic, start, end, delta int, file *SourceFile) []Diagnostic {
+	var groups [2][]Diagnostic
+	for n, lexer := range []bool{true, false} {
+		var before, after []Diagnostic
+		for _, diagnostic := range old {
+			if (diagnostic.Kind() == LexerError) != lexer {
+				continue
+			}
+			location := diagnostic.Location()
+			switch {
+			case location == nil || location.Start() <= start:
+				before = append(before, relocateDiagnostic(diagnostic, 0, file))
+			case location.Start() >= end:
+				after = append(after, relocateDiagnostic(diagnostic, delta, file))
+			}
+		}
+		replaced := parsed
+		if lexer {
+			replaced = lexed
+		}
+		groups[n] = slices.Concat(before, replaced, after)
+	}
+	return append(groups[0], groups[1]...)
+}
+
+// relocateDiagnostic returns the diagnostic with its location
+// and the ones of its labels moved by the given delta, into the
+// given source file.
+func relocateDiagnostic(diagnostic Diagnostic, delta int, file *SourceFile) Diagnostic {
+	relocate := func(location Location) Location {
+		if location == nil {
+			return nil
+		}
+		return lexerLocation{start: location.Start() + delta, end: location.End() + delta, file: file}
+	}
+	moved := NewDiagnostic(diagnostic.Kind(), diagnostic.Severity(), diagnostic.Code(), relocate(diagnostic.Location()), diagnostic.Error()...)
+	var labels []Label
+	for _, label := range diagnostic.Labels() {
+		label.Location = relocate(label.Location)
+		labels = append(labels, label)
+	}
+	return WithLabels(moved, labels...)
+}
+
+// leaves appends the tokens of the tree to the given slice,
+// in the order of the source code.
+func leaves(tree Tree, tokens []Token) []Token {
+	switch tree := tree.(type) {
+	case Token:
+		return append(tokens, tree)
+	case Node:
+		for _, child := range tree.Children {
+			tokens = leaves(child, tokens)
+		}
+	}
+	return tokens
+}
+
+// sameKinds returns true if the tokens of the same
+// length have the same kinds, so the tokens after the
+// block weren't lexed again differently, like when the
+// edit opens an interpolation.
+func sameKinds(a, b []Token) bool {
+	for i := range a {
+		if a[i].Kind != b[i].Kind {
+			return false
+		}
+	}
+	return true
+}
+
+// unsplit joins back the `>>` tokens, that the parser split
+// in two `>` tokens, and turns the soft keywords, that the
+// parser promoted, back into identifiers, as they are lexed.
+func unsplit(tokens []Token) []Token {
+	joined := tokens[:0:0]
+	for _, token := range tokens {
+		if token.Kind.IsSoftKeyword() {
+			token.Kind = Identifier
+		}
+		if n := len(joined); n > 0 && token.Kind == Greater && token.FullText == ">" && token.file != nil {
+			if previous := joined[n-1]; previous.Kind == Greater && previous.file == token.file && previous.end == token.start {
+				previous.Kind, previous.Text, previous.FullText = ShiftRight, ">>", previous.FullText+">"
+				previous.end = token.end
+				joined[n-1] = previous
+				continue
+			}
+		}
+		joined = append(joined, token)
+	}
+	return joined
+}
+
+// enclosingBlock returns the path of child indices to the
+// innermost block of the node, that contains the edit strictly
+// between its braces, or nil if there's none.
+func enclosingBlock(node Node, edit TextEdit, path []int) []int {
+	for i, child := range node.Children {
+		child, ok := child.(Node)
+		if !ok {
+			continue
+		}
+		inner := append(path[:len(path):len(path)], i)
+		if found := enclosingBlock(child, edit, inner); found != nil {
+			return found
+		}
+		if child.Kind == BlockNode && contains(child, edit) {
+			return inner
+		}
+	}
+	return nil
+}
+
+// contains returns true if the edit is strictly between the
+// braces of the given block, so they are kept.
+func contains(block Node, edit TextEdit) bool {
+	if len(block.Children) < 2 {
+		return false
+	}
+	left, ok := block.Children[0].(Token)
+	if !ok || left.Kind != LeftBrace || left.Location() == nil {
+		return false
+	}
+	right, ok := block.Children[len(block.Children)-1].(Token)
+	if !ok || right.Kind != RightBrace || right.Location() == nil {
+		return false
+	}
+	return left.Location().End() < edit.Start && edit.End < right.Location().Start()
+}
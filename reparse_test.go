@@ -0,0 +1,91 @@
+package tonho_test
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"tonho"
+)
+
+// editSource is the code that the random edits start from.
+const editSource = `fun f(a: Int) -> Int {
+  val x = a + 1
+  while (x < 10) {
+    x += 1
+    g("x is ${x}")
+  }
+  x
+}
+val y = f(2)
+struct P { x: Int }
+`
+
+// editPieces are the texts of the random edits, that open and
+// close the blocks, the strings and the interpolations, and have
+// lexer and parser errors.
+var editPieces = []string{
+	"", "1", "x", " ", "\n", "}", "{", "(", ")", "+ 2", "val z = 3\n", "\"", "//c\n", "/*",
+	"if (a) 1 else 2", "f<List<Int>>(x)", ">", "<", "break", "return 1", "@a loop { break @a }",
+	"${", "\"a${x}b\"", "defer { return 1 }", "when (x) { A.B(_, 1) -> 2 }", "1u9", "0xZZ",
+	"'ab'", "$", "1_", "#{1: 2, 1: 3}", "\\q",
+}
+
+// randomEdit returns a random edit of the source.
+func randomEdit(r *rand.Rand, source string) tonho.TextEdit {
+	start := r.Intn(len(source) + 1)
+	end := min(start+r.Intn(3), len(source))
+	return tonho.TextEdit{Start: start, End: end, Text: editPieces[r.Intn(len(editPieces))]}
+}
+
+// diagnosticsText formats the diagnostics, with their codes,
+// messages and spans, to compare them.
+func diagnosticsText(diagnostics []tonho.Diagnostic) string {
+	var text strings.Builder
+	for _, diagnostic := range diagnostics {
+		location := diagnostic.Location()
+		fmt.Fprintf(&text, "%s %v %d-%d %d:%d\n", diagnostic.Code(), diagnostic.Error(),
+			location.Start(), location.End(), location.Line(), location.Column())
+	}
+	return text.String()
+}
+
+func TestReparseMatchesParse(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for range 1000 {
+		source := editSource
+		tree, diagnostics := tonho.Parse("test", source)
+		for range 5 {
+			edit := randomEdit(r, source)
+			source = edit.Apply(source)
+			tree, diagnostics = tonho.Reparse(tree, diagnostics, edit)
+
+			want, wantDiagnostics := tonho.Parse("test", source)
+			if got, want := tree.Dump(), want.Dump(); got != want {
+				t.Fatalf("reparsing %q, got the tree:\n%s\nwant:\n%s", source, got, want)
+			}
+			if got := tonho.Print(tree); got != source {
+				t.Fatalf("reparsing %q, got the text %q", source, got)
+			}
+			if got, want := diagnosticsText(diagnostics), diagnosticsText(wantDiagnostics); got != want {
+				t.Fatalf("reparsing %q, got the diagnostics:\n%s\nwant:\n%s", source, got, want)
+			}
+		}
+	}
+}
+
+func TestReparseReportsBlockErrors(t *testing.T) {
+	source := "fun f() {\n  g(1)\n}\n"
+	tree, diagnostics := tonho.Parse("test", source)
+	for _, text := range []string{`"a`, "1u9", "0xZZ"} {
+		t.Run(text, func(t *testing.T) {
+			edit := tonho.TextEdit{Start: 14, End: 15, Text: text}
+			_, got := tonho.Reparse(tree, diagnostics, edit)
+			_, want := tonho.Parse("test", edit.Apply(source))
+			if len(want) == 0 || diagnosticsText(got) != diagnosticsText(want) {
+				t.Errorf("got the diagnostics:\n%s\nwant:\n%s", diagnosticsText(got), diagnosticsText(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package tonho
+
+// Rewrite returns the tree with its nodes replaced by the
+// function, that returns the replacement and true, or false
+// to keep the node. The nodes are rewritten bottom up, so
+// the function gets the node with its children rewritten.
+//
+// The tree isn't modified, as the nodes with a rewritten
+// child are copied, with their spans computed again from
+// the children, and the ones without are shared with the
+// new tree. A replacement without a location keeps the
+// location of the node it replaces.
+func Rewrite(tree Node, fn func(Node) (Node, bool)) Node {
+	node, _ := rewrite(tree, fn)
+	return node
+}
+
+// rewrite rewrites the node, and returns whether it was
+// replaced, so its parent can be copied.
+func rewrite(node Node, fn func(Node) (Node, bool)) (Node, bool) {
+	var children []Tree
+	for i, child := range node.Children {
+		child, ok := child.(Node)
+		if !ok {
+			continue
+		}
+		rewritten, ok := rewrite(child, fn)
+		if !ok {
+			continue
+		}
+		if children == nil {
+			children = make([]Tree, len(node.Children))
+			copy(children, node.Children)
+		}
+		children[i] = rewritten
+	}
+	changed := children != nil
+	if changed {
+		rebuilt := NewNode(node.Kind, children)
+		if rebuilt.location == nil {
+			rebuilt.location = node.location
+		}
+		node = rebuilt
+	}
+
+	replaced, ok := fn(node)
+	if !ok {
+		return node, changed
+	}
+	if replaced.location == nil {
+		replaced.location = node.location
+	}
+	return replaced, true
+}
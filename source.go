@@ -0,0 +1,144 @@
+package tonho
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// SourceFile represents a file of source code, that is shared
+// by the tokens and the locations of the file, so they only
+// need to store offsets into its text.
+//
+// It holds a table of the line start offsets of the text, so
+// the line and column of an offset can be found without
+// scanning the text again. The table is computed lazily, on
+// the first lookup, and it can be extended, when the text is
+// read as a stream.
+type SourceFile struct {
+	name string
+
+	mutex   sync.Mutex
+	text    string
+	scanned int
+	lines   []int
+}
+
+// NewSourceFile creates a new source file with the given name
+// and text.
+func NewSourceFile(name, text string) *SourceFile {
+	return &SourceFile{name: name, text: text, lines: []int{0}}
+}
+
+// Name returns the name of the source file.
+func (f *SourceFile) Name() string {
+	return f.name
+}
+
+// Text returns the text of the source file.
+func (f *SourceFile) Text() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.text
+}
+
+// extend replaces the text of the source file with the given
+// text, that must start with the current one.
+func (f *SourceFile) extend(text string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.text = text
+}
+
+// PositionFor returns the line and the column of the given
+// byte offset, both starting at 1. The column is counted in
+// runes.
+func (f *SourceFile) PositionFor(offset int) (int, int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.scan()
+	offset = clamp(offset, 0, len(f.text))
+
+	line := sort.Search(len(f.lines), func(n int) bool { return f.lines[n] > offset }) - 1
+	column := utf8.RuneCountInString(f.text[f.lines[line]:offset])
+	return line + 1, column + 1
+}
+
+// OffsetFor returns the byte offset of the given line and
+// column, both starting at 1, that is the inverse of the
+// PositionFor function. The offset is clamped to the line.
+func (f *SourceFile) OffsetFor(line, column int) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.scan()
+	start, end := f.line(line)
+	offset := start
+	for ; column > 1 && offset < end; column-- {
+		_, size := utf8.DecodeRuneInString(f.text[offset:end])
+		offset += size
+	}
+	return offset
+}
+
+// LineCount returns the number of lines of the source file.
+func (f *SourceFile) LineCount() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.scan()
+	return len(f.lines)
+}
+
+// LineText returns the text of the given line, starting at
+// 1, without the line break. It's empty if there's no such
+// line.
+func (f *SourceFile) LineText(n int) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.scan()
+	if n < 1 || n > len(f.lines) {
+		return ""
+	}
+	start, end := f.line(n)
+	return strings.TrimSuffix(f.text[start:end], "\r")
+}
+
+// Slice returns the text between the given byte offsets,
+// that are clamped to the text.
+func (f *SourceFile) Slice(start, end int) string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	start = clamp(start, 0, len(f.text))
+	end = clamp(end, start, len(f.text))
+	return f.text[start:end]
+}
+
+// line returns the byte offsets of the start and the end of
+// the given line, without the line break, clamping the line
+// to the lines of the text.
+func (f *SourceFile) line(n int) (int, int) {
+	n = clamp(n, 1, len(f.lines)) - 1
+
+	end := len(f.text)
+	if n+1 < len(f.lines) {
+		end = f.lines[n+1] - 1
+	}
+	return f.lines[n], end
+}
+
+// scan computes the line start offsets of the text, that
+// weren't computed yet.
+func (f *SourceFile) scan() {
+	for ; f.scanned < len(f.text); f.scanned++ {
+		if f.text[f.scanned] == '\n' {
+			f.lines = append(f.lines, f.scanned+1)
+		}
+	}
+}
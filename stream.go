@@ -0,0 +1,54 @@
+package tonho
+
+import "io"
+
+// chunkSize is the minimum amount of bytes that the lexer
+// reads at once, in the streaming mode.
+const chunkSize = 4096
+
+// LexReader creates a new lexer that reads the input from the
+// given reader, and returns the tokens and the diagnostics that
+// were found, and the error that happened while reading.
+//
+// The input is read in chunks, as the lexer needs them, so the
+// lexing starts without loading the whole input first.
+func LexReader(filename string, r io.Reader) ([]Token, []Diagnostic, error) {
+	l := lexer{file: NewSourceFile(filename, ""), reader: r}
+	tokens := l.lex()
+	return tokens, l.errors, l.err
+}
+
+// fill reads from the reader, in the streaming mode, until
+// there are at least n bytes after the lexer position, and
+// returns false if there aren't enough bytes left.
+func (l *lexer) fill(n int) bool {
+	if l.position+n <= len(l.input) {
+		return true
+	}
+	return l.read(n)
+}
+
+// read reads the chunks for the fill function. Each chunk is
+// as big as the text read so far, and it's read fully, so the
+// text is copied a linear amount of times.
+func (l *lexer) read(n int) bool {
+	for l.position+n > len(l.input) && l.reader != nil {
+		size := len(l.input)
+		if size < chunkSize {
+			size = chunkSize
+		}
+
+		buffer := make([]byte, size)
+		read, err := io.ReadFull(l.reader, buffer)
+		l.input += string(buffer[:read])
+		l.file.extend(l.input)
+
+		if err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				l.err = err
+			}
+			l.reader = nil
+		}
+	}
+	return l.position+n <= len(l.input)
+}
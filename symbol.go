@@ -0,0 +1,73 @@
+package tonho
+
+import (
+	"strings"
+	"sync"
+)
+
+// Symbol represents an interned text, like the name of an
+// identifier. The symbols of the same interner are equal if
+// and only if their texts are equal, so they can be compared
+// with `==`, without comparing the texts.
+type Symbol struct {
+	text *string
+}
+
+// Interner represents a table of interned texts, that holds
+// a single copy of each text, and its symbol. It's safe to
+// share an interner between goroutines.
+type Interner struct {
+	mutex   sync.Mutex
+	symbols map[string]Symbol
+}
+
+// NewInterner creates a new empty interner.
+func NewInterner() *Interner {
+	return &Interner{symbols: make(map[string]Symbol)}
+}
+
+// Intern returns the symbol of the given text, adding it to
+// the table if it isn't there yet.
+//
+// The table holds a copy of the text, so it doesn't keep the
+// source code, that the text can be a view of, alive.
+func (i *Interner) Intern(text string) Symbol {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if symbol, ok := i.symbols[text]; ok {
+		return symbol
+	}
+
+	text = strings.Clone(text)
+	symbol := Symbol{text: &text}
+	i.symbols[text] = symbol
+	return symbol
+}
+
+// Lookup returns the symbol of the given text, and false if
+// the text wasn't interned.
+func (i *Interner) Lookup(text string) (Symbol, bool) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	symbol, ok := i.symbols[text]
+	return symbol, ok
+}
+
+// Len returns the number of texts in the table.
+func (i *Interner) Len() int {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	return len(i.symbols)
+}
+
+// String returns the text of the symbol, or an empty string
+// for the zero symbol.
+func (s Symbol) String() string {
+	if s.text == nil {
+		return ""
+	}
+	return *s.text
+}
@@ -0,0 +1,352 @@
+package tonho
+
+import "fmt"
+
+// TokenKind represents the kind of a token.
+type TokenKind int
+
+// Token kinds. This defines the tokens that
+// are recognized by the lexer.
+//
+// The kinds are grouped by category, so the
+// literals, keywords, operators, delimiters
+// and trivia are declared next to each other.
+const (
+	EOF TokenKind = iota
+	Error
+
+	Identifier
+	Annotation
+
+	Decimal
+	Int
+	String
+	Char
+
+	// The segments of an interpolated string, like
+	// `"a ${`, `} b ${` and `} c"`, that surround
+	// the interpolated expressions.
+	StringStart
+	StringMiddle
+	StringEnd
+
+	Fun
+	Val
+	Var
+	For
+	While
+	Loop
+	If
+	Else
+	When
+	Struct
+	Enum
+	Module
+	Import
+	Return
+	Break
+	Continue
+	Defer
+
+	// The soft keywords, that are lexed as
+	// identifiers, and only promoted to
+	// keywords by the parser.
+	In
+	By
+	Where
+	Is
+	As
+
+	Plus
+	Minus
+	Asterisk
+	Slash
+	Percent
+	Equal
+	NotEqual
+	Less
+	LessEqual
+	Greater
+	GreaterEqual
+	And
+	Or
+	Not
+	BitAnd
+	BitOr
+	BitXor
+	BitNot
+	ShiftLeft
+	ShiftRight
+	Pipeline
+	Assign
+	PlusAssign
+	MinusAssign
+	AsteriskAssign
+	SlashAssign
+	PercentAssign
+	Dot
+	Range
+	RangeInclusive
+	Spread
+	Question
+	SafeDot
+	Elvis
+
+	LeftParen
+	RightParen
+	LeftBrace
+	RightBrace
+	LeftBracket
+	RightBracket
+	Comma
+	Colon
+	Semi
+	Arrow
+	FatArrow
+	HashBrace
+
+	// The indentation delimiters, that are only
+	// emitted with the EmitIndents option.
+	Indent
+	Dedent
+
+	Comment
+	Newline
+	Whitespace
+)
+
+// keywords is used to determine if an
+// identifier is a keyword or not.
+var keywords = map[string]TokenKind{
+	"fun":      Fun,
+	"val":      Val,
+	"var":      Var,
+	"for":      For,
+	"while":    While,
+	"loop":     Loop,
+	"if":       If,
+	"else":     Else,
+	"when":     When,
+	"struct":   Struct,
+	"enum":     Enum,
+	"module":   Module,
+	"import":   Import,
+	"return":   Return,
+	"break":    Break,
+	"continue": Continue,
+	"defer":    Defer,
+}
+
+// softKeywords maps the soft keywords to their
+// token kinds. They aren't reserved, so they
+// can still be used as identifiers, like `in`
+// in `val in = 0`.
+var softKeywords = map[string]TokenKind{
+	"in":    In,
+	"by":    By,
+	"where": Where,
+	"is":    Is,
+	"as":    As,
+}
+
+// TokenNames holds the names of the token kinds,
+// that are the source text of the keywords and
+// operators, so tools can render the tokens.
+var TokenNames = map[TokenKind]string{
+	EOF:   "EOF",
+	Error: "Error",
+
+	Identifier: "Identifier",
+	Annotation: "Annotation",
+
+	Decimal: "Decimal",
+	Int:     "Int",
+	String:  "String",
+	Char:    "Char",
+
+	StringStart:  "StringStart",
+	StringMiddle: "StringMiddle",
+	StringEnd:    "StringEnd",
+
+	Fun:      "fun",
+	Val:      "val",
+	Var:      "var",
+	For:      "for",
+	While:    "while",
+	Loop:     "loop",
+	If:       "if",
+	Else:     "else",
+	When:     "when",
+	Struct:   "struct",
+	Enum:     "enum",
+	Module:   "module",
+	Import:   "import",
+	Return:   "return",
+	Break:    "break",
+	Continue: "continue",
+	Defer:    "defer",
+	In:       "in",
+	By:       "by",
+	Where:    "where",
+	Is:       "is",
+	As:       "as",
+
+	Plus:           "+",
+	Minus:          "-",
+	Asterisk:       "*",
+	Slash:          "/",
+	Percent:        "%",
+	Equal:          "==",
+	NotEqual:       "!=",
+	Less:           "<",
+	LessEqual:      "<=",
+	Greater:        ">",
+	GreaterEqual:   ">=",
+	And:            "&&",
+	Or:             "||",
+	Not:            "!",
+	BitAnd:         "&",
+	BitOr:          "|",
+	BitXor:         "^",
+	BitNot:         "~",
+	ShiftLeft:      "<<",
+	ShiftRight:     ">>",
+	Pipeline:       "|>",
+	Assign:         "=",
+	PlusAssign:     "+=",
+	MinusAssign:    "-=",
+	AsteriskAssign: "*=",
+	SlashAssign:    "/=",
+	PercentAssign:  "%=",
+	Dot:            ".",
+	Range:          "..",
+	RangeInclusive: "..=",
+	Spread:         "...",
+	Question:       "?",
+	SafeDot:        "?.",
+	Elvis:          "?:",
+
+	LeftParen:    "(",
+	RightParen:   ")",
+	LeftBrace:    "{",
+	RightBrace:   "}",
+	LeftBracket:  "[",
+	RightBracket: "]",
+	Comma:        ",",
+	Colon:        ":",
+	Semi:         ";",
+	Arrow:        "->",
+	FatArrow:     "=>",
+	HashBrace:    "#{",
+	Indent:       "Indent",
+	Dedent:       "Dedent",
+
+	Comment:    "//",
+	Newline:    "\\n",
+	Whitespace: "Whitespace",
+}
+
+// compoundOperators maps each compound
+// assignment token to the binary operator
+// that it applies, like `+=` to `+`.
+var compoundOperators = map[TokenKind]TokenKind{
+	PlusAssign:     Plus,
+	MinusAssign:    Minus,
+	AsteriskAssign: Asterisk,
+	SlashAssign:    Slash,
+	PercentAssign:  Percent,
+}
+
+// CompoundOperator returns the binary operator
+// applied by the given compound assignment
+// token kind, so `x += 1` can be desugared
+// into `x = x + 1`.
+//
+// It returns false if the kind isn't a
+// compound assignment.
+func CompoundOperator(kind TokenKind) (TokenKind, bool) {
+	operator, ok := compoundOperators[kind]
+	return operator, ok
+}
+
+// KeywordFor returns the token kind of the given
+// keyword, including the soft keywords, so tools
+// don't need their own keyword tables.
+//
+// It returns false if the text isn't a keyword.
+func KeywordFor(text string) (TokenKind, bool) {
+	if kind, ok := keywords[text]; ok {
+		return kind, true
+	}
+	kind, ok := softKeywords[text]
+	return kind, ok
+}
+
+// String returns the name of the token kind.
+func (k TokenKind) String() string {
+	if name, ok := TokenNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// IsKeyword returns true if the token kind is
+// a keyword, like `fun`.
+func (k TokenKind) IsKeyword() bool {
+	return k >= Fun && k <= As
+}
+
+// IsSoftKeyword returns true if the token kind
+// is a soft keyword, like `in`.
+func (k TokenKind) IsSoftKeyword() bool {
+	return k >= In && k <= As
+}
+
+// AsSoftKeyword promotes the token to the given
+// soft keyword, if it's an identifier with the
+// text of the keyword, so the parser can accept
+// the keyword only where it's expected.
+func (t Token) AsSoftKeyword(kind TokenKind) (Token, bool) {
+	if t.Kind != Identifier || softKeywords[t.Text] != kind || !kind.IsSoftKeyword() {
+		return t, false
+	}
+	t.Kind = kind
+	return t, true
+}
+
+// IsOperator returns true if the token kind is
+// an operator, like `+` or `?.`.
+func (k TokenKind) IsOperator() bool {
+	return k >= Plus && k <= Elvis
+}
+
+// IsAssignmentOp returns true if the token kind
+// is an assignment, like `=` or `+=`.
+func (k TokenKind) IsAssignmentOp() bool {
+	return k >= Assign && k <= PercentAssign
+}
+
+// IsComparisonOp returns true if the token kind
+// is a comparison operator, like `==` or `<`.
+func (k TokenKind) IsComparisonOp() bool {
+	return k >= Equal && k <= GreaterEqual
+}
+
+// IsLiteralKind returns true if the token kind is
+// a literal, like a string or a number.
+func (k TokenKind) IsLiteralKind() bool {
+	return k >= Decimal && k <= StringEnd
+}
+
+// IsDelimiter returns true if the token kind is
+// a delimiter, like `(` or `,`.
+func (k TokenKind) IsDelimiter() bool {
+	return k >= LeftParen && k <= Dedent
+}
+
+// IsTrivia returns true if the token kind is a
+// trivia, like a comment, that doesn't change
+// the meaning of the code.
+func (k TokenKind) IsTrivia() bool {
+	return k >= Comment && k <= Whitespace
+}
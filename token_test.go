@@ -0,0 +1,46 @@
+package tonho_test
+
+import (
+	"slices"
+	"testing"
+
+	"tonho"
+)
+
+func TestTokenPredicates(t *testing.T) {
+	tests := []struct {
+		kind                           tonho.TokenKind
+		keyword, operator, assignment  bool
+		comparison, literal, delimiter bool
+	}{
+		{kind: tonho.Fun, keyword: true},
+		{kind: tonho.Plus, operator: true},
+		{kind: tonho.Assign, operator: true, assignment: true},
+		{kind: tonho.PlusAssign, operator: true, assignment: true},
+		{kind: tonho.Equal, operator: true, comparison: true},
+		{kind: tonho.LessEqual, operator: true, comparison: true},
+		{kind: tonho.Int, literal: true},
+		{kind: tonho.String, literal: true},
+		{kind: tonho.LeftParen, delimiter: true},
+		{kind: tonho.Identifier},
+	}
+	for _, test := range tests {
+		t.Run(test.kind.String(), func(t *testing.T) {
+			got := []bool{test.kind.IsKeyword(), test.kind.IsOperator(), test.kind.IsAssignmentOp(),
+				test.kind.IsComparisonOp(), test.kind.IsLiteralKind(), test.kind.IsDelimiter()}
+			want := []bool{test.keyword, test.operator, test.assignment, test.comparison, test.literal, test.delimiter}
+			if !slices.Equal(got, want) {
+				t.Errorf("got the predicates %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestKeywordFor(t *testing.T) {
+	if kind, ok := tonho.KeywordFor("fun"); !ok || kind != tonho.Fun {
+		t.Errorf("got %v, %v, want Fun", kind, ok)
+	}
+	if _, ok := tonho.KeywordFor("x"); ok {
+		t.Errorf("got a keyword for `x`")
+	}
+}
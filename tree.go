@@ -5,6 +5,14 @@ type Location interface {
 	Start() int
 	End() int
 
+	// Line gets the line of the start of the location,
+	// starting at 1.
+	Line() int
+
+	// Column gets the column of the start of the location,
+	// counted in runes and starting at 1.
+	Column() int
+
 	// Text gets the text of the file at the location.
 	Text() string
 
@@ -19,16 +27,19 @@ type Tree interface {
 
 // Node is a struct that represents a node in the concrete syntax tree.
 type Node struct {
-	Kind     int
+	Kind     NodeKind
 	Children []Tree
 
 	// The location of the node.
 	location Location
 }
 
+// NodeKind is the kind of a node, like FunNode.
+type NodeKind int
+
 // The kinds of nodes.
 const (
-	FileNode = iota
+	FileNode NodeKind = iota
 	ValNode
 	VarNode
 	WhileNode
@@ -45,12 +56,55 @@ const (
 	CallNode
 	NumberNode
 	StringNode
+	CharNode
 	BoolNode
 	IdentifierNode
 	ParameterNode
 	TypeNameNode
 	TypeApplicationNode
 	GenericsNode
+	MemberNode
+	IndexNode
+	BlockNode
+	FieldNode
+	VariantNode
+	WhenArmNode
+
+	// ErrorNode holds the tokens skipped by the parser,
+	// while recovering from a syntax error.
+	ErrorNode
+
+	TypeParameterNode
+	FunctionTypeNode
+	OptionalTypeNode
+	TupleTypeNode
+	ModuleNode
+	ImportNode
+	ImportItemNode
+	PathNode
+	LambdaNode
+	ListNode
+	SpreadNode
+	MapNode
+	EntryNode
+	TupleNode
+
+	// PatternNode is a tuple pattern, like `(x, _)`.
+	PatternNode
+
+	ReturnNode
+	BreakNode
+	ContinueNode
+	AttributesNode
+	AttributeNode
+	DeferNode
+	WildcardPatternNode
+	LiteralPatternNode
+	BindingPatternNode
+	VariantPatternNode
+	GuardNode
+	RangeNode
+	NamedArgumentNode
 )
 
 // Location gets the location of the node.
@@ -58,7 +112,49 @@ func (n Node) Location() Location {
 	return n.location
 }
 
-// NewNode creates a new node with the given kind and children.
-func NewNode(kind int, children []Tree) Node {
-	return Node{Kind: kind, Children: children}
+// NewNode creates a new node with the given kind and
+// children, that spans from the start of its first child
+// to the end of its last one, skipping the children
+// without a location, like the synthesized tokens. The
+// node has no location if none of its children has.
+func NewNode(kind NodeKind, children []Tree) Node {
+	return Node{Kind: kind, Children: children, location: spanning(children)}
+}
+
+// WithLocation returns the node with the given location,
+// instead of the one of its children, like for the nodes
+// that are synthesized from another one, so they point
+// to the code they come from.
+func (n Node) WithLocation(location Location) Node {
+	n.location = location
+	return n
+}
+
+// spanning returns the location from the start of the
+// first child with a location to the end of the last one,
+// or nil if there are none.
+func spanning(children []Tree) Location {
+	var first, last Location
+	for _, child := range children {
+		if first = child.Location(); first != nil {
+			break
+		}
+	}
+	for i := len(children) - 1; i >= 0 && first != nil; i-- {
+		if last = children[i].Location(); last != nil {
+			break
+		}
+	}
+	if first == nil {
+		return nil
+	}
+
+	// The locations in the same file keep pointing to it,
+	// so their text and positions are still available.
+	if start, ok := first.(lexerLocation); ok {
+		if end, ok := last.(lexerLocation); ok && start.file == end.file {
+			return lexerLocation{start: start.start, end: end.end, file: start.file}
+		}
+	}
+	return NewSpan(first.File(), first.Start(), last.End(), first.Line(), first.Column())
 }
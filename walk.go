@@ -0,0 +1,80 @@
+package tonho
+
+// Visitor represents the visitor of Walk, like go/ast's.
+//
+// The Visit function is called for each tree before its
+// children, and if it returns a visitor w, the children are
+// walked with w, and then w.Visit(nil) is called, after the
+// children, so the visitors can do their work in pre-order,
+// post-order, or both.
+type Visitor interface {
+	Visit(tree Tree) (w Visitor)
+}
+
+// Walk walks the tree in depth-first order, calling the
+// visitor for each node and token, as described by the
+// Visitor interface.
+func Walk(tree Tree, visitor Visitor) {
+	if visitor = visitor.Visit(tree); visitor == nil {
+		return
+	}
+	if node, ok := tree.(Node); ok {
+		for _, child := range node.Children {
+			Walk(child, visitor)
+		}
+	}
+	visitor.Visit(nil)
+}
+
+// inspector is the visitor of Inspect, that calls the
+// function.
+type inspector func(Tree) bool
+
+// Visit calls the function, and keeps walking with it if
+// the function returns true.
+func (f inspector) Visit(tree Tree) Visitor {
+	if f(tree) {
+		return f
+	}
+	return nil
+}
+
+// Inspect walks the tree in depth-first order, like Walk,
+// calling the function for each node and token. If the
+// function returns true, the children of the tree are
+// inspected too, followed by a call of the function with
+// nil.
+func Inspect(tree Tree, f func(Tree) bool) {
+	Walk(tree, inspector(f))
+}
+
+// Hooks are the functions of WalkHooks, that are called
+// before and after the children of each tree. Either of
+// them can be nil.
+type Hooks struct {
+	// Pre is called before the children of the tree,
+	// that are skipped if it returns false.
+	Pre func(tree Tree) bool
+
+	// Post is called after the children of the tree,
+	// or right after Pre for the tokens.
+	Post func(tree Tree)
+}
+
+// WalkHooks walks the tree in depth-first order, calling
+// the hooks for each node and token, so the callers don't
+// need to track the trees themselves to know which one
+// Visit(nil) ends, like with Walk.
+func WalkHooks(tree Tree, hooks Hooks) {
+	if hooks.Pre != nil && !hooks.Pre(tree) {
+		return
+	}
+	if node, ok := tree.(Node); ok {
+		for _, child := range node.Children {
+			WalkHooks(child, hooks)
+		}
+	}
+	if hooks.Post != nil {
+		hooks.Post(tree)
+	}
+}